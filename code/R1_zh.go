@@ -2,243 +2,240 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"html"
-	"html/template"
 	"io"
 	"log"
-	"net"
 	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strconv"
 	"strings"
-	"time"
+	"syscall"
+
+	"github.com/mcpackms/Network-File-Share/code/fileshare"
 )
 
 var (
-	rootDir string
-	port    string
+	cfg         = fileshare.DefaultConfig()
+	configFile  string
+	showVersion bool
 )
 
-var dirListTemplate = template.Must(template.New("").Parse(`
-<!-- HarmonyOS Sans 字体 -->
-<link href="https://cdn.jsdelivr.net/npm/harmonyos_sans_web@latest/css/harmonyos_sans.css" rel="stylesheet">
-<!-- 思源黑体 -->
-<link href="https://fonts.loli.net/css?family=Noto+Sans+SC" rel="stylesheet">
-
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>文件服务 - {{.RelPath}}</title>
-    <style>
-        /* 免费商用字体配置 */
-        li { 
-            font-family: "HarmonyOS Sans", "思源黑体", sans-serif;
-            font-size:14px; 
-            line-height:1.8;
-        }
-        dir { color: #2196F3; }
-        file { color: #4CAF50; }
-    </style>
-</head>
-<body>
-    <h2>📂 当前目录：{{.RelPath}}</h2>
-    <ul>
-        {{if .HasParent}}<li><a href="{{.ParentPath}}">↑ 返回上级</a></li>{{end}}
-        {{range .Files}}
-            <li><a href="{{.URL}}">
-                {{if .IsDir}}<dir>📁 {{.Name}}</dir>
-                {{else}}<file>📄 {{.Name}}</file>{{end}}
-            </a></li>
-        {{end}}
-    </ul>
-</body>
-</html>
-`))
-
-
 func init() {
-	flag.StringVar(&rootDir, "dir", "", "指定共享目录")
-	flag.StringVar(&rootDir, "directory", "", "同上")
-	flag.StringVar(&port, "port", "8080", "监听端口")
+	flag.StringVar(&configFile, "config", "", "配置文件(YAML 或 TOML 格式)，选项名与命令行参数相同，命令行参数优先")
+	flag.Func("dir", "指定共享目录；可重复使用 名称=路径 的形式同时共享多个目录", appendTo(&cfg.Dirs))
+	flag.Func("directory", "同上", appendTo(&cfg.Dirs))
+	flag.StringVar(&cfg.File, "file", "", "只共享这一个文件，在 / 和 /<文件名> 提供下载；-dir 指向文件时效果相同")
+	flag.StringVar(&cfg.Port, "port", cfg.Port, "监听端口(1-65535)，0表示自动选择空闲端口")
+	flag.BoolVar(&cfg.Force, "force", false, "共享系统敏感目录(如 /、/etc、主目录、C:\\)时不再要求确认")
+	flag.StringVar(&cfg.BaseURL, "base-url", "", "反向代理的子路径前缀，如 /files，请求路径去掉该前缀，生成的链接都会带上它")
+	flag.BoolVar(&cfg.TLS, "tls", false, "使用 HTTPS；没有指定 -cert/-key 时在启动时生成自签名证书")
+	flag.StringVar(&cfg.Cert, "cert", "", "HTTPS 证书文件(PEM)，指定后自动开启 -tls")
+	flag.StringVar(&cfg.Key, "key", "", "HTTPS 私钥文件(PEM)，与 -cert 一起使用")
+	flag.StringVar(&cfg.Unix, "unix", "", "监听 Unix 套接字而不是 TCP 端口，适合放在同机的 nginx 后面")
+	flag.IntVar(&cfg.PageSize, "page-size", 0, "目录列表每页条目数，0表示不分页")
+	flag.BoolVar(&cfg.Writable, "writable", false, "允许通过网页新建文件夹和删除文件")
+	flag.Var(readOnlyFlag{}, "readonly", "只读模式(默认开启)：拒绝上传、删除、新建文件夹等所有修改操作，-readonly=false 等同于 -writable")
+	flag.BoolVar(&cfg.RenderReadme, "render-readme", false, "目录下有 README.md 或 README.txt 时显示在文件列表上方")
+	flag.BoolVar(&cfg.WebDAV, "webdav", false, "在 /_nfs/dav/ 提供 WebDAV，可在资源管理器/访达中挂载为网络驱动器，读写权限同 -writable")
+	flag.StringVar(&cfg.Template, "template", "", "自定义目录列表模板(HTML文件)，可用字段见 DirListData")
+	flag.Func("allow-ext", "只允许访问这些扩展名的文件，逗号分隔，如 jpg,png,mp4", setList(&cfg.AllowExt))
+	flag.Func("deny-ext", "禁止访问这些扩展名的文件，逗号分隔，优先于 -allow-ext", setList(&cfg.DenyExt))
+	flag.Func("allow-cidr", "只允许这些网段访问，逗号分隔，如 192.168.0.0/16,10.0.0.0/8", appendList(&cfg.AllowCIDR))
+	flag.Func("cors", "允许跨域调用 API 的来源，逗号分隔，如 http://localhost:3000，* 表示任意来源", appendList(&cfg.CORS))
+	flag.StringVar(&cfg.Auth, "auth", "", "全站登录认证：用户名:密码，或 htpasswd:文件路径(支持 bcrypt、apr1、{SHA} 格式，修改后自动重新读取)")
+	flag.StringVar(&cfg.User, "user", "", "全站登录的用户名，与 -password 一起使用，等同于 -auth 用户名:密码")
+	flag.StringVar(&cfg.Password, "password", "", "全站登录的密码，与 -user 一起使用")
+	flag.StringVar(&cfg.UsersFile, "users-file", "", "全站登录的用户文件(htpasswd 格式)，等同于 -auth htpasswd:文件路径")
+	flag.Func("index-files", "访问目录时依次查找这些文件，找到第一个就直接显示而不是列出目录，逗号分隔，如 index.html,default.htm", setList(&cfg.IndexFiles))
+	flag.IntVar(&cfg.MaxDepth, "max-depth", cfg.MaxDepth, "递归操作(统计文件夹大小、打包下载、搜索)最多深入的目录层数，0表示不限制")
+	flag.IntVar(&cfg.MaxConns, "max-conns", 0, "同时处理的最大请求数，超出返回503，0表示不限制")
+	flag.IntVar(&cfg.MaxConnsPerIP, "max-conns-per-ip", 0, "每个客户端 IP 同时处理的最大请求数，超出返回429，0表示不限制")
+	flag.Float64Var(&cfg.RatePerIP, "rate-per-ip", 0, "每个客户端 IP 每秒最多的请求数，允许短时间突发同样多的请求，超出返回429，0表示不限制")
+	flag.Func("mime", "自定义扩展名的 MIME 类型，如 log=text/plain,glb=model/gltf-binary，可重复使用", appendList(&cfg.MIME))
+	flag.StringVar(&cfg.Favicon, "favicon", "", "自定义网站图标文件(.ico 或 .png)")
+	flag.StringVar(&cfg.AuditLog, "audit-log", "", "审计日志文件，记录谁在何时下载/上传/删除了哪些文件，收到 SIGHUP 时重新打开")
+	flag.StringVar(&cfg.ShareSecret, "share-secret", "", "签名分享链接的密钥，留空则每次启动随机生成（重启后旧链接失效）")
+	flag.BoolVar(&cfg.Dashboard, "dashboard", false, "首页显示服务器信息(版本、运行时长、请求数)，文件浏览移到 /browse/")
+	flag.StringVar(&cfg.LogFile, "log-file", "", "日志写入该文件(同时输出到终端)，超过 -log-max-size 自动切割，收到 SIGHUP 时重新打开")
+	flag.Func("daily-quota", "每个 IP 每天最多下载的字节数，如 5GB，超出后当天的下载请求返回429，0表示不限制", cfg.DailyQuota.Set)
+	flag.StringVar(&cfg.QuotaFile, "quota-file", "", "保存 -daily-quota 计数的文件，重启后当天已用的流量不清零")
+	flag.Func("log-max-size", "日志文件切割大小，如 10m，0表示不切割 (默认 10m)", cfg.LogMaxSize.Set)
+	flag.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "请求日志格式：default、clf(Apache 通用日志格式，可用于 GoAccess 等工具)或 json(每行一个 JSON 对象)")
+	flag.StringVar(&cfg.AccessLog, "access-log", "", "访问日志单独写入该文件(按 -log-max-size 切割)，未指定 -log-format 时使用 clf 格式")
+	flag.IntVar(&cfg.LogKeep, "log-keep", cfg.LogKeep, "切割后保留的旧日志文件个数")
+	flag.BoolVar(&cfg.Gzip, "gzip", false, "对支持的浏览器 gzip 压缩目录列表、JSON 等文本响应")
+	flag.BoolVar(&cfg.NoCompressDownloads, "no-compress-downloads", cfg.NoCompressDownloads, "开启 -gzip 时也不压缩文件下载，保留 Content-Length 以显示下载进度")
+	flag.BoolVar(&cfg.Precompressed, "precompressed", false, "客户端支持时改发同目录下预先压缩好的 .br/.gz 版本(如 app.js.br)，用于托管前端静态文件")
+	flag.BoolVar(&showVersion, "version", false, "显示版本、提交和构建日期后退出")
+	flag.BoolVar(&cfg.Verbose, "verbose", false, "输出调试日志(每个请求解析后的路径、日志所在代码行)")
+	flag.BoolVar(&cfg.Open, "open", false, "启动后用默认浏览器打开共享页面")
+	flag.BoolVar(&cfg.QR, "qr", false, "启动时在终端显示访问地址的二维码")
+	flag.StringVar(&cfg.MDNS, "mdns", "", "通过 mDNS 在局域网发布服务，其他电脑可以用 <名称>.local 访问，如 -mdns fileshare")
+	flag.Func("max-rate", "所有下载合计的最大速度(每秒)，如 2m 表示 2MB/s，0表示不限制", cfg.MaxRate.Set)
+	flag.Func("max-rate-per-conn", "单个下载的最大速度(每秒)，如 500k，0表示不限制", cfg.MaxRatePerConn.Set)
+	flag.Func("buffer-size", "下载时每次读写的缓冲区大小，如 256k、1m，范围 4k-16m (默认 32k)", cfg.BufferSize.Set)
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "下载过程中客户端停止接收数据超过该时长则断开，0表示不限制")
+	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", 0, "响应写入超时，如30s，0表示不限制（大文件下载需要）")
+	flag.BoolVar(&cfg.FollowSymlinks, "follow-symlinks", false, "允许访问指向共享目录以外的符号链接(默认拒绝，返回403)")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "收到 Ctrl+C 或 SIGTERM 后等待进行中的下载完成的最长时间，超时后强制断开")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", 0, "单个请求(目录列表、缩略图等)处理超过该时长返回503，文件下载和上传不受限制，0表示不限制")
 }
 
-func main() {
-	flag.Parse()
-
-	localIP := getLocalIP()
-
-	if rootDir == "" {
-		reader := bufio.NewReader(os.Stdin)
-		for {
-			log.Print("请输入要共享的目录路径:  如/sdcard或/root")
-			input, _ := reader.ReadString('\n')
-			rootDir = strings.TrimSpace(input)
-			var err error
-			if err = validateDirectory(rootDir); err == nil {
-				break
-			}
-			log.Printf("路径无效: %v，请重新输入", err)
-		}
+// appendTo 返回把参数值追加到 list 的 flag.Func 回调，用于可重复的参数
+func appendTo(list *[]string) func(string) error {
+	return func(v string) error {
+		*list = append(*list, v)
+		return nil
 	}
+}
 
-	resolvedRoot, err := filepath.EvalSymlinks(rootDir)
-	if err != nil {
-		log.Fatalf("解析符号链接失败: %v", err)
-	}
-	rootDir = resolvedRoot
-
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Printf("\n[start]文件服务器配置\n"+
-		"  共享目录: %s\n"+
-		"  监听端口: %s\n"+
-		"  本地访问: http://127.0.0.1:%s\n"+
-		"  局域网访问: http://%s:%s\n"+
-		"  ctrl+c退出",
-		rootDir, port, port, localIP, port)
-
-	server := &http.Server{
-		Addr:         ":" + port,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+// setList 返回把逗号分隔的参数值设置为 list 的回调，重复指定时以最后一次为准
+func setList(list *[]string) func(string) error {
+	return func(v string) error {
+		*list = strings.Split(v, ",")
+		return nil
 	}
+}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
-		reqPath := r.URL.Path
-		log.Printf("[request]%s %s", r.Method, reqPath)
-
-		defer func() {
-			log.Printf("[finish]%s %s 耗时: %v", r.Method, reqPath, time.Since(startTime))
-		}()
-
-		path := strings.TrimPrefix(reqPath, "/")
-		cleanedPath := filepath.Clean(path)
-		fullPath := filepath.Join(rootDir, cleanedPath)
-
-		// 调试日志：打印处理后的路径
-		log.Printf("处理路径: %s → %s", reqPath, fullPath)
-
-		file, err := os.Open(fullPath)
-		if err != nil {
-			log.Printf("打开文件失败: %v", err)
-			http.Error(w, "文件未找到", http.StatusNotFound)
-			return
-		}
-		defer file.Close()
-
-		fileInfo, err := file.Stat()
-		if err != nil {
-			log.Printf("获取文件信息失败: %v", err)
-			http.Error(w, "文件访问错误", http.StatusInternalServerError)
-			return
-		}
-
-		if fileInfo.IsDir() {
-			listDir(w, r, fullPath, cleanedPath)
-		} else {
-			sendFile(w, r, fullPath, fileInfo.Name(), fileInfo.Size())
-		}
-	})
-
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("启动失败: %v (可能原因：端口被占用或权限不足，建议改高端口，如8082)", err)
+// appendList 返回把逗号分隔的参数值追加到 list 的回调，可重复指定
+func appendList(list *[]string) func(string) error {
+	return func(v string) error {
+		*list = append(*list, strings.Split(v, ",")...)
+		return nil
 	}
 }
 
-func validateDirectory(path string) error {
-	info, err := os.Stat(path)
+// readOnlyFlag 是 -readonly 参数，和 -writable 含义相反，两者设置的是同一个开关
+type readOnlyFlag struct{}
+
+func (readOnlyFlag) String() string   { return strconv.FormatBool(!cfg.Writable) }
+func (readOnlyFlag) IsBoolFlag() bool { return true }
+
+func (readOnlyFlag) Set(v string) error {
+	b, err := strconv.ParseBool(v)
 	if err != nil {
 		return err
 	}
-	if !info.IsDir() {
-		return os.ErrInvalid
-	}
+	cfg.Writable = !b
 	return nil
 }
 
-func listDir(w http.ResponseWriter, r *http.Request, dirPath string, relPath string) {
-	files, err := os.ReadDir(dirPath)
-	if err != nil {
-		log.Printf("读取目录失败: %v", err)
-		http.Error(w, "目录不可读", http.StatusInternalServerError)
+func main() {
+	flag.Parse()
+
+	if showVersion {
+		fmt.Println(fileshare.VersionString())
 		return
 	}
 
-	type FileInfo struct {
-		URL   string
-		Name  string
-		IsDir bool
-	}
-	data := struct {
-		RelPath    string
-		ParentPath string
-		HasParent  bool
-		Files      []FileInfo
-	}{
-		RelPath:    html.EscapeString(relPath),
-		HasParent:  relPath != "",
-		ParentPath: url.PathEscape(filepath.ToSlash(filepath.Dir(relPath))), // 父路径URL编码
+	// 配置文件中的值只用于命令行没有设置的参数
+	if configFile != "" {
+		setOnCommandLine := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { setOnCommandLine[f.Name] = true })
+		if err := fileshare.LoadConfigFile(configFile, &cfg, setOnCommandLine); err != nil {
+			log.Fatalf("读取配置文件失败: %v", err)
+		}
 	}
 
-	for _, file := range files {
-		name := file.Name()
-		// 对文件名进行URL编码，但显示时保持原样
-		urlPath := url.PathEscape(filepath.ToSlash(filepath.Join(relPath, name)))
-		data.Files = append(data.Files, FileInfo{
-			URL:   urlPath, // 直接使用编码后的URL
-			Name:  html.EscapeString(name), // 显示时转义HTML
-			IsDir: file.IsDir(),
-		})
+	var logFile *fileshare.LogFile
+	if cfg.LogFile != "" {
+		var err error
+		if logFile, err = fileshare.OpenLogFile(cfg.LogFile, cfg.LogMaxSize, cfg.LogKeep); err != nil {
+			log.Fatalf("打开日志文件失败: %v", err)
+		}
+		// 先写文件：后台运行时终端可能已关闭，写入失败不能影响文件日志
+		log.SetOutput(io.MultiWriter(logFile, os.Stderr))
+	}
+	if cfg.Verbose {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := dirListTemplate.Execute(w, data); err != nil {
-		log.Printf("模板渲染失败: %v", err)
+	if len(cfg.Dirs) == 0 && cfg.File == "" {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			log.Print("请输入要共享的目录路径:  如/sdcard或/root")
+			input, _ := reader.ReadString('\n')
+			dir := strings.TrimSpace(input)
+			err := fileshare.ValidateDirectory(dir)
+			if err == nil {
+				cfg.Dirs = []string{dir}
+				break
+			}
+			log.Printf("路径无效: %v，请重新输入", err)
+		}
 	}
-}
 
-func sendFile(w http.ResponseWriter, r *http.Request, filePath, fileName string, fileSize int64) {
-	file, err := os.Open(filePath)
+	cfg.ConfirmSensitive = confirmSensitive
+	server, err := fileshare.New(cfg)
 	if err != nil {
-		log.Printf("打开文件失败: %v", err)
-		http.Error(w, "文件未找到", http.StatusNotFound)
-		return
+		log.Fatal(err)
 	}
-	defer file.Close()
-
-	// 兼容各种浏览器的文件名编码方式
-	encodedName := url.PathEscape(fileName)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, encodedName, encodedName))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", strconv.FormatInt(fileSize, 10))
-
-	if _, err := io.Copy(w, file); err != nil {
-		log.Printf("文件传输失败: %v", err)
+	if err := server.Listen(); err != nil {
+		log.Fatalf("启动失败: %v", err)
 	}
-}
+	go func() {
+		if err := server.Serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("启动失败: %v", err)
+		}
+	}()
 
-func getLocalIP() string {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err == nil {
-		defer conn.Close()
-		return strings.Split(conn.LocalAddr().String(), ":")[0]
-	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reopenLogs(server, logFile, hup)
 
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "127.0.0.1"
-	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	shutdown(server, sig)
+}
 
-	for _, addr := range addrs {
-		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-			if ipNet.IP.To4() != nil {
-				return ipNet.IP.String()
+// reopenLogs 每次收到 SIGHUP 时重新打开 -log-file、-access-log 和 -audit-log，配合 logrotate 切割日志
+func reopenLogs(server *fileshare.Server, logFile *fileshare.LogFile, hup <-chan os.Signal) {
+	for range hup {
+		if logFile != nil {
+			if err := logFile.Reopen(); err != nil {
+				log.Printf("重新打开日志文件失败: %v", err)
 			}
 		}
+		if err := server.Reopen(); err != nil {
+			log.Print(err)
+			continue
+		}
+		log.Print("已重新打开日志文件")
 	}
-	return "127.0.0.1"
+}
+
+// shutdown 等待进行中的下载在 -shutdown-timeout 内完成后退出，期间再收到一次信号立即退出
+func shutdown(server *fileshare.Server, sig <-chan os.Signal) {
+	log.Print("[stop]收到退出信号，再按一次 Ctrl+C 立即退出")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	server.Shutdown(ctx)
+	log.Print("[stop]已退出")
+}
+
+// confirmSensitive 醒目地提示风险并等待用户确认，无法读取输入时视为拒绝
+func confirmSensitive(root string) bool {
+	log.Printf("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n"+
+		"  警告：%s 是系统敏感目录或包含敏感目录，\n"+
+		"  共享后局域网内任何人都能读取其中的文件！\n"+
+		"!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!", root)
+	fmt.Print("确定要共享吗？(y/n) ")
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && input == "" {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(input))
+	return answer == "y" || answer == "yes"
 }
@@ -0,0 +1,209 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny []string
+		allowed     []string
+		denied      []string
+	}{
+		{"不限制", nil, nil, []string{"a.jpg", "a.env", "Makefile"}, nil},
+		{"只有允许列表", []string{"jpg", ".PNG"}, nil, []string{"a.jpg", "A.JPG", "b.png", "c.Png"}, []string{"a.env", "Makefile", "a.jpg.txt"}},
+		{"只有禁止列表", nil, []string{"env", "KEY"}, []string{"a.jpg", "Makefile", "env"}, []string{".env", "prod.ENV", "id.key"}},
+		{"禁止优先", []string{"jpg,env"}, []string{"env"}, []string{"a.jpg"}, []string{"a.env", "a.png"}},
+	}
+	for _, tt := range tests {
+		s, _ := newTestServer(t, Config{AllowExt: tt.allow, DenyExt: tt.deny}, nil)
+		for _, name := range tt.allowed {
+			if !s.extAllowed(name) {
+				t.Errorf("%s: %s 应被允许", tt.name, name)
+			}
+		}
+		for _, name := range tt.denied {
+			if s.extAllowed(name) {
+				t.Errorf("%s: %s 应被拒绝", tt.name, name)
+			}
+		}
+	}
+}
+
+func TestExtFilterListingAndDownload(t *testing.T) {
+	s, _ := newTestServer(t, Config{AllowExt: []string{"jpg", "txt"}, DenyExt: []string{"txt"}}, map[string]string{
+		"photo.JPG":  "jpg",
+		"notes.txt":  "txt",
+		"secret.env": "env",
+		"sub/a.jpg":  "a",
+	})
+	h := s.Handler()
+
+	body := do(t, h, "GET", "/", nil).Body.String()
+	for _, name := range []string{"photo.JPG", "sub"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("列表中没有 %s", name)
+		}
+	}
+	for _, name := range []string{"notes.txt", "secret.env"} {
+		if strings.Contains(body, name) {
+			t.Errorf("列表中出现了被过滤的 %s", name)
+		}
+	}
+
+	if rec := do(t, h, "GET", "/photo.JPG", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /photo.JPG = %d", rec.Code)
+	}
+	for _, target := range []string{"/notes.txt", "/secret.env"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s = %d, 应为403", target, rec.Code)
+		}
+	}
+}
+
+// 同时处理的请求达到 -max-conns 后，新的请求立即得到 503，进行中的请求结束后恢复
+func TestMaxConnsRejectsWhenFull(t *testing.T) {
+	s, _ := newTestServer(t, Config{MaxConns: 2, MaxRatePerConn: 32 << 10}, map[string]string{
+		"slow.bin":  strings.Repeat("x", 1<<20),
+		"small.txt": "ok",
+	})
+	base := startServer(t, s)
+
+	// 限速下载发出第一秒的突发数据后就停下等待，一直占着名额
+	var slow []*http.Response
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(base + "/slow.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		slow = append(slow, resp)
+	}
+
+	resp, err := http.Get(base + "/small.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("已满时 GET = %d, 应为503", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("503 响应没有 Retry-After")
+	}
+
+	for _, resp := range slow {
+		resp.Body.Close()
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		resp, err := http.Get(base + "/small.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("慢速请求断开后仍然返回 %d", resp.StatusCode)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestAllowCIDR(t *testing.T) {
+	s, _ := newTestServer(t, Config{AllowCIDR: []string{"192.168.0.0/16", "10.0.0.0/8", "fd00::/8"}}, map[string]string{"a.txt": "a"})
+	h := s.Handler()
+
+	tests := []struct {
+		remote string
+		want   int
+	}{
+		{"192.168.1.42:50000", http.StatusOK},
+		{"192.168.255.255:1", http.StatusOK},
+		{"10.1.2.3:50000", http.StatusOK},
+		{"[::ffff:192.168.1.42]:50000", http.StatusOK}, // IPv4 映射的 IPv6 地址
+		{"[fd00::2]:50000", http.StatusOK},
+		{"192.169.0.1:50000", http.StatusForbidden},
+		{"11.0.0.1:50000", http.StatusForbidden},
+		{"127.0.0.1:50000", http.StatusForbidden},
+		{"[fe80::1]:50000", http.StatusForbidden},
+		{"not-an-ip", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/a.txt", nil)
+		req.RemoteAddr = tt.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: GET /a.txt = %d, 应为 %d", tt.remote, rec.Code, tt.want)
+		}
+	}
+
+	// 不设置时允许所有地址
+	open, _ := newTestServer(t, Config{}, map[string]string{"a.txt": "a"})
+	req := httptest.NewRequest("GET", "/a.txt", nil)
+	req.RemoteAddr = "203.0.113.9:1"
+	rec := httptest.NewRecorder()
+	open.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("未设置 -allow-cidr 时 GET = %d", rec.Code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	s, _ := newTestServer(t, Config{CORS: []string{"https://app.example.com/"}}, map[string]string{"a.txt": "a"})
+	h := s.Handler()
+	const origin = "https://app.example.com"
+
+	// 预检请求
+	rec := do(t, h, "OPTIONS", "/?format=json", nil, "Origin", origin, "Access-Control-Request-Method", "GET", "Access-Control-Request-Headers", "X-Token")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("预检 = %d, 应为204", rec.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      origin,
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers":     "X-Token",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("预检 %s = %q, 应为 %q", name, got, want)
+		}
+	}
+	if rec := do(t, h, "OPTIONS", "/?format=json", nil, "Origin", "https://evil.example.com", "Access-Control-Request-Method", "GET"); rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("其他来源的预检 = %d %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// 简单的跨域 GET
+	rec = do(t, h, "GET", "/", nil, "Origin", origin, "Accept", "application/json")
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != origin {
+		t.Errorf("跨域 GET JSON = %d, Allow-Origin %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if !strings.Contains(rec.Header().Get("Vary"), "Origin") {
+		t.Errorf("Vary = %q, 应包含 Origin", rec.Header().Get("Vary"))
+	}
+	if rec := do(t, h, "GET", "/a.txt?checksum=sha256", nil, "Origin", origin); rec.Header().Get("Access-Control-Allow-Origin") != origin {
+		t.Error("校验值接口没有 CORS 头")
+	}
+	// HTML 页面和文件下载不允许跨域读取
+	for _, target := range []string{"/", "/a.txt"} {
+		if rec := do(t, h, "GET", target, nil, "Origin", origin); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("GET %s 不应有 CORS 头", target)
+		}
+	}
+	if rec := do(t, h, "GET", "/?format=json", nil, "Origin", "https://evil.example.com"); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("不允许的来源得到了 CORS 头")
+	}
+
+	wildcard, _ := newTestServer(t, Config{CORS: []string{"*"}}, nil)
+	rec = do(t, wildcard.Handler(), "GET", "/?format=json", nil, "Origin", "https://any.example.com")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("-cors * : Allow-Origin %q, Allow-Credentials %q", rec.Header().Get("Access-Control-Allow-Origin"), rec.Header().Get("Access-Control-Allow-Credentials"))
+	}
+}
@@ -0,0 +1,298 @@
+package fileshare
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// zipItem 是要打包进 zip 的一个文件
+type zipItem struct {
+	fullPath string
+	name     string // zip 内的路径，"/"分隔
+}
+
+// writeZip 把文件逐个流式写入 zip，不在内存或磁盘上生成完整的压缩包
+func writeZip(w io.Writer, items []zipItem) error {
+	zw := zip.NewWriter(w)
+	for _, item := range items {
+		if err := addZipFile(zw, item); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addZipFile(zw *zip.Writer, item zipItem) error {
+	file, err := os.Open(item.fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = item.name
+	header.Method = zip.Deflate
+
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, file)
+	return err
+}
+
+// sendZip 设置下载头并流式输出 zip
+func (s *Server) sendZip(w http.ResponseWriter, r *http.Request, zipName string, items []zipItem) {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.fullPath
+	}
+	s.sendArchive(w, r, zipName, "application/zip", "zip:"+strings.Join(paths, ","), func(out io.Writer) error {
+		return writeZip(out, items)
+	})
+}
+
+// sendArchive 设置下载头，调用 write 流式输出压缩包，并计入限速、下载配额、统计和审计日志；
+// 配额在打包过程中用完时停止输出
+func (s *Server) sendArchive(w http.ResponseWriter, r *http.Request, name, ctype, auditPath string, write func(io.Writer) error) {
+	if !s.allowDownload(w, r) {
+		return
+	}
+	noTimeout(w)
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name))
+	w.Header().Set("Content-Type", ctype)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// 已经开始输出后无法再返回错误状态码，只能记录日志
+	cw := &countingWriter{s: s, w: s.withQuota(w, r), ctx: r.Context(), limit: s.downloadLimiter(), tr: s.transfers.begin(name)}
+	if err := write(cw); err != nil {
+		log.Printf("打包下载失败: %v", err)
+	}
+	s.transfers.end(cw.tr)
+	s.audit.Record(r, "download", auditPath, cw.n)
+}
+
+// countingWriter 统计写入的字节数，并按 limit 限速
+type countingWriter struct {
+	s     *Server
+	w     io.Writer
+	n     int64
+	ctx   context.Context
+	limit limiter
+	tr    *transfer
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if err := c.limit.wait(c.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.tr.sent.Add(int64(n))
+	c.s.transfers.add(int64(n))
+	return n, err
+}
+
+// handleZipSelected 把列表中勾选的文件打包为 zip 下载
+func (s *Server) handleZipSelected(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	paths := r.PostForm["path"]
+	if len(paths) == 0 {
+		s.renderError(w, r, http.StatusBadRequest, "没有选择文件")
+		return
+	}
+
+	// 先校验全部路径，出错时还能返回正确的状态码
+	var items []zipItem
+	for _, p := range paths {
+		fullPath, _, err := s.resolvePath(p)
+		if err != nil || fullPath == "" {
+			s.renderError(w, r, http.StatusForbidden, "禁止访问")
+			return
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil || !info.Mode().IsRegular() || !s.extAllowed(info.Name()) || s.pathHidden(fullPath) {
+			s.renderError(w, r, http.StatusNotFound, "文件未找到: "+p)
+			return
+		}
+		if !s.checkDirAuth(w, r, fullPath) {
+			return
+		}
+		items = append(items, zipItem{fullPath: fullPath, name: info.Name()})
+	}
+
+	log.Printf("[zip]打包 %d 个文件", len(items))
+	s.sendZip(w, r, "selected.zip", items)
+}
+
+// sendDirZip 把整个目录(含子目录)打包为 zip 下载，如 /photos/?download=zip。
+// 和浏览时一样跳过被 .nfshide 隐藏、扩展名不允许以及没有密码的受保护子目录里的文件；
+// granted 是调用方已经用其他方式授权过的受保护目录(如分享链接)，不为空时不再检查它的密码
+func (s *Server) sendDirZip(w http.ResponseWriter, r *http.Request, dirPath, granted string) {
+	base := filepath.Base(dirPath)
+	include := s.archiveFilter(r, granted)
+
+	var items []zipItem
+	err := s.walkLimited(dirPath, func(p string, d fs.DirEntry) error {
+		if !d.Type().IsRegular() || !include(p, false) {
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+		items = append(items, zipItem{fullPath: p, name: path.Join(base, filepath.ToSlash(rel))})
+		return nil
+	})
+	if err != nil {
+		log.Printf("遍历目录失败: %v", err)
+		s.renderFSError(w, r, err)
+		return
+	}
+
+	log.Printf("[zip]打包目录 %s，共 %d 个文件", dirPath, len(items))
+	s.sendZip(w, r, base+".zip", items)
+}
+
+// archiveFilter 返回打包整个目录时判断某个条目是否放进压缩包的函数：
+// 跳过被 .nfshide 隐藏的、扩展名不允许的(只对文件)，以及请求没有密码的受保护目录里的。
+// 同一目录的判断结果会缓存，不必每个文件都重新读取 .nfshide。granted 见 sendDirZip
+func (s *Server) archiveFilter(r *http.Request, granted string) func(p string, isDir bool) bool {
+	_, password, hasPassword := r.BasicAuth()
+	skipDir := map[string]bool{}
+	patterns := map[string][]string{}
+	return func(p string, isDir bool) bool {
+		dir, name := filepath.Dir(p), filepath.Base(p)
+		skip, seen := skipDir[dir]
+		if !seen {
+			hash, authDir := s.requiredAuth(dir)
+			skip = s.pathHidden(dir) || hash != "" && authDir != granted && !(hasPassword && s.passwords.check(hash, password))
+			skipDir[dir] = skip
+			patterns[dir] = readHideFile(dir)
+		}
+		return !skip && !matchHidden(patterns[dir], name) && (isDir || s.extAllowed(name))
+	}
+}
+
+// tarItem 是要打包进 tar 的一个条目，可以是文件、文件夹或符号链接
+type tarItem struct {
+	fullPath string
+	name     string // tar 内的路径，"/"分隔
+	info     fs.FileInfo
+	link     string // 符号链接的目标
+}
+
+// sendDirTarGz 把整个目录打包为 tar.gz 下载，如 /photos/?download=tar.gz。
+// 和 zip 不同，保留文件权限、文件夹条目和符号链接本身(指向共享目录以外的链接不打包)，
+// 适合在 Linux 上解压。跳过的内容与 zip 相同
+func (s *Server) sendDirTarGz(w http.ResponseWriter, r *http.Request, dirPath string) {
+	base := filepath.Base(dirPath)
+	include := s.archiveFilter(r, "")
+
+	rootInfo, err := os.Stat(dirPath)
+	if err != nil {
+		s.renderFSError(w, r, err)
+		return
+	}
+	items := []tarItem{{fullPath: dirPath, name: base + "/", info: rootInfo}}
+	// 和其他递归操作一样通过 walkLimited 的遍历(深度限制、防环)，只是也要目录条目，符号链接保留为链接
+	err = s.walkFrom(dirPath, 0, walkOptions{dirs: true, keepLinks: true}, func(p string, d fs.DirEntry) error {
+		if !include(p, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		item := tarItem{fullPath: p, name: path.Join(base, filepath.ToSlash(rel)), info: info}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if item.link, err = os.Readlink(p); err != nil {
+				return nil
+			}
+		case info.IsDir():
+			item.name += "/"
+		case !info.Mode().IsRegular():
+			return nil // 设备、管道等特殊文件
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		log.Printf("遍历目录失败: %v", err)
+		s.renderFSError(w, r, err)
+		return
+	}
+
+	log.Printf("[tar]打包目录 %s，共 %d 个条目", dirPath, len(items))
+	s.sendArchive(w, r, base+".tar.gz", "application/gzip", "tar:"+dirPath, func(out io.Writer) error {
+		return writeTarGz(out, items)
+	})
+}
+
+// writeTarGz 把条目逐个流式写入 tar 并用 gzip 压缩
+func writeTarGz(w io.Writer, items []tarItem) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, item := range items {
+		if err := addTarItem(tw, item); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addTarItem(tw *tar.Writer, item tarItem) error {
+	header, err := tar.FileInfoHeader(item.info, item.link)
+	if err != nil {
+		return err
+	}
+	header.Name = item.name
+	if !item.info.Mode().IsRegular() {
+		return tw.WriteHeader(header)
+	}
+
+	file, err := os.Open(item.fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// 按头里记录的大小写入，文件在打包期间被改写时也不会破坏 tar 结构
+	_, err = io.CopyN(tw, file, header.Size)
+	return err
+}
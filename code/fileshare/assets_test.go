@@ -0,0 +1,51 @@
+package fileshare
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAssets(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"docs/a.txt": "a"})
+	h := s.Handler()
+	want, err := assetsFS.ReadFile("assets/fonts.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := do(t, h, "GET", "/_nfs/assets/fonts.css", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != string(want) {
+		t.Fatalf("GET /_assets/fonts.css = %d, %d 字节", rec.Code, rec.Body.Len())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if rec := do(t, h, "GET", "/_nfs/assets/missing.css", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /_assets/missing.css = %d, 应为404", rec.Code)
+	}
+	if strings.Contains(string(want), "url(") {
+		t.Error("字体 CSS 引用了外部字体文件")
+	}
+
+	// 页面只引用本地资源，不请求外网 CDN
+	external := regexp.MustCompile(`(?:href|src)="(?:https?:)?//`)
+	for _, target := range []string{"/", "/docs/", "/docs/a.txt?preview=1", "/_nfs/search?q=a", "/missing"} {
+		body := do(t, h, "GET", target, nil, "Accept", "text/html").Body.String()
+		if !strings.Contains(body, `<link href="/_nfs/assets/fonts.css" rel="stylesheet">`) {
+			t.Errorf("%s: 没有引用 /_assets/fonts.css", target)
+		}
+		if m := external.FindString(body); m != "" || strings.Contains(body, "jsdelivr") || strings.Contains(body, "fonts.loli.net") {
+			t.Errorf("%s: 引用了外部资源 %q", target, m)
+		}
+	}
+
+	prefixed, _ := newTestServer(t, Config{BaseURL: "/files"}, nil)
+	ph := prefixed.Handler()
+	if body := do(t, ph, "GET", "/files/", nil).Body.String(); !strings.Contains(body, `href="/files/_nfs/assets/fonts.css"`) {
+		t.Error("-base-url 下没有引用 /files/_assets/fonts.css")
+	}
+	if rec := do(t, ph, "GET", "/files/_nfs/assets/fonts.css", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /files/_assets/fonts.css = %d", rec.Code)
+	}
+}
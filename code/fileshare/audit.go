@@ -0,0 +1,64 @@
+package fileshare
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditLog 是独立于请求日志的审计日志，每行一条：
+// 时间	客户端IP	用户名	操作	文件路径	字节数
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// openAuditLog 以追加方式打开审计日志，切割日志后由 Server.Reopen 重新打开
+func openAuditLog(path string) (*auditLog, error) {
+	a := &auditLog{path: path}
+	if err := a.reopen(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditLog) reopen() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	old := a.file
+	a.file = file
+	a.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Record 写入一条审计记录，未开启审计日志时什么也不做
+func (a *auditLog) Record(r *http.Request, op, path string, bytes int64) {
+	if a == nil {
+		return
+	}
+	user := requestUser(r)
+	if user == "" {
+		user = "-"
+	}
+	ip := "-"
+	if clientAddr := clientIP(r); clientAddr != nil {
+		ip = clientAddr.String()
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%d\n", time.Now().Format(time.RFC3339), ip, user, op, path, bytes)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.WriteString(line); err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	s, _ := newTestServer(t, Config{AuditLog: auditPath, User: "alice", Password: "secret", Writable: true}, map[string]string{
+		"a.txt":   "hello",
+		"old.txt": "x",
+	})
+	h := s.Handler()
+	send := func(method, target string) {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = "192.168.1.42:50000"
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s = %d", method, target, rec.Code)
+		}
+	}
+	before := time.Now().Add(-time.Second)
+	send("GET", "/a.txt")
+	send("HEAD", "/a.txt") // HEAD 不算下载
+	send("GET", "/")       // 目录列表不记录
+	send("DELETE", "/old.txt")
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := [][]string{
+		{"192.168.1.42", "alice", "download", filepath.Join(s.rootDir, "a.txt"), "5"},
+		{"192.168.1.42", "alice", "delete", filepath.Join(s.rootDir, "old.txt"), "0"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("审计日志有 %d 条记录，应为 %d:\n%s", len(lines), len(want), data)
+	}
+	for i, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			t.Errorf("第 %d 条记录格式不对: %q", i+1, line)
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil || at.Before(before) || at.After(time.Now().Add(time.Second)) {
+			t.Errorf("第 %d 条记录的时间 %q 无效: %v", i+1, fields[0], err)
+		}
+		if strings.Join(fields[1:], "\t") != strings.Join(want[i], "\t") {
+			t.Errorf("第 %d 条记录为 %q, 应为 %q", i+1, fields[1:], want[i])
+		}
+	}
+}
+
+// 审计日志以追加方式打开，重启后保留之前的记录
+func TestAuditLogAppends(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(auditPath, []byte("old entry\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestServer(t, Config{AuditLog: auditPath}, map[string]string{"a.txt": "a"})
+	if rec := do(t, s.Handler(), "GET", "/a.txt", nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET /a.txt = %d", rec.Code)
+	}
+	data, _ := os.ReadFile(auditPath)
+	if !strings.HasPrefix(string(data), "old entry\n") || strings.Count(string(data), "\n") != 2 {
+		t.Errorf("审计日志内容为 %q", data)
+	}
+	if !strings.Contains(string(data), "\t-\tdownload\t") {
+		t.Errorf("未登录时用户名应记录为 -: %q", data)
+	}
+}
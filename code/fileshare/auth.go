@@ -0,0 +1,395 @@
+package fileshare
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authFileName 是目录内的密码文件，内容为一行 bcrypt 哈希（可用 htpasswd -nbB 用户 密码 生成，
+// 带"用户:"前缀也可以，用户名不做检查）。该目录及其子目录都需要密码才能访问：
+// 没有全站登录时用 HTTP Basic 认证输入；开启全站登录后 Basic 认证已用于登录，改为在网页表单中输入，
+// 通过后保存在 cookie 里(见 checkDirAuth)
+const authFileName = ".nfsauth"
+
+type authEntry struct {
+	modTime time.Time
+	hash    string
+}
+
+// dirAuthHash 返回 dir 下 .nfsauth 中的密码哈希，没有该文件时返回空；
+// 文件存在但读取失败或内容为空时返回无法匹配的 "!"，宁可拒绝访问
+func (s *Server) dirAuthHash(dir string) string {
+	p := filepath.Join(dir, authFileName)
+	info, err := os.Stat(p)
+	if err != nil {
+		return ""
+	}
+	s.authMu.Lock()
+	cached, ok := s.authFiles[p]
+	s.authMu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash
+	}
+
+	hash := "!"
+	data, err := os.ReadFile(p)
+	if err != nil {
+		log.Printf("读取 %s 失败: %v", p, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, h, ok := strings.Cut(line, ":"); ok {
+			line = h
+		}
+		hash = line
+		break
+	}
+	s.authMu.Lock()
+	s.authFiles[p] = authEntry{modTime: info.ModTime(), hash: hash}
+	s.authMu.Unlock()
+	return hash
+}
+
+// requiredAuth 从 fullPath 所在目录向上查找最近的 .nfsauth，直到共享根目录为止
+func (s *Server) requiredAuth(fullPath string) (hash, dir string) {
+	dir = fullPath
+	if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+		dir = filepath.Dir(fullPath)
+	}
+	for {
+		if hash = s.dirAuthHash(dir); hash != "" {
+			return hash, dir
+		}
+		parent := filepath.Dir(dir)
+		if s.isShareRoot(dir) || parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// checkDirAuth 检查访问 fullPath 是否需要密码以及请求是否带了正确的密码，未通过时返回401。
+// 通过 /_nfs/unlock 输入过密码的浏览器带着该目录的 cookie；否则没有全站登录时检查 Basic 认证的密码，
+// 并要求浏览器弹出登录框。开启全站登录时一个请求只能带一组 Basic 认证，那是登录用的账号，
+// 不能再当作目录密码，也不能要求浏览器为目录另外登录(会替换掉登录账号)，这时显示输入目录密码的表单
+func (s *Server) checkDirAuth(w http.ResponseWriter, r *http.Request, fullPath string) bool {
+	hash, dir := s.requiredAuth(fullPath)
+	if hash == "" {
+		return true
+	}
+	if c, err := r.Cookie(dirAuthCookie(dir)); err == nil && hmac.Equal([]byte(c.Value), []byte(s.signDirAuth(dir, hash))) {
+		return true
+	}
+	if s.authBackend != nil {
+		s.renderDirAuth(w, r, dir, "该目录需要密码")
+		return false
+	}
+	_, password, ok := r.BasicAuth()
+	if ok && s.passwords.check(hash, password) {
+		return true
+	}
+	if ok {
+		log.Printf("[auth]%s 访问 %s 密码错误", r.RemoteAddr, dir)
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="Network File Share", charset="UTF-8"`)
+	s.renderDirAuth(w, r, dir, "该目录需要密码")
+	return false
+}
+
+// dirAuthCookie 返回保存 dir 目录密码凭据的 cookie 名称，每个受保护的目录一个
+func dirAuthCookie(dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return "nfs_dir_" + hex.EncodeToString(sum[:8])
+}
+
+// signDirAuth 是 dir 的密码凭据，对目录和 .nfsauth 里的哈希签名，更换密码后旧的 cookie 自动失效
+func (s *Server) signDirAuth(dir, hash string) string {
+	mac := hmac.New(sha256.New, []byte(s.shareSecret))
+	fmt.Fprintf(mac, "dirauth|%s|%s", dir, hash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// renderDirAuth 返回401，浏览器访问时页面上带输入目录密码的表单，提交到 /_nfs/unlock 后回到当前地址
+func (s *Server) renderDirAuth(w http.ResponseWriter, r *http.Request, dir, msg string) {
+	s.renderErrorPage(w, r, http.StatusUnauthorized, msg, s.relativePath(dir), r.URL.RequestURI())
+}
+
+// handleUnlock 校验表单提交的目录密码：POST /_nfs/unlock，path 为受保护的目录，next 为之后返回的地址。
+// 通过后设置该目录的 cookie，全站登录时同样需要先登录才能到达这里
+func (s *Server) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	fullPath, _, err := s.resolvePath(r.FormValue("path"))
+	if err != nil || fullPath == "" || s.pathHidden(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	hash, dir := s.requiredAuth(fullPath)
+	if hash == "" {
+		http.Redirect(w, r, s.basePath+next, http.StatusSeeOther)
+		return
+	}
+	if !s.passwords.check(hash, r.FormValue("password")) {
+		log.Printf("[auth]%s 访问 %s 密码错误", r.RemoteAddr, dir)
+		s.renderErrorPage(w, r, http.StatusUnauthorized, "密码错误", s.relativePath(dir), next)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     dirAuthCookie(dir),
+		Value:    s.signDirAuth(dir, hash),
+		Path:     s.basePath + "/",
+		HttpOnly: true,
+		Secure:   s.useTLS,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, s.basePath+next, http.StatusSeeOther)
+}
+
+// passwordCache 记录已验证通过的 哈希+密码 摘要，避免每个请求都算一次 bcrypt；零值可用
+type passwordCache struct {
+	mu sync.Mutex
+	ok map[string]bool
+}
+
+// check 校验密码，通过的结果按 哈希+密码 的摘要缓存
+func (c *passwordCache) check(hash, password string) bool {
+	sum := sha256.Sum256([]byte(hash + "\x00" + password))
+	key := string(sum[:])
+	c.mu.Lock()
+	ok := c.ok[key]
+	c.mu.Unlock()
+	if ok {
+		return true
+	}
+	if !passwordHashOK(hash, password) {
+		return false
+	}
+	c.mu.Lock()
+	if c.ok == nil || len(c.ok) >= 1024 {
+		c.ok = map[string]bool{}
+	}
+	c.ok[key] = true
+	c.mu.Unlock()
+	return true
+}
+
+// Authenticator 是全站登录(-auth)的认证后端，通过时返回用户名
+type Authenticator interface {
+	Authenticate(r *http.Request) (user string, ok bool)
+}
+
+// parseAuth 解析 -auth：htpasswd:文件路径 使用 htpasswd 文件，否则按 用户名:密码 处理
+func parseAuth(v string) (Authenticator, error) {
+	if p, ok := strings.CutPrefix(v, "htpasswd:"); ok {
+		a := &htpasswdAuth{path: p}
+		if _, err := a.load(); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	user, password, ok := strings.Cut(v, ":")
+	if !ok || user == "" || password == "" {
+		return nil, fmt.Errorf("格式应为 用户名:密码 或 htpasswd:文件路径")
+	}
+	return staticAuth{user: user, password: password}, nil
+}
+
+// staticAuth 是命令行指定的单个用户名和密码
+type staticAuth struct {
+	user, password string
+}
+
+func (a staticAuth) Authenticate(r *http.Request) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(a.user)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1
+	return user, userOK && passOK
+}
+
+// htpasswdAuth 从 htpasswd 文件读取用户，文件修改后下次请求时重新读取，不用重启
+type htpasswdAuth struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	users   map[string]string // 用户名 -> 密码哈希
+
+	passwords passwordCache
+}
+
+func (a *htpasswdAuth) Authenticate(r *http.Request) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	users, err := a.load()
+	if err != nil {
+		log.Printf("读取 %s 失败: %v", a.path, err)
+		return "", false
+	}
+	hash, ok := users[user]
+	return user, ok && a.passwords.check(hash, password)
+}
+
+// load 返回当前的用户表，文件修改时间变化时重新解析
+func (a *htpasswdAuth) load() (map[string]string, error) {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.users != nil && a.modTime.Equal(info.ModTime()) {
+		return a.users, nil
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if user, hash, ok := strings.Cut(line, ":"); ok {
+			users[user] = hash
+		}
+	}
+	a.users, a.modTime = users, info.ModTime()
+	return users, nil
+}
+
+// authUserKey 是 context 中保存已登录用户名的键
+type authUserKey struct{}
+
+// requestUser 返回请求的用户名：优先使用 -auth 认证通过的用户，其次是 Basic 认证里带的用户名
+func requestUser(r *http.Request) string {
+	if user, ok := r.Context().Value(authUserKey{}).(string); ok {
+		return user
+	}
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
+// withAuth 要求所有请求通过 -auth 认证，并把用户名放进请求的 context 供审计日志使用；未配置时原样返回
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	if s.authBackend == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 容器的健康检查探针不会带密码，分享链接由签名授权
+		if r.URL.Path == healthPath || r.URL.Path == sharedPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := s.authBackend.Authenticate(r)
+		if !ok {
+			if user != "" {
+				log.Printf("[auth]%s 用户 %s 登录失败", r.RemoteAddr, user)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="Network File Share", charset="UTF-8"`)
+			s.renderError(w, r, http.StatusUnauthorized, "需要登录")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, user)))
+	})
+}
+
+// passwordHashOK 按哈希格式校验密码，支持 htpasswd 常见的 bcrypt($2y$)、apr1($apr1$) 和 {SHA}
+func passwordHashOK(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		parts := strings.Split(hash, "$")
+		return len(parts) == 4 && subtle.ConstantTimeCompare([]byte(apr1Crypt(password, parts[2])), []byte(hash)) == 1
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(hash[5:])) == 1
+	}
+	return false
+}
+
+// apr1Crypt 是 Apache 的 MD5 密码哈希(htpasswd -m)，算法同 FreeBSD 的 MD5-crypt，只是前缀为 $apr1$
+func apr1Crypt(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	ctx := md5.New()
+	ctx.Write([]byte(password + magic + salt))
+	for n := len(pw); n > 0; n -= 16 {
+		ctx.Write(alt[:min(n, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(final)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(pw)
+		}
+		final = h.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, idx := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[idx[0]])<<16|uint32(final[idx[1]])<<8|uint32(final[idx[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// htpasswd 文件中的 bcrypt 哈希使用 nfsauth_test.go 的 secretHash，apr1 由 openssl passwd -apr1 生成
+const testHtpasswd = `# 团队账号
+alice:` + secretHash + `
+bob:$apr1$saltsalt$s3yr9WRwv0Pzg71.DMtd..
+carol:{SHA}SAv9mAXCuLCIWvLrguJf85sCv4E=
+`
+
+func TestHtpasswdAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.htpasswd")
+	if err := os.WriteFile(path, []byte(testHtpasswd), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := parseAuth("htpasswd:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "中文密码", true}, // bcrypt
+		{"alice", "wrong", false},
+		{"bob", "p@ss", true}, // apr1
+		{"bob", "p@ss2", false},
+		{"carol", "p@ss", true}, // {SHA}
+		{"mallory", "中文密码", false},
+		{"mallory", "", false},
+		{"# 团队账号", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(tt.user, tt.password)
+		user, ok := a.Authenticate(req)
+		if ok != tt.want {
+			t.Errorf("%s/%s 认证结果为 %v, 应为 %v", tt.user, tt.password, ok, tt.want)
+		}
+		if user != tt.user {
+			t.Errorf("%s 认证返回的用户名为 %q", tt.user, user)
+		}
+	}
+	if _, ok := a.Authenticate(httptest.NewRequest("GET", "/", nil)); ok {
+		t.Error("不带凭据的请求不应通过认证")
+	}
+
+	if _, err := parseAuth("htpasswd:" + filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("htpasswd 文件不存在时应报错")
+	}
+}
+
+// 通过 -auth htpasswd:文件 登录后，审计日志记录的是认证通过的用户名
+func TestHtpasswdAuthServer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.htpasswd")
+	if err := os.WriteFile(path, []byte(testHtpasswd), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(dir, "audit.log")
+	s, _ := newTestServer(t, Config{Auth: "htpasswd:" + path, AuditLog: auditPath}, map[string]string{"a.txt": "hello"})
+	h := s.Handler()
+
+	get := func(user, password string) int {
+		req := httptest.NewRequest("GET", "/a.txt", nil)
+		req.SetBasicAuth(user, password)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := do(t, h, "GET", "/a.txt", nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("未登录 = %d, 应为401", code)
+	}
+	if code := get("mallory", "中文密码"); code != http.StatusUnauthorized {
+		t.Errorf("未知用户 = %d, 应为401", code)
+	}
+	if code := get("alice", "中文密码"); code != http.StatusOK {
+		t.Errorf("alice 登录 = %d, 应为200", code)
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\talice\tdownload\t") || strings.Contains(string(data), "mallory") {
+		t.Errorf("审计日志应只记录 alice 的下载:\n%s", data)
+	}
+}
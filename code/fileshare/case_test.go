@@ -0,0 +1,68 @@
+package fileshare
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// forceCaseInsensitive 让 exactCase 把 root 当作不区分大小写的文件系统处理，
+// 在区分大小写的系统上也能测试逐段核对的逻辑
+func forceCaseInsensitive(s *Server, root string) {
+	s.caseInsensitive.Store(root, true)
+}
+
+func TestExactCase(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"Docs/Report.pdf": "report", "Docs/sub/a.txt": "a"})
+	root := s.rootDir // 已解析符号链接，与 exactCase 使用的路径一致
+	forceCaseInsensitive(s, root)
+
+	for rel, want := range map[string]bool{
+		"Docs":            true,
+		"Docs/Report.pdf": true,
+		"Docs/sub/a.txt":  true,
+		"docs/Report.pdf": false,
+		"Docs/report.pdf": false,
+		"Docs/REPORT.PDF": false,
+		"Docs/Sub/a.txt":  false,
+		"Docs/sub/A.txt":  false,
+	} {
+		if got := s.exactCase(filepath.Join(root, filepath.FromSlash(rel))); got != want {
+			t.Errorf("exactCase(%s) = %v, 应为 %v", rel, got, want)
+		}
+	}
+
+	h := s.Handler()
+	if rec := do(t, h, "GET", "/Docs/Report.pdf", nil); rec.Code != http.StatusOK || rec.Body.String() != "report" {
+		t.Errorf("GET /Docs/Report.pdf = %d %q", rec.Code, rec.Body.String())
+	}
+	for _, target := range []string{"/docs/Report.pdf", "/Docs/report.pdf", "/DOCS/", "/Docs/SUB/a.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, 大小写不一致应为404", target, rec.Code)
+		}
+	}
+}
+
+// 只有大小写不同的两个文件各自通过自己的 URL 访问
+func TestExactCaseDistinctFiles(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"Report.pdf": "upper"})
+	if err := os.WriteFile(filepath.Join(root, "report.pdf"), []byte("lower"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 2 {
+		t.Skip("文件系统不区分大小写，不能创建只有大小写不同的两个文件")
+	}
+	if s.isCaseInsensitive(root) {
+		t.Error("区分大小写的文件系统被判断为不区分")
+	}
+	h := s.Handler()
+	for target, want := range map[string]string{"/Report.pdf": "upper", "/report.pdf": "lower"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q, 应为 %q", target, rec.Code, rec.Body.String(), want)
+		}
+	}
+	if rec := do(t, h, "GET", "/REPORT.pdf", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /REPORT.pdf = %d, 应为404", rec.Code)
+	}
+}
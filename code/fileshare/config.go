@@ -0,0 +1,236 @@
+package fileshare
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configAliases 是含义相同的选项名，命令行设置了其中一个时配置文件里的另一个也不再生效。
+// readonly 与 writable 设置的是同一个字段，值相反
+var configAliases = map[string]string{"directory": "dir", "readonly": "writable"}
+
+// configEntry 是配置文件中的一个选项，line 是它所在的行号，用于报错
+type configEntry struct {
+	key    string
+	values []string
+	line   int
+}
+
+// LoadConfigFile 读取 YAML 或 TOML 格式的配置文件，把其中的选项写入 cfg。选项名与命令行参数相同，
+// 即 Config 字段的 config 标签。skip 是命令行已经设置过的参数名，这些选项保持命令行的值。
+// 未知的选项和无法解析的值返回带行号的错误
+func LoadConfigFile(path string, cfg *Config, skip map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries, err := parseConfigFile(string(data))
+	if err != nil {
+		return err
+	}
+
+	skipKeys := map[string]bool{}
+	for name := range skip {
+		skipKeys[canonicalConfigKey(name)] = true
+	}
+	fields := configFields()
+	for _, e := range entries {
+		key := canonicalConfigKey(e.key)
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("第 %d 行: 未知的选项: %s", e.line, e.key)
+		}
+		if skipKeys[key] {
+			continue
+		}
+		if err := setConfigField(reflect.ValueOf(cfg).Elem().FieldByIndex(field.Index), field, e.values, e.key == "readonly"); err != nil {
+			return fmt.Errorf("第 %d 行: %s: %v", e.line, e.key, err)
+		}
+	}
+	return nil
+}
+
+// canonicalConfigKey 把别名换成 Config 标签中的选项名
+func canonicalConfigKey(name string) string {
+	if key, ok := configAliases[name]; ok {
+		return key
+	}
+	return name
+}
+
+// configFields 返回 选项名 → Config 字段
+func configFields() map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("config"), ",")
+		if name != "" && name != "-" {
+			fields[name] = f
+		}
+	}
+	return fields
+}
+
+// setConfigField 按字段类型解析 values 并写入 v。列表字段用配置文件里的值整体替换，
+// 带 split 标签的列表(如 allow-ext)每个值还可以用逗号分隔多项；其他字段只能有一个值。
+// invert 用于 readonly，布尔值取反后写入 writable
+func setConfigField(v reflect.Value, field reflect.StructField, values []string, invert bool) error {
+	if v.Kind() == reflect.Slice {
+		_, opts, _ := strings.Cut(field.Tag.Get("config"), ",")
+		var list []string
+		for _, value := range values {
+			if opts == "split" {
+				list = append(list, strings.Split(value, ",")...)
+			} else {
+				list = append(list, value)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+
+	if len(values) != 1 {
+		return fmt.Errorf("只能有一个值，实际有 %d 个", len(values))
+	}
+	value := values[0]
+	switch v.Addr().Interface().(type) {
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case *ByteSize:
+		return v.Addr().Interface().(*ByteSize).Set(value)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("应为 true 或 false: %s", value)
+		}
+		v.SetBool(b != invert)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("应为整数: %s", value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("应为数字: %s", value)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+// parseConfigFile 解析配置文件。只支持扁平的键值，兼容两种写法：
+//
+//	TOML: port = 8080          dir = ["photos=/data/photos", "docs=/data/docs"]
+//	YAML: port: 8080           dir:
+//	                             - photos=/data/photos
+//
+// 同一个选项(包括别名)出现多次时值依次追加
+func parseConfigFile(data string) ([]configEntry, error) {
+	var entries []configEntry
+	index := map[string]int{}
+	add := func(key string, line int, values ...string) {
+		i, ok := index[canonicalConfigKey(key)]
+		if !ok {
+			i = len(entries)
+			index[canonicalConfigKey(key)] = i
+			entries = append(entries, configEntry{key: key, line: line})
+		}
+		entries[i].values = append(entries[i].values, values...)
+	}
+
+	listKey := ""
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// YAML 列表项，属于上一个没有值的键
+		if item, ok := strings.CutPrefix(line, "- "); ok {
+			if listKey == "" {
+				return nil, fmt.Errorf("第 %d 行: 列表项前缺少选项名", i+1)
+			}
+			add(listKey, i+1, unquoteConfigValue(item))
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			return nil, fmt.Errorf("第 %d 行: 应为 选项 = 值 或 选项: 值", i+1)
+		}
+		key := strings.Trim(strings.TrimSpace(line[:sep]), `"'`)
+		value := strings.TrimSpace(line[sep+1:])
+		listKey = ""
+
+		switch {
+		case value == "":
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, unquoteConfigValue(item))
+				}
+			}
+			add(key, i+1, items...)
+		default:
+			add(key, i+1, unquoteConfigValue(value))
+		}
+	}
+	return entries, nil
+}
+
+// unquoteConfigValue 去掉值两边的引号和行尾注释
+func unquoteConfigValue(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') {
+		if end := strings.IndexByte(v[1:], v[0]); end >= 0 {
+			return v[1 : end+1]
+		}
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v
+}
+
+// parseByteSize 解析带单位的字节数，如 4096、64k、1m、1g，单位不区分大小写
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	num := strings.TrimRight(strings.TrimSuffix(s, "b"), "kmg")
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小: %s", s)
+	}
+	switch strings.TrimSuffix(s, "b")[len(num):] {
+	case "":
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	case "g":
+		n <<= 30
+	default:
+		return 0, fmt.Errorf("无效的大小: %s", s)
+	}
+	return n, nil
+}
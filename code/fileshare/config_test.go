@@ -0,0 +1,137 @@
+package fileshare
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileTOML(t *testing.T) {
+	path := writeConfig(t, "share.toml", `
+# 共享两个目录
+dir = ["photos=/data/photos", "docs=/data/docs"]
+port = 9000
+readonly = false
+auth = "alice:secret"   # 行尾注释
+cert = "/etc/share/cert.pem"
+key = '/etc/share/key.pem'
+max-rate = 2m
+rate-per-ip = 2.5
+idle-timeout = "90s"
+max-conns = 16
+allow-ext = "jpg,png"
+mime = ["log=text/plain", "glb=model/gltf-binary"]
+`)
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(path, &cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultConfig()
+	want.Dirs = []string{"photos=/data/photos", "docs=/data/docs"}
+	want.Port = "9000"
+	want.Writable = true
+	want.Auth = "alice:secret"
+	want.Cert = "/etc/share/cert.pem"
+	want.Key = "/etc/share/key.pem"
+	want.MaxRate = 2 << 20
+	want.RatePerIP = 2.5
+	want.IdleTimeout = 90 * time.Second
+	want.MaxConns = 16
+	want.AllowExt = []string{"jpg", "png"}
+	want.MIME = []string{"log=text/plain", "glb=model/gltf-binary"}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("配置不符:\n got %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigFileYAML(t *testing.T) {
+	path := writeConfig(t, "share.yaml", `
+directory:
+  - photos=/data/photos
+  - "docs=/data/docs"
+port: 8443
+tls: true
+writable: true
+log-max-size: 1m
+shutdown-timeout: 5s
+`)
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(path, &cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Dirs, []string{"photos=/data/photos", "docs=/data/docs"}) {
+		t.Errorf("Dirs = %q", cfg.Dirs)
+	}
+	if cfg.Port != "8443" || !cfg.TLS || !cfg.Writable || cfg.LogMaxSize != 1<<20 || cfg.ShutdownTimeout != 5*time.Second {
+		t.Errorf("配置不符: %+v", cfg)
+	}
+}
+
+// 命令行设置过的参数(包括别名)优先于配置文件，其他选项仍然取配置文件的值
+func TestLoadConfigFileCommandLineWins(t *testing.T) {
+	path := writeConfig(t, "share.toml", `
+dir = "/from/file"
+port = 9000
+readonly = true
+gzip = true
+`)
+	cfg := DefaultConfig()
+	cfg.Dirs = []string{"/from/flag"}
+	cfg.Port = "7000"
+	cfg.Writable = true
+	skip := map[string]bool{"directory": true, "port": true, "writable": true}
+	if err := LoadConfigFile(path, &cfg, skip); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Dirs, []string{"/from/flag"}) || cfg.Port != "7000" || !cfg.Writable {
+		t.Errorf("命令行的值被配置文件覆盖: %+v", cfg)
+	}
+	if !cfg.Gzip {
+		t.Error("命令行没有设置的 gzip 应取配置文件的值")
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"port = 1\nbind = 0.0.0.0\n", "第 2 行: 未知的选项: bind"},
+		{"config = other.toml\n", "未知的选项: config"},
+		{"max-conns = many\n", "第 1 行: max-conns"},
+		{"gzip = maybe\n", "gzip"},
+		{"idle-timeout = 10\n", "idle-timeout"},
+		{"max-rate = 2x\n", "max-rate"},
+		{"port = [1, 2]\n", "只能有一个值"},
+		{"- orphan\n", "第 1 行: 列表项前缺少选项名"},
+		{"\njust text\n", "第 2 行"},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		err := LoadConfigFile(writeConfig(t, "bad.toml", tt.content), &cfg, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: 错误为 %v，应包含 %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+// 每个 Config 字段(ConfirmSensitive 除外)都要有配置文件中的选项名
+func TestConfigFieldsAllTagged(t *testing.T) {
+	typ := reflect.TypeOf(Config{})
+	if n := len(configFields()); n != typ.NumField()-1 {
+		t.Errorf("有 %d 个选项，Config 有 %d 个字段", n, typ.NumField())
+	}
+}
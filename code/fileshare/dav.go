@@ -0,0 +1,457 @@
+package fileshare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// davPrefix 是 WebDAV 的挂载路径，网页浏览仍然使用 "/"
+const davPrefix = "/_nfs/dav/"
+
+// newDAVHandler 创建 WebDAV 处理器，协议本身(PROPFIND、PROPPATCH、COPY、MOVE、LOCK 等)由
+// x/net/webdav 实现，文件访问经过 davFS，锁保存在内存中
+func (s *Server) newDAVHandler() *webdav.Handler {
+	return &webdav.Handler{
+		// handleDAV 收到的路径已经去掉了 -base-url，交给 webdav 前再加回去，返回的 href 和 Destination 才对得上
+		Prefix:     s.basePath + strings.TrimSuffix(davPrefix, "/"),
+		FileSystem: davFS{s},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("[dav]%s %s 失败: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+}
+
+// handleDAV 在 webdav.Handler 之前做和网页浏览相同的检查：路径解析、隐藏文件、扩展名和目录密码，
+// 只读模式下的写操作已由 withReadOnly 拒绝。GET/HEAD 仍走 sendFile，下载同样受限速、配额和统计约束
+func (s *Server) handleDAV(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[dav]%s %s", r.Method, r.URL.Path)
+
+	if r.Method == http.MethodOptions && !s.cfg.Writable {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD")
+		w.Header().Set("DAV", "1")
+		w.Header().Set("MS-Author-Via", "DAV")
+		return
+	}
+	fullPath, relPath, ok := s.davResolve(w, r, r.URL.Path)
+	if !ok {
+		return
+	}
+
+	var dst string
+	switch r.Method {
+	case "PROPFIND":
+		// 不带 Depth 按 infinity 处理，不支持，以免一次请求遍历整棵目录树
+		if depth := r.Header.Get("Depth"); depth == "" || depth == "infinity" {
+			http.Error(w, "不支持 Depth: infinity", http.StatusForbidden)
+			return
+		}
+	case http.MethodGet, http.MethodHead:
+		s.davGet(w, r, fullPath, relPath)
+		return
+	case http.MethodPut, "MKCOL":
+		if fullPath == "" || s.isShareRoot(fullPath) {
+			http.Error(w, "禁止访问", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodPut {
+			if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+				http.Error(w, "目标是文件夹", http.StatusMethodNotAllowed)
+				return
+			}
+			if !s.extAllowed(filepath.Base(fullPath)) {
+				http.Error(w, "不允许的扩展名", http.StatusForbidden)
+				return
+			}
+			// 服务器的 ReadTimeout 只有 10 秒，每读到数据就延长读取期限，大文件才能传完
+			noTimeout(w)
+			r.Body = io.NopCloser(&deadlineReader{r: r.Body, rc: http.NewResponseController(w)})
+		}
+	case http.MethodDelete:
+		if fullPath == "" || s.isShareRoot(fullPath) {
+			http.Error(w, "禁止访问", http.StatusForbidden)
+			return
+		}
+		// WebDAV 删除集合时要求连同内容一起删除，先确认里面没有网页上看不到或需要另外密码的内容
+		if err := s.removable(fullPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("[dav]拒绝删除 %s: %v", fullPath, err)
+			http.Error(w, "包含隐藏、受保护或不允许的文件，不能删除", http.StatusForbidden)
+			return
+		}
+	case "COPY", "MOVE":
+		if dst, ok = s.davDestination(w, r, fullPath); !ok {
+			return
+		}
+	}
+
+	rec := &statusRecorder{ResponseWriter: w}
+	dr := *r
+	u := *r.URL
+	u.Path, u.RawPath = s.basePath+r.URL.Path, ""
+	dr.URL = &u
+	s.dav.ServeHTTP(rec, &dr)
+	if rec.status >= 300 {
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var n int64
+		if info, err := os.Stat(fullPath); err == nil {
+			n = info.Size()
+		}
+		log.Printf("[upload]%s %d 字节", fullPath, n)
+		s.audit.Record(r, "upload", fullPath, n)
+	case http.MethodDelete:
+		log.Printf("[delete]%s", fullPath)
+		s.audit.Record(r, "delete", fullPath, 0)
+	case "MKCOL":
+		log.Printf("[mkdir]%s", fullPath)
+	case "COPY", "MOVE":
+		log.Printf("[%s]%s → %s", strings.ToLower(r.Method), fullPath, dst)
+		s.audit.Record(r, strings.ToLower(r.Method), fullPath+" → "+dst, 0)
+	}
+}
+
+// davResolve 把 /_nfs/dav/ 下的地址解析为共享目录中的路径，多目录模式的顶层返回空的 fullPath。
+// 不存在的挂载返回404，越界返回403，隐藏文件返回404，扩展名不允许的文件返回403，
+// 需要目录密码而没有通过时返回401；未通过时已写好响应，返回 ok 为 false
+func (s *Server) davResolve(w http.ResponseWriter, r *http.Request, urlPath string) (fullPath, relPath string, ok bool) {
+	fullPath, relPath, err := s.resolvePath(strings.TrimPrefix(urlPath, strings.TrimSuffix(davPrefix, "/")))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "文件未找到", http.StatusNotFound)
+		return "", "", false
+	} else if err != nil {
+		log.Printf("非法路径: %v", err)
+		http.Error(w, "禁止访问", http.StatusForbidden)
+		return "", "", false
+	}
+	if fullPath == "" {
+		return "", relPath, true
+	}
+	if s.pathHidden(fullPath) {
+		http.Error(w, "文件未找到", http.StatusNotFound)
+		return "", "", false
+	}
+	if info, err := os.Stat(fullPath); err == nil && !info.IsDir() && !s.extAllowed(info.Name()) {
+		http.Error(w, "禁止访问", http.StatusForbidden)
+		return "", "", false
+	}
+	if !s.checkDirAuth(w, r, fullPath) {
+		return "", "", false
+	}
+	return fullPath, relPath, true
+}
+
+// davDestination 检查 COPY、MOVE 的 Destination 头(完整 URL 或绝对路径)，规则与请求路径相同；
+// 另外不能移动共享目录本身，不能复制或移动到自身之下，复制文件夹时里面不能有网页上看不到的内容
+func (s *Server) davDestination(w http.ResponseWriter, r *http.Request, src string) (string, bool) {
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	prefix := s.basePath + davPrefix
+	if err != nil || !strings.HasPrefix(dest.Path, prefix) {
+		http.Error(w, "Destination 无效", http.StatusBadRequest)
+		return "", false
+	}
+	dst, _, ok := s.davResolve(w, r, strings.TrimPrefix(dest.Path, s.basePath))
+	if !ok {
+		return "", false
+	}
+	if src == "" || dst == "" || s.isShareRoot(dst) || (r.Method == "MOVE" && s.isShareRoot(src)) || withinDir(src, dst) {
+		log.Printf("非法的%s目标: %q", r.Method, dest.Path)
+		http.Error(w, "禁止复制或移动到该位置", http.StatusForbidden)
+		return "", false
+	}
+	if r.Method == "COPY" {
+		if err := s.removable(src); err != nil && !os.IsNotExist(err) {
+			log.Printf("[dav]拒绝复制 %s: %v", src, err)
+			http.Error(w, "包含隐藏、受保护或不允许的文件，不能复制", http.StatusForbidden)
+			return "", false
+		}
+	}
+	return dst, true
+}
+
+// davGet 下载文件，文件夹交给网页界面显示
+func (s *Server) davGet(w http.ResponseWriter, r *http.Request, fullPath, relPath string) {
+	if fullPath == "" {
+		http.Redirect(w, r, s.siteURL(""), http.StatusFound)
+		return
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		s.renderFSError(w, r, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		s.renderFSError(w, r, err)
+		return
+	}
+	if info.IsDir() {
+		s.redirectToDir(w, r, relPath)
+		return
+	}
+	s.sendFile(w, r, file, info.Name())
+}
+
+// davFS 是交给 webdav.Handler 的文件系统：路径先按网页浏览的规则解析(越界、符号链接、多目录挂载)，
+// 再交给所属共享根目录的 webdav.Dir。隐藏文件、.nfsauth 和扩展名不允许的文件既不能打开，
+// 也不出现在目录列表中；COPY、MOVE 逐项经过这里，同样受这些规则约束
+type davFS struct{ s *Server }
+
+// resolve 返回 name 所属共享根目录的 webdav.Dir 和在其中的路径，多目录模式的虚拟顶层 fullPath 为空
+func (d davFS) resolve(name string) (dir webdav.Dir, sub, fullPath string, err error) {
+	fullPath, _, err = d.s.resolvePath(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", "", err
+	} else if err != nil {
+		return "", "", "", fmt.Errorf("%w: %v", os.ErrPermission, err)
+	}
+	if fullPath == "" {
+		return "", "", "", nil
+	}
+	if d.s.pathHidden(fullPath) {
+		return "", "", "", os.ErrNotExist
+	}
+	root := d.s.shareRootOf(fullPath)
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil {
+		return "", "", "", err
+	}
+	return webdav.Dir(root), "/" + filepath.ToSlash(rel), fullPath, nil
+}
+
+func (d davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dir, sub, fullPath, err := d.resolve(name)
+	if err != nil {
+		return err
+	}
+	if fullPath == "" {
+		return os.ErrExist
+	}
+	return dir.Mkdir(ctx, sub, perm)
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	dir, sub, fullPath, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0
+	if fullPath == "" {
+		if write {
+			return nil, os.ErrPermission
+		}
+		return mountsDir{d.s}, nil
+	}
+	info, err := os.Stat(fullPath)
+	if (err == nil && !info.IsDir() || err != nil && write) && !d.s.extAllowed(filepath.Base(fullPath)) {
+		return nil, os.ErrPermission
+	}
+	f, err := dir.OpenFile(ctx, sub, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return davFile{File: f, s: d.s, fullPath: fullPath}, nil
+}
+
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	dir, sub, fullPath, err := d.resolve(name)
+	if err != nil {
+		return err
+	}
+	if fullPath == "" || d.s.isShareRoot(fullPath) {
+		return os.ErrPermission
+	}
+	// MOVE、COPY 覆盖目标时也会先删除，规则与 DELETE 相同
+	if err := d.s.removable(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", os.ErrPermission, err)
+	}
+	return dir.RemoveAll(ctx, sub)
+}
+
+func (d davFS) Rename(ctx context.Context, oldName, newName string) error {
+	dir, oldSub, src, err := d.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newDir, newSub, dst, err := d.resolve(newName)
+	if err != nil {
+		return err
+	}
+	// 各个挂载是不同的 webdav.Dir，不能跨挂载改名
+	if src == "" || dst == "" || dir != newDir {
+		return os.ErrPermission
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	// 与网页的 /move 相同，原文件和新名称的扩展名都要允许
+	if !info.IsDir() && (!d.s.extAllowed(filepath.Base(src)) || !d.s.extAllowed(filepath.Base(dst))) {
+		return os.ErrPermission
+	}
+	return dir.Rename(ctx, oldSub, newSub)
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	dir, sub, fullPath, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if fullPath == "" {
+		return mountsInfo{d.s.startedAt}, nil
+	}
+	info, err := dir.Stat(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return info, nil
+	}
+	if !d.s.extAllowed(info.Name()) {
+		return nil, os.ErrPermission
+	}
+	return davInfo{FileInfo: info, s: d.s}, nil
+}
+
+// davFile 在目录列表中去掉隐藏文件、扩展名不允许的文件和指向共享目录以外的符号链接
+type davFile struct {
+	webdav.File
+	s        *Server
+	fullPath string
+}
+
+func (f davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	hidden := readHideFile(f.fullPath)
+	visible := infos[:0]
+	for _, info := range infos {
+		if matchHidden(hidden, info.Name()) {
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 && !f.s.linkConfined(filepath.Join(f.fullPath, info.Name())) {
+			continue
+		}
+		if !info.IsDir() && !f.s.extAllowed(info.Name()) {
+			continue
+		}
+		visible = append(visible, info)
+	}
+	return visible, err
+}
+
+// davInfo 让 PROPFIND 的 getcontenttype 使用 -mime 指定的类型，其余情况由 webdav 按扩展名和内容判断
+type davInfo struct {
+	fs.FileInfo
+	s *Server
+}
+
+func (i davInfo) ContentType(ctx context.Context) (string, error) {
+	if ctype, ok := i.s.mimeTypes[strings.ToLower(filepath.Ext(i.Name()))]; ok {
+		return ctype, nil
+	}
+	return "", webdav.ErrNotImplemented
+}
+
+// mountsDir 是多目录模式下的虚拟顶层目录，子项就是各个挂载，不能读写
+type mountsDir struct{ s *Server }
+
+func (mountsDir) Close() error                   { return nil }
+func (mountsDir) Read([]byte) (int, error)       { return 0, os.ErrInvalid }
+func (mountsDir) Write([]byte) (int, error)      { return 0, os.ErrPermission }
+func (mountsDir) Seek(int64, int) (int64, error) { return 0, os.ErrInvalid }
+func (d mountsDir) Stat() (fs.FileInfo, error)   { return mountsInfo{d.s.startedAt}, nil }
+func (d mountsDir) Readdir(count int) ([]fs.FileInfo, error) {
+	var infos []fs.FileInfo
+	for _, m := range d.s.mounts {
+		info, err := os.Stat(m.root)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, mountInfo{FileInfo: info, name: m.name})
+	}
+	return infos, nil
+}
+
+// mountInfo 以挂载名称代替共享目录本身的名称
+type mountInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i mountInfo) Name() string { return i.name }
+
+// mountsInfo 是虚拟顶层目录的属性，修改时间取服务启动时间
+type mountsInfo struct{ modTime time.Time }
+
+func (mountsInfo) Name() string         { return "/" }
+func (mountsInfo) Size() int64          { return 0 }
+func (mountsInfo) Mode() fs.FileMode    { return fs.ModeDir | 0555 }
+func (i mountsInfo) ModTime() time.Time { return i.modTime }
+func (mountsInfo) IsDir() bool          { return true }
+func (mountsInfo) Sys() any             { return nil }
+
+// removable 检查能否用 os.RemoveAll 整个删除 fullPath：文件的扩展名要允许；文件夹里不能有被 .nfshide 隐藏的
+// 或扩展名不允许的文件，也不能有另设了密码(.nfsauth)的子目录——这些在网页上看不到或需要另外的密码，
+// 不能随上级文件夹一起删掉。.nfshide、.nfsauth 本身随所在文件夹删除
+func (s *Server) removable(fullPath string) error {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if info.Mode()&fs.ModeSymlink == 0 && !s.extAllowed(info.Name()) {
+			return fmt.Errorf("不允许的扩展名: %s", info.Name())
+		}
+		return nil
+	}
+	_, rootAuth := s.requiredAuth(fullPath)
+	patterns := map[string][]string{}
+	return filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == fullPath {
+			return nil
+		}
+		dir, name := filepath.Dir(p), d.Name()
+		if name == hideFileName || name == authFileName {
+			return nil
+		}
+		if _, ok := patterns[dir]; !ok {
+			patterns[dir] = readHideFile(dir)
+		}
+		if matchHidden(patterns[dir], name) {
+			return fmt.Errorf("包含隐藏的 %s", p)
+		}
+		if d.IsDir() {
+			if _, authDir := s.requiredAuth(p); authDir != rootAuth {
+				return fmt.Errorf("子目录 %s 另设了密码", p)
+			}
+			return nil
+		}
+		// 符号链接只删除链接本身，不看它的扩展名
+		if d.Type()&fs.ModeSymlink == 0 && !s.extAllowed(name) {
+			return fmt.Errorf("包含不允许的扩展名: %s", p)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,246 @@
+package fileshare
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// propfindResult 解析 PROPFIND 返回的 207 Multi-Status
+type propfindResult struct {
+	Responses []struct {
+		Href          string    `xml:"DAV: href"`
+		Collection    *struct{} `xml:"DAV: propstat>prop>resourcetype>collection"`
+		ContentLength int64     `xml:"DAV: propstat>prop>getcontentlength"`
+	} `xml:"DAV: response"`
+}
+
+// propfind 返回 href → 大小，文件夹的大小为 -1
+func propfind(t *testing.T, h http.Handler, target, depth string) map[string]int64 {
+	t.Helper()
+	rec := do(t, h, "PROPFIND", target, nil, "Depth", depth)
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND %s = %d %s", target, rec.Code, rec.Body.String())
+	}
+	var result propfindResult
+	if err := xml.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("无法解析 PROPFIND 结果: %v", err)
+	}
+	entries := map[string]int64{}
+	for _, r := range result.Responses {
+		if r.Collection != nil {
+			entries[r.Href] = -1
+		} else {
+			entries[r.Href] = r.ContentLength
+		}
+	}
+	return entries
+}
+
+func TestDAVReadOnly(t *testing.T) {
+	s, root := newTestServer(t, Config{WebDAV: true}, map[string]string{
+		"hello.txt":               "你好",
+		"secret.txt":              "s",
+		hideFileName:              "secret.txt",
+		"my docs/a b.txt":         "abc",
+		"my docs/" + hideFileName: "a b.txt",
+	})
+	h := s.Handler()
+
+	rec := do(t, h, "OPTIONS", "/_nfs/dav/", nil)
+	if rec.Header().Get("DAV") != "1" || strings.Contains(rec.Header().Get("Allow"), "PUT") {
+		t.Errorf("只读模式 OPTIONS: DAV=%q Allow=%q", rec.Header().Get("DAV"), rec.Header().Get("Allow"))
+	}
+
+	got := propfind(t, h, "/_nfs/dav/", "1")
+	want := map[string]int64{"/_nfs/dav/": -1, "/_nfs/dav/hello.txt": 6, "/_nfs/dav/my%20docs/": -1}
+	if len(got) != len(want) {
+		t.Errorf("PROPFIND /dav/ = %v, 应为 %v", got, want)
+	}
+	for href, size := range want {
+		if got[href] != size {
+			t.Errorf("PROPFIND /dav/: %s 为 %d, 应为 %d", href, got[href], size)
+		}
+	}
+	if got := propfind(t, h, "/_nfs/dav/my%20docs/", "1"); len(got) != 1 {
+		t.Errorf("被隐藏的文件出现在 PROPFIND 中: %v", got)
+	}
+	if got := propfind(t, h, "/_nfs/dav/hello.txt", "0"); got["/_nfs/dav/hello.txt"] != 6 {
+		t.Errorf("PROPFIND 文件 = %v", got)
+	}
+	if rec := do(t, h, "PROPFIND", "/_nfs/dav/", nil, "Depth", "infinity"); rec.Code != http.StatusForbidden {
+		t.Errorf("Depth: infinity = %d, 应为403", rec.Code)
+	}
+
+	if rec := do(t, h, "GET", "/_nfs/dav/hello.txt", nil); rec.Code != http.StatusOK || rec.Body.String() != "你好" {
+		t.Errorf("GET /dav/hello.txt = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, "GET", "/_nfs/dav/secret.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET 隐藏文件 = %d, 应为404", rec.Code)
+	}
+
+	for _, method := range []string{"PUT", "DELETE", "MKCOL"} {
+		if rec := do(t, h, method, "/_nfs/dav/new.txt", strings.NewReader("x")); rec.Code != http.StatusForbidden {
+			t.Errorf("只读模式 %s = %d, 应为403", method, rec.Code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "new.txt")); err == nil {
+		t.Error("只读模式下创建了文件")
+	}
+}
+
+func TestDAVWrite(t *testing.T) {
+	s, root := newTestServer(t, Config{WebDAV: true, Writable: true}, map[string]string{"old.txt": "old"})
+	h := s.Handler()
+
+	if rec := do(t, h, "PUT", "/_nfs/dav/new.txt", strings.NewReader("first")); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT 新文件 = %d", rec.Code)
+	}
+	if rec := do(t, h, "PUT", "/_nfs/dav/new.txt", strings.NewReader("second")); rec.Code != http.StatusCreated {
+		t.Errorf("PUT 覆盖 = %d", rec.Code)
+	}
+	if rec := do(t, h, "GET", "/_nfs/dav/new.txt", nil); rec.Body.String() != "second" {
+		t.Errorf("PUT 后 GET = %q", rec.Body.String())
+	}
+	if got := propfind(t, h, "/_nfs/dav/", "1"); got["/_nfs/dav/new.txt"] != 6 {
+		t.Errorf("PUT 后 PROPFIND = %v", got)
+	}
+
+	if rec := do(t, h, "MKCOL", "/_nfs/dav/folder", nil); rec.Code != http.StatusCreated {
+		t.Errorf("MKCOL = %d", rec.Code)
+	}
+	if rec := do(t, h, "MKCOL", "/_nfs/dav/folder", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("重复 MKCOL = %d, 应为405", rec.Code)
+	}
+	if rec := do(t, h, "PUT", "/_nfs/dav/missing/x.txt", strings.NewReader("x")); rec.Code != http.StatusConflict {
+		t.Errorf("PUT 到不存在的文件夹 = %d, 应为409", rec.Code)
+	}
+
+	if rec := do(t, h, "COPY", "/_nfs/dav/old.txt", nil, "Destination", "http://example.com/_nfs/dav/folder/copy.txt"); rec.Code != http.StatusCreated {
+		t.Errorf("COPY = %d", rec.Code)
+	}
+	if rec := do(t, h, "MOVE", "/_nfs/dav/new.txt", nil, "Destination", "/_nfs/dav/folder/copy.txt"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("MOVE 到已存在的文件 = %d, 应为412", rec.Code)
+	}
+	if rec := do(t, h, "MOVE", "/_nfs/dav/new.txt", nil, "Destination", "/_nfs/dav/folder/copy.txt", "Overwrite", "T"); rec.Code != http.StatusNoContent {
+		t.Errorf("MOVE Overwrite: T = %d, 应为204", rec.Code)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "folder", "copy.txt")); err != nil || string(data) != "second" {
+		t.Errorf("MOVE 后的文件 %q, %v", data, err)
+	}
+	if rec := do(t, h, "MOVE", "/_nfs/dav/folder", nil, "Destination", "/_nfs/dav/folder/sub"); rec.Code != http.StatusForbidden {
+		t.Errorf("MOVE 到自身之下 = %d, 应为403", rec.Code)
+	}
+
+	if rec := do(t, h, "DELETE", "/_nfs/dav/folder", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "folder")); !os.IsNotExist(err) {
+		t.Error("DELETE 后文件夹仍然存在")
+	}
+	if rec := do(t, h, "DELETE", "/_nfs/dav/", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE 共享目录 = %d, 应为403", rec.Code)
+	}
+}
+
+func TestDAVWriteRules(t *testing.T) {
+	s, root := newTestServer(t, Config{WebDAV: true, Writable: true, DenyExt: []string{"exe"}}, map[string]string{
+		"a.txt":                "a",
+		"docs/b.txt":           "b",
+		"docs/secret.txt":      "s",
+		"docs/" + hideFileName: "secret.txt",
+	})
+	h := s.Handler()
+
+	for _, c := range []struct{ method, target, dest string }{
+		{"PUT", "/_nfs/dav/x.exe", ""},
+		{"PUT", "/_nfs/dav/" + authFileName, ""},
+		{"MOVE", "/_nfs/dav/a.txt", "/_nfs/dav/a.exe"},
+		{"MOVE", "/_nfs/dav/a.txt", "/_nfs/dav/" + hideFileName},
+		{"COPY", "/_nfs/dav/docs", "/_nfs/dav/copy"},
+		{"DELETE", "/_nfs/dav/docs", ""},
+		{"MOVE", "/_nfs/dav/", "/_nfs/dav/docs/root"},
+	} {
+		rec := do(t, h, c.method, c.target, strings.NewReader("x"), "Destination", c.dest)
+		if rec.Code < 400 {
+			t.Errorf("%s %s → %s = %d, 应拒绝", c.method, c.target, c.dest, rec.Code)
+		}
+	}
+	for _, name := range []string{"x.exe", authFileName, "a.exe", "copy"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); err == nil {
+			t.Errorf("%s 不应被创建", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "docs", "secret.txt")); err != nil {
+		t.Errorf("隐藏文件被删除: %v", err)
+	}
+
+	// PROPPATCH 由 webdav 处理，本地文件不保存自定义属性，返回207并逐项说明
+	body := `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:x"><D:set><D:prop><Z:color>red</Z:color></D:prop></D:set></D:propertyupdate>`
+	if rec := do(t, h, "PROPPATCH", "/_nfs/dav/a.txt", strings.NewReader(body)); rec.Code != http.StatusMultiStatus {
+		t.Errorf("PROPPATCH = %d", rec.Code)
+	}
+}
+
+func TestDAVLock(t *testing.T) {
+	s, root := newTestServer(t, Config{WebDAV: true, Writable: true}, map[string]string{"a.txt": "a"})
+	h := s.Handler()
+
+	lockBody := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+	rec := do(t, h, "LOCK", "/_nfs/dav/a.txt", strings.NewReader(lockBody), "Timeout", "Second-60")
+	token := rec.Header().Get("Lock-Token")
+	if rec.Code != http.StatusOK || token == "" {
+		t.Fatalf("LOCK = %d, Lock-Token %q", rec.Code, token)
+	}
+	if rec := do(t, h, "LOCK", "/_nfs/dav/a.txt", strings.NewReader(lockBody)); rec.Code != http.StatusLocked {
+		t.Errorf("重复 LOCK = %d, 应为423", rec.Code)
+	}
+	if rec := do(t, h, "PUT", "/_nfs/dav/a.txt", strings.NewReader("b")); rec.Code != http.StatusLocked {
+		t.Errorf("不带锁 PUT = %d, 应为423", rec.Code)
+	}
+	if rec := do(t, h, "PUT", "/_nfs/dav/a.txt", strings.NewReader("c"), "If", "("+token+")"); rec.Code != http.StatusCreated {
+		t.Errorf("带锁 PUT = %d", rec.Code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(data) != "c" {
+		t.Errorf("PUT 后的内容 %q", data)
+	}
+	if rec := do(t, h, "UNLOCK", "/_nfs/dav/a.txt", nil, "Lock-Token", token); rec.Code != http.StatusNoContent {
+		t.Errorf("UNLOCK = %d", rec.Code)
+	}
+	if rec := do(t, h, "DELETE", "/_nfs/dav/a.txt", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("解锁后 DELETE = %d", rec.Code)
+	}
+}
+
+func TestDAVMounts(t *testing.T) {
+	one, two := t.TempDir(), t.TempDir()
+	writeFiles(t, one, map[string]string{"a.txt": "a"})
+	writeFiles(t, two, map[string]string{"b.txt": "bb"})
+	s, err := New(Config{Dirs: []string{"one=" + one, "two=" + two}, WebDAV: true, Writable: true, BaseURL: "/files", Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+
+	got := propfind(t, h, "/files/_nfs/dav/", "1")
+	for _, href := range []string{"/files/_nfs/dav/", "/files/_nfs/dav/one/", "/files/_nfs/dav/two/"} {
+		if got[href] != -1 {
+			t.Errorf("PROPFIND 顶层 = %v, 缺少 %s", got, href)
+		}
+	}
+	if got := propfind(t, h, "/files/_nfs/dav/two/", "1"); got["/files/_nfs/dav/two/b.txt"] != 2 {
+		t.Errorf("PROPFIND /files/dav/two/ = %v", got)
+	}
+	if rec := do(t, h, "COPY", "/files/_nfs/dav/one/a.txt", nil, "Destination", "/files/_nfs/dav/two/a.txt"); rec.Code != http.StatusCreated {
+		t.Errorf("跨挂载 COPY = %d", rec.Code)
+	}
+	if rec := do(t, h, "MOVE", "/files/_nfs/dav/one/a.txt", nil, "Destination", "/files/_nfs/dav/two/c.txt"); rec.Code != http.StatusForbidden {
+		t.Errorf("跨挂载 MOVE = %d, 应为403", rec.Code)
+	}
+	if rec := do(t, h, "MKCOL", "/files/_nfs/dav/three", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("顶层 MKCOL = %d, 应为404", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package fileshare
+
+import (
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileOwner(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"a.txt": "a"})
+	info, err := os.Stat(filepath.Join(root, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	wantGroup := strconv.Itoa(os.Getegid())
+	if g, err := user.LookupGroupId(wantGroup); err == nil {
+		wantGroup = g.Name
+	}
+	if owner, group := s.fileOwner(info); owner != me.Username || group != wantGroup {
+		t.Errorf("fileOwner = %s:%s, 应为 %s:%s", owner, group, me.Username, wantGroup)
+	}
+
+	// 查不到名字的 ID 显示为数字
+	unknown := fakeInfo{sys: &syscall.Stat_t{Uid: 4000000001, Gid: 4000000002}}
+	if owner, group := s.fileOwner(unknown); owner != "4000000001" || group != "4000000002" {
+		t.Errorf("未知 ID: fileOwner = %s:%s", owner, group)
+	}
+	if owner, group := s.fileOwner(fakeInfo{}); owner != "" || group != "" {
+		t.Errorf("没有 Stat_t 时 fileOwner = %s:%s, 应为空", owner, group)
+	}
+}
+
+func TestListingDetails(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"docs/a.sh": "#!/bin/sh", "docs/b.txt": "b", "docs/sub/.keep": ""})
+	for name, mode := range map[string]os.FileMode{"docs/a.sh": 0750, "docs/b.txt": 0640, "docs/sub": 0700} {
+		if err := os.Chmod(filepath.Join(root, name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, _ := os.Stat(filepath.Join(root, "docs", "b.txt"))
+	owner, group := s.fileOwner(info)
+
+	h := s.Handler()
+	body := do(t, h, "GET", "/docs/?details=1", nil).Body.String()
+	for _, want := range []string{"-rwxr-x--- ", "-rw-r----- ", "drwx------ "} {
+		if !strings.Contains(body, `<span class="size">`+want+owner+":"+group+"</span>") {
+			t.Errorf("详细信息中没有 %q %s:%s", want, owner, group)
+		}
+	}
+	if body := do(t, h, "GET", "/docs/", nil).Body.String(); strings.Contains(body, "-rw-r-----") {
+		t.Error("没有 ?details=1 时显示了权限")
+	}
+}
+
+// fakeInfo 是 Sys() 可以任意指定的 fs.FileInfo
+type fakeInfo struct{ sys any }
+
+func (f fakeInfo) Name() string       { return "fake" }
+func (f fakeInfo) Size() int64        { return 0 }
+func (f fakeInfo) Mode() fs.FileMode  { return 0644 }
+func (f fakeInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeInfo) IsDir() bool        { return false }
+func (f fakeInfo) Sys() any           { return f.sys }
@@ -0,0 +1,444 @@
+package fileshare
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// contentDisposition 同时给出两种文件名：filename 是只含 ASCII 的兜底名，
+// 供老浏览器使用；filename* 按 RFC 5987 编码真实的 UTF-8 文件名
+func contentDisposition(dispType, name string) string {
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispType, asciiFilename(name), rfc5987Escape(name))
+}
+
+// asciiFilename 把非 ASCII 字符、引号、反斜杠、百分号和控制字符替换成下划线
+func asciiFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' || r == '%' {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// rfc5987Escape 按 RFC 5987 的 attr-char 规则做百分号编码
+func rfc5987Escape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// sendFile 直接使用调用方已打开的文件句柄输出，不再按路径重新打开，
+// 避免 Stat 之后文件被删除或替换造成的竞态；句柄由调用方负责关闭。
+// 条件请求(If-None-Match/If-Modified-Since 等，可能返回304)、断点续传(Range/If-Range)
+// 和 HEAD 交给 http.ServeContent 按 RFC 规定的先后顺序处理。
+// 带 ?inline=1 时让浏览器直接打开(图片、PDF、视频等)而不是下载
+func (s *Server) sendFile(w http.ResponseWriter, r *http.Request, file *os.File, fileName string) {
+	if r.URL.Query().Get("inline") != "1" {
+		s.sendFileAs(w, r, file, fileName, "attachment")
+		return
+	}
+	// 共享目录里的网页直接打开时放进沙箱，页面脚本不能以本站身份发请求(如带着登录信息删除文件)
+	if ctype := s.detectContentType(file); activeContent(ctype) {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.sendFileAs(w, r, file, fileName, "inline")
+}
+
+// activeContent 判断内容类型在浏览器里打开时能否执行脚本
+func activeContent(ctype string) bool {
+	mediaType, _, _ := mime.ParseMediaType(ctype)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "image/svg+xml" || mediaType == "text/xml" || mediaType == "application/xml"
+}
+
+// sendFileAs 同 sendFile，dispType 为 "inline" 时浏览器直接显示而不是下载
+func (s *Server) sendFileAs(w http.ResponseWriter, r *http.Request, file *os.File, fileName, dispType string) {
+	if !s.allowDownload(w, r) {
+		return
+	}
+	noTimeout(w) // 下载耗时取决于文件大小和网速，不受 -request-timeout 限制
+	w.Header().Set("Content-Disposition", contentDisposition(dispType, fileName))
+	w.Header().Set("Content-Type", s.detectContentType(file))
+	name := file.Name()
+	if pre, enc := s.openPrecompressed(w, r, file); pre != nil {
+		defer pre.Close()
+		w.Header().Set("Content-Encoding", enc)
+		file = pre
+	}
+	var modTime time.Time
+	if info, err := file.Stat(); err == nil {
+		modTime = info.ModTime()
+		w.Header().Set("ETag", fileETag(modTime, info.Size()))
+		if !checkRange(r, info.Size()) {
+			w.Header().Del("Content-Disposition")
+			w.Header().Del("Content-Encoding")
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size()))
+			http.Error(w, "请求的范围超出文件大小", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	dw := &downloadWriter{s: s, ResponseWriter: s.withQuota(w, r), ctx: r.Context(), tr: s.transfers.begin(s.transferName(name, fileName))}
+	http.ServeContent(dw, r, fileName, modTime, file)
+	s.transfers.end(dw.tr)
+
+	// HEAD 请求和304等没有响应体的情况不算下载
+	if dw.written == 0 && (r.Method == http.MethodHead || dw.status >= 300) {
+		return
+	}
+	// 客户端断开时写入也会出错，以 context 是否已取消来区分
+	if r.Context().Err() != nil {
+		log.Printf("[abort]客户端已断开，停止发送 %s (已发送 %d 字节)", name, dw.written)
+	}
+	s.audit.Record(r, "download", name, dw.written)
+}
+
+// transferName 是下载在 /_nfs/stats 中显示的名字；统计页面谁都能打开，受密码保护的目录中的文件不显示名字
+func (s *Server) transferName(fullPath, fileName string) string {
+	if hash, _ := s.requiredAuth(fullPath); hash != "" {
+		return "(受密码保护的文件)"
+	}
+	return fileName
+}
+
+// downloadWriter 包装下载的 ResponseWriter：http.ServeContent 通过 ReadFrom 输出文件内容，
+// 这里改用 copyWithIdleTimeout 发送，保留 -buffer-size、-idle-timeout 和传输统计
+type downloadWriter struct {
+	s *Server
+	http.ResponseWriter
+	ctx     context.Context
+	tr      *transfer
+	written int64
+	status  int
+}
+
+// WriteHeader 记录状态码；304、412、416 等不是文件内容的响应去掉 Content-Disposition，
+// 免得浏览器把它当成要保存的文件
+func (d *downloadWriter) WriteHeader(code int) {
+	d.status = code
+	if code >= 300 {
+		d.Header().Del("Content-Disposition")
+	}
+	// http.ServeContent 在写响应头之前已按 Range 设好 Content-Length，就是这次要发送的字节数
+	if n, err := strconv.ParseInt(d.Header().Get("Content-Length"), 10, 64); err == nil {
+		d.tr.size.Store(n)
+	}
+	d.ResponseWriter.WriteHeader(code)
+}
+
+// Write 记录这次下载已发送的字节数，供 /_nfs/stats 显示进度
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	n, err := d.ResponseWriter.Write(p)
+	d.tr.sent.Add(int64(n))
+	return n, err
+}
+
+func (d *downloadWriter) ReadFrom(src io.Reader) (int64, error) {
+	n, err := d.s.copyWithIdleTimeout(d.ctx, d, src)
+	d.written += n
+	if err != nil && d.ctx.Err() == nil {
+		log.Printf("文件传输失败: %v", err)
+	}
+	return n, err
+}
+
+// Unwrap 让 http.ResponseController 能找到底层连接，设置读写超时
+func (d *downloadWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// checkRange 在交给 http.ServeContent 之前检查 Range 头：格式无效(单位不是 bytes、不是数字、
+// 结束位置小于起始位置)时按 RFC 9110 忽略该头部，返回完整文件；格式正确但没有一段落在文件内
+// (如 bytes=99999999- 或 bytes=-0)时返回 false，由调用方回复416。
+// 带条件请求头时先由 ServeContent 判断条件(可能是304或412)，这里不提前回复416
+func checkRange(r *http.Request, size int64) bool {
+	header := r.Header.Get("Range")
+	if header == "" {
+		return true
+	}
+	// 只接受十进制数字，ParseInt 会接受的正负号在这里都算格式错误
+	parse := func(s string) (int64, bool) {
+		if s == "" || strings.Trim(s, "0123456789") != "" {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		return n, err == nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	valid, satisfiable := ok, false
+	parsed := false
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || !valid {
+			continue
+		}
+		first, last, found := strings.Cut(part, "-")
+		parsed = true
+		switch start, okStart := parse(first); {
+		case !found:
+			valid = false
+		case first == "": // bytes=-N：最后 N 个字节
+			n, okLast := parse(last)
+			valid = okLast
+			satisfiable = satisfiable || (okLast && n > 0 && size > 0)
+		case !okStart:
+			valid = false
+		case last == "": // bytes=N-：从 N 到文件末尾
+			satisfiable = satisfiable || start < size
+		default:
+			end, okLast := parse(last)
+			valid = okLast && end >= start
+			satisfiable = satisfiable || start < size
+		}
+	}
+	if !valid || !parsed {
+		r.Header.Del("Range")
+		return true
+	}
+	if satisfiable {
+		return true
+	}
+	for _, h := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range"} {
+		if r.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fileETag 由修改时间和大小生成强 ETag，文件内容被替换后会随之变化
+func fileETag(modTime time.Time, size int64) string {
+	return fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size)
+}
+
+// precompressedExts 是预压缩文件的后缀和对应的 Content-Encoding，按优先顺序排列
+var precompressedExts = []struct{ ext, enc string }{
+	{".br", "br"},
+	{".gz", "gzip"},
+}
+
+// openPrecompressed 在开启 -precompressed 时查找与 file 同目录的预压缩版本(foo.js.br、foo.js.gz)：
+// 只使用不早于原文件的版本，避免原文件更新后发出过期内容；客户端不支持该编码或没有开启时返回 nil。
+// 默认不开启：普通的文件共享中 report.pdf.gz 可能是用户自己的另一个文件，不是 report.pdf 的压缩版本
+func (s *Server) openPrecompressed(w http.ResponseWriter, r *http.Request, file *os.File) (*os.File, string) {
+	if !s.cfg.Precompressed {
+		return nil, ""
+	}
+	orig, err := file.Stat()
+	if err != nil {
+		return nil, ""
+	}
+	varied := false
+	for _, p := range precompressedExts {
+		// 压缩版本要和直接访问它时一样通过检查，否则隐藏、禁止或指向共享目录以外的文件会借原文件的地址被下载
+		name := file.Name() + p.ext
+		if s.pathHidden(name) || !s.extAllowed(filepath.Base(name)) || !s.linkConfined(name) {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(orig.ModTime()) {
+			continue
+		}
+		// 响应内容随 Accept-Encoding 变化，缓存需要区分
+		if !varied {
+			w.Header().Add("Vary", "Accept-Encoding")
+			varied = true
+		}
+		if !acceptsEncoding(r, p.enc) {
+			continue
+		}
+		if f, err := os.Open(name); err == nil {
+			return f, p.enc
+		}
+	}
+	return nil, ""
+}
+
+// acceptsEncoding 判断 Accept-Encoding 是否接受 enc，q=0 表示明确拒绝
+func acceptsEncoding(r *http.Request, enc string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), enc) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// copyWithIdleTimeout 分块发送数据，每发送一块就把写超时往后推 -idle-timeout：
+// 持续接收的客户端不会因为下载时间长被断开，停止接收的客户端则会超时。
+// 每块之间检查 ctx，客户端取消下载后立即停止读取文件
+func (s *Server) copyWithIdleTimeout(ctx context.Context, w http.ResponseWriter, src io.Reader) (int64, error) {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, s.bufferSize)
+	limit := s.downloadLimiter()
+	if limit != nil && len(buf) > throttleChunk {
+		buf = buf[:throttleChunk] // 限速时小块发送，速度更平稳
+	}
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			// 先等限速再设置写超时，等待的时间不算客户端空闲
+			if err := limit.wait(ctx, nr); err != nil {
+				return written, err
+			}
+			if s.cfg.IdleTimeout > 0 {
+				if err := rc.SetWriteDeadline(time.Now().Add(s.cfg.IdleTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+					return written, err
+				}
+			}
+			nw, werr := w.Write(buf[:nr])
+			written += int64(nw)
+			s.transfers.add(int64(nw))
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// throttleChunk 是限速时每次发送的最大字节数
+const throttleChunk = 16 << 10
+
+// tokenBucket 是令牌桶限速器：令牌按 rate 字节/秒补充，最多攒 1 秒的量。
+// 取令牌时允许欠账，欠多少就等多少时间，所以一次取的量可以超过桶的容量
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket 创建限速为 rate 字节/秒的令牌桶，rate<=0 时返回 nil(不限速)
+func newTokenBucket(rate int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait 取出 n 个令牌，不够时等到补足或 ctx 取消
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limiter 是一次下载要同时遵守的几个令牌桶，nil 表示不限速
+type limiter []*tokenBucket
+
+// downloadLimiter 返回新下载的限速器：全局的令牌桶加上这次下载单独的一个
+func (s *Server) downloadLimiter() limiter {
+	var l limiter
+	if s.globalRate != nil {
+		l = append(l, s.globalRate)
+	}
+	if b := newTokenBucket(int64(s.cfg.MaxRatePerConn)); b != nil {
+		l = append(l, b)
+	}
+	return l
+}
+
+func (l limiter) wait(ctx context.Context, n int) error {
+	for _, b := range l {
+		if err := b.wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detectContentType 依次使用 -mime 自定义类型、扩展名判断 MIME 类型，
+// 都无法判断时读取文件开头嗅探
+func (s *Server) detectContentType(file *os.File) string {
+	if ctype := s.mimeByName(file.Name()); ctype != "" {
+		return ctype
+	}
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("重置文件读取位置失败: %v", err)
+	}
+	return http.DetectContentType(buf[:n])
+}
+
+// mimeByName 按扩展名判断 MIME 类型，-mime 自定义的优先，无法判断时返回空
+func (s *Server) mimeByName(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ctype, ok := s.mimeTypes[ext]; ok {
+		return ctype
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// sendChecksum 流式计算文件的 SHA-256，避免把大文件整个读入内存
+func (s *Server) sendChecksum(w http.ResponseWriter, r *http.Request, file *os.File) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		log.Printf("计算校验值失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "文件访问错误")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, hex.EncodeToString(hash.Sum(nil)))
+}
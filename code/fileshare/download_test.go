@@ -0,0 +1,566 @@
+package fileshare
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecksumSHA256(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"abc.txt": "abc"})
+	rec := do(t, s.Handler(), "GET", "/abc.txt?checksum=sha256", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 %d", rec.Code)
+	}
+	// FIPS 180-2 附录 B.1 的测试向量
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("sha256 = %s, 应为 %s", got, want)
+	}
+}
+
+// 默认没有写超时：传输时间超过 -idle-timeout 很多倍的慢速下载只要一直在接收数据就能完成
+func TestSlowDownloadCompletes(t *testing.T) {
+	const size = 80 << 10
+	s, _ := newTestServer(t, Config{
+		MaxRatePerConn: 32 << 10, // 第一秒突发 32k，剩下的约 1.5 秒
+		IdleTimeout:    300 * time.Millisecond,
+	}, map[string]string{"big.bin": strings.Repeat("x", size)})
+	base := startServer(t, s)
+	if s.httpServer.WriteTimeout != 0 {
+		t.Fatalf("默认 WriteTimeout = %v，应为0", s.httpServer.WriteTimeout)
+	}
+
+	start := time.Now()
+	resp, err := http.Get(base + "/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("下载中断: %v", err)
+	}
+	if len(data) != size {
+		t.Fatalf("收到 %d 字节，应为 %d", len(data), size)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("下载用时 %v，没有被限速", elapsed)
+	}
+}
+
+func TestHeadSendsHeadersOnly(t *testing.T) {
+	const content = "0123456789abcdef"
+	s, _ := newTestServer(t, Config{}, map[string]string{"data.txt": content, "docs/a.txt": "a"})
+	h := s.Handler()
+
+	rec := do(t, h, "HEAD", "/data.txt", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HEAD /data.txt = %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Length"); got != "16" {
+		t.Errorf("Content-Length = %q, 应为 16", got)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("HEAD 返回了 %d 字节的正文", rec.Body.Len())
+	}
+
+	rec = do(t, h, "HEAD", "/docs/", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("HEAD /docs/ = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("目录的 HEAD 返回了 %d 字节的正文", rec.Body.Len())
+	}
+}
+
+func TestMIMEOverride(t *testing.T) {
+	files := map[string]string{"app.log": "\x00\x01binary-looking", "model.GLB": "glTF", "page.html": "<p>hi</p>", "data.json": "{}"}
+	s, _ := newTestServer(t, Config{MIME: []string{"log=text/plain; charset=utf-8", ".glb=model/gltf-binary", "HTML=text/plain"}}, files)
+	h := s.Handler()
+	for target, want := range map[string]string{
+		"/app.log":   "text/plain; charset=utf-8",
+		"/model.GLB": "model/gltf-binary",
+		"/page.html": "text/plain", // 覆盖标准库的 text/html
+		"/data.json": "application/json",
+	} {
+		if got := do(t, h, "GET", target, nil).Header().Get("Content-Type"); got != want {
+			t.Errorf("GET %s: Content-Type = %q, 应为 %q", target, got, want)
+		}
+	}
+
+	for _, bad := range []string{"log", "=text/plain", "log=", "log=not a type"} {
+		if _, err := New(Config{Dirs: []string{t.TempDir()}, MIME: []string{bad}}); err == nil {
+			t.Errorf("-mime %q 应返回错误", bad)
+		}
+	}
+}
+
+// 客户端停止读取超过 -idle-timeout 后，服务端的写入超时，传输被中止
+func TestStalledDownloadAborts(t *testing.T) {
+	const size = 32 << 20 // 远大于套接字缓冲区，客户端不读时服务端一定会阻塞在写入上
+	s, _ := newTestServer(t, Config{IdleTimeout: 200 * time.Millisecond}, map[string]string{"big.bin": strings.Repeat("x", size)})
+	base := startServer(t, s)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(base, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "GET /big.bin HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, 4<<10)
+	if _, err := io.ReadFull(conn, first); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(first), "HTTP/1.1 200") {
+		t.Fatalf("响应为 %q", first[:40])
+	}
+	if s.transfers.active.Load() != 1 {
+		t.Fatal("传输没有开始")
+	}
+
+	// 暂停读取，远超空闲时间；连接仍然打开，服务端应自行放弃
+	deadline := time.Now().Add(2 * time.Second)
+	for s.transfers.active.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("客户端停止读取后传输没有中止")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := s.transfers.total.Load(); sent >= size {
+		t.Errorf("已发送 %d 字节，传输应在完成前中止", sent)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name, ascii, encoded string
+	}{
+		{"report.pdf", "report.pdf", "report.pdf"},
+		{"my report.pdf", "my report.pdf", "my%20report.pdf"},
+		{`say "hi".txt`, "say _hi_.txt", "say%20%22hi%22.txt"},
+		{`a\b%20.txt`, "a_b_20.txt", "a%5Cb%2520.txt"},
+		{"报告 2024.docx", "__ 2024.docx", "%E6%8A%A5%E5%91%8A%202024.docx"},
+		{"café;x=1.txt", "caf_;x=1.txt", "caf%C3%A9%3Bx%3D1.txt"},
+	}
+	for _, tt := range tests {
+		got := contentDisposition("attachment", tt.name)
+		want := `attachment; filename="` + tt.ascii + `"; filename*=UTF-8''` + tt.encoded
+		if got != want {
+			t.Errorf("contentDisposition(%q) = %s, 应为 %s", tt.name, got, want)
+		}
+		// 支持 RFC 5987 的客户端应还原出原始文件名
+		disp, params, err := mime.ParseMediaType(got)
+		if err != nil || disp != "attachment" || params["filename"] != tt.name {
+			t.Errorf("%q: 解析结果 %s %q, %v", tt.name, disp, params["filename"], err)
+		}
+	}
+}
+
+func TestDownloadContentDisposition(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"docs/我的 报告.pdf": "%PDF"})
+	rec := do(t, s.Handler(), "GET", "/docs/"+url.PathEscape("我的 报告.pdf"), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET = %d", rec.Code)
+	}
+	_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	if err != nil || params["filename"] != "我的 报告.pdf" {
+		t.Errorf("Content-Disposition = %q, 文件名解析为 %q", rec.Header().Get("Content-Disposition"), params["filename"])
+	}
+}
+
+// sendFile 从调用方已经打开的文件读取，不按路径重新打开：打开后被改名或删除也能完整发送
+func TestSendFileUsesOpenHandle(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"a.txt": "original", "b.txt": "deleted later"})
+
+	for name, change := range map[string]func(string) error{
+		"a.txt": func(p string) error { return os.Rename(p, p+".renamed") },
+		"b.txt": os.Remove,
+	} {
+		p := filepath.Join(root, name)
+		file, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := os.ReadFile(p)
+		if err := change(p); err != nil {
+			file.Close()
+			if runtime.GOOS == "windows" {
+				t.Skipf("Windows 上不能改名或删除已打开的文件: %v", err)
+			}
+			t.Fatal(err)
+		}
+		// 同名的新文件不应被读到
+		writeFiles(t, root, map[string]string{name: "replacement"})
+
+		rec := httptest.NewRecorder()
+		s.sendFile(rec, httptest.NewRequest("GET", "/"+name, nil), file, name)
+		file.Close()
+		if rec.Code != http.StatusOK || rec.Body.String() != string(want) {
+			t.Errorf("%s: sendFile = %d %q, 应为 %q", name, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+// discardWriter 是丢弃所有数据的 ResponseWriter，用于测试发送循环本身
+type discardWriter struct{ header http.Header }
+
+func (d *discardWriter) Header() http.Header {
+	if d.header == nil {
+		d.header = http.Header{}
+	}
+	return d.header
+}
+func (d *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+// countingReader 是数据源，记录每次 Read 的次数和缓冲区大小；limit 为读满多少次后返回 EOF，0 表示无穷
+type countingReader struct {
+	limit   int64
+	reads   atomic.Int64
+	bufSize atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.limit > 0 && c.reads.Load() >= c.limit {
+		return 0, io.EOF
+	}
+	c.reads.Add(1)
+	c.bufSize.Store(int64(len(p)))
+	return len(p), nil
+}
+
+// 客户端取消请求后，发送循环在下一块之前退出，不再读取文件
+func TestCopyStopsOnCancel(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, nil)
+	src := &countingReader{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.copyWithIdleTimeout(ctx, &discardWriter{}, src)
+		done <- err
+	}()
+
+	for src.reads.Load() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("取消后返回 %v, 应为 context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("取消后发送循环没有退出")
+	}
+	reads := src.reads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if src.reads.Load() != reads {
+		t.Error("退出后仍在读取数据源")
+	}
+
+	// 已经取消的请求一次都不读
+	src = &countingReader{}
+	if _, err := s.copyWithIdleTimeout(ctx, &discardWriter{}, src); !errors.Is(err, context.Canceled) || src.reads.Load() != 0 {
+		t.Errorf("已取消的请求: 返回 %v, 读取了 %d 次", err, src.reads.Load())
+	}
+}
+
+// -buffer-size 决定发送循环每次读取的大小
+func TestCopyUsesBufferSize(t *testing.T) {
+	for _, size := range []ByteSize{0, 4 << 10, 256 << 10, 16 << 20} {
+		s, _ := newTestServer(t, Config{BufferSize: size}, nil)
+		want := int64(size)
+		if size == 0 {
+			want = 32 << 10 // 默认值
+		}
+		src := &countingReader{limit: 3}
+		n, err := s.copyWithIdleTimeout(context.Background(), &discardWriter{}, src)
+		if err != nil || n != 3*want {
+			t.Errorf("buffer-size %d: 发送 %d 字节, %v, 应为 %d", size, n, err, 3*want)
+		}
+		if got := src.bufSize.Load(); got != want {
+			t.Errorf("buffer-size %d: 每次读取 %d 字节, 应为 %d", size, got, want)
+		}
+	}
+	for _, bad := range []ByteSize{1, 4<<10 - 1, 16<<20 + 1} {
+		if _, err := New(Config{Dirs: []string{t.TempDir()}, BufferSize: bad}); err == nil {
+			t.Errorf("buffer-size %d 应返回错误", bad)
+		}
+	}
+}
+
+func BenchmarkCopyBufferSize(b *testing.B) {
+	const total = 64 << 20
+	data := bytes.Repeat([]byte("x"), total)
+	for _, size := range []ByteSize{4 << 10, 32 << 10, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprint(int64(size)>>10, "k"), func(b *testing.B) {
+			s, err := New(Config{Dirs: []string{b.TempDir()}, BufferSize: size, Force: true})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(total)
+			for i := 0; i < b.N; i++ {
+				if _, err := s.copyWithIdleTimeout(context.Background(), &discardWriter{}, bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 文件在两次请求之间被修改时，带旧 If-Range 的续传得到完整的200响应，不会拼出损坏的文件
+func TestIfRange(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"data.bin": "0123456789"})
+	h := s.Handler()
+	p := filepath.Join(root, "data.bin")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(p, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	first := do(t, h, "GET", "/data.bin", nil)
+	etag, lastMod := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if etag == "" || lastMod == "" {
+		t.Fatalf("没有 ETag(%q) 或 Last-Modified(%q)", etag, lastMod)
+	}
+	for _, validator := range []string{etag, lastMod} {
+		rec := do(t, h, "GET", "/data.bin", nil, "Range", "bytes=4-", "If-Range", validator)
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "456789" {
+			t.Errorf("文件未变 If-Range %s = %d %q, 应为206", validator, rec.Code, rec.Body.String())
+		}
+	}
+
+	// 内容长度不变，只有修改时间变化
+	if err := os.WriteFile(p, []byte("abcdefghij"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := old.Add(time.Minute)
+	if err := os.Chtimes(p, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+	for _, validator := range []string{etag, lastMod} {
+		rec := do(t, h, "GET", "/data.bin", nil, "Range", "bytes=4-", "If-Range", validator)
+		if rec.Code != http.StatusOK || rec.Body.String() != "abcdefghij" || rec.Header().Get("Content-Range") != "" {
+			t.Errorf("文件已变 If-Range %s = %d %q, 应为完整的200响应", validator, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(t, h, "GET", "/data.bin", nil, "Range", "bytes=4-"); rec.Code != http.StatusPartialContent {
+		t.Errorf("不带 If-Range 的 Range = %d, 应为206", rec.Code)
+	}
+}
+
+// 条件请求头先于 Range 判断(可能是304或412)，其次是 Range，HEAD 只是不带响应体；
+// 不是文件内容的响应不带 Content-Disposition
+func TestRangeWithConditions(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"data.bin": "0123456789"})
+	h := s.Handler()
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(root, "data.bin"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	first := do(t, h, "GET", "/data.bin", nil)
+	etag, lastMod := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	earlier := old.Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name   string
+		header []string
+		code   int
+		body   string
+	}{
+		{"Range", []string{"Range", "bytes=2-5"}, http.StatusPartialContent, "2345"},
+		{"If-None-Match 命中+Range", []string{"Range", "bytes=2-5", "If-None-Match", etag}, http.StatusNotModified, ""},
+		{"If-None-Match 命中+超出范围的 Range", []string{"Range", "bytes=50-", "If-None-Match", etag}, http.StatusNotModified, ""},
+		{"If-None-Match 未命中+Range", []string{"Range", "bytes=2-5", "If-None-Match", `"other"`}, http.StatusPartialContent, "2345"},
+		{"If-Modified-Since 未修改+Range", []string{"Range", "bytes=2-5", "If-Modified-Since", lastMod}, http.StatusNotModified, ""},
+		{"If-Modified-Since 已修改+Range", []string{"Range", "bytes=2-5", "If-Modified-Since", earlier}, http.StatusPartialContent, "2345"},
+		{"If-Match 未命中+Range", []string{"Range", "bytes=2-5", "If-Match", `"other"`}, http.StatusPreconditionFailed, ""},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{"GET", "HEAD"} {
+			rec := do(t, h, method, "/data.bin", nil, tt.header...)
+			body := tt.body
+			if method == "HEAD" {
+				body = ""
+			}
+			if rec.Code != tt.code || rec.Body.String() != body {
+				t.Errorf("%s %s = %d %q, 应为 %d %q", method, tt.name, rec.Code, rec.Body.String(), tt.code, body)
+			}
+			switch disp := rec.Header().Get("Content-Disposition"); {
+			case tt.code == http.StatusPartialContent && disp == "":
+				t.Errorf("%s %s: 206响应应带 Content-Disposition", method, tt.name)
+			case tt.code != http.StatusPartialContent && disp != "":
+				t.Errorf("%s %s: %d响应不应带 Content-Disposition: %s", method, tt.name, tt.code, disp)
+			}
+			if tt.code == http.StatusPartialContent {
+				if rec.Header().Get("Content-Range") != "bytes 2-5/10" || rec.Header().Get("Content-Length") != "4" {
+					t.Errorf("%s %s: Content-Range=%q Content-Length=%q", method, tt.name, rec.Header().Get("Content-Range"), rec.Header().Get("Content-Length"))
+				}
+			}
+		}
+	}
+}
+
+// 范围完全超出文件时返回416和 Content-Range: bytes */大小；格式无效的 Range 头被忽略，返回完整文件
+func TestRangeNotSatisfiable(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"data.bin": "0123456789"})
+	h := s.Handler()
+
+	for _, r := range []string{"bytes=99999999-", "bytes=10-", "bytes=-0", "bytes=20-30,40-50"} {
+		rec := do(t, h, "GET", "/data.bin", nil, "Range", r)
+		if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("Range %s = %d, 应为416", r, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Range"); got != "bytes */10" {
+			t.Errorf("Range %s 的 Content-Range = %q, 应为 bytes */10", r, got)
+		}
+		if rec.Header().Get("Content-Disposition") != "" {
+			t.Errorf("Range %s 的416响应不应带 Content-Disposition", r)
+		}
+	}
+
+	for _, r := range []string{"bytes=5-2", "bytes=abc", "bytes=+1-3", "items=0-3", "bytes="} {
+		rec := do(t, h, "GET", "/data.bin", nil, "Range", r)
+		if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" || rec.Header().Get("Content-Range") != "" {
+			t.Errorf("无效的 Range %s = %d %q, 应忽略并返回完整文件", r, rec.Code, rec.Body.String())
+		}
+	}
+
+	for r, want := range map[string]string{"bytes=8-100": "89", "bytes=-3": "789", "bytes=0-3,20-30": "0123"} {
+		rec := do(t, h, "GET", "/data.bin", nil, "Range", r)
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != want {
+			t.Errorf("Range %s = %d %q, 应为206 %q", r, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+// 开启 -gzip 后，文件下载默认不压缩，保留 Content-Length 以显示下载进度，页面照常压缩
+func TestGzipKeepsDownloadLength(t *testing.T) {
+	const size = 1 << 20
+	content := strings.Repeat("2024-01-01 12:00:00 INFO 压缩率很高的日志\n", size/50)
+	files := map[string]string{"logs/app.log": content}
+	s, _ := newTestServer(t, Config{Gzip: true, NoCompressDownloads: true}, files)
+	h := s.Handler()
+
+	rec := do(t, h, "GET", "/logs/app.log", nil, "Accept-Encoding", "gzip, deflate")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("下载 .log = %d, Content-Encoding: %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(content)) {
+		t.Errorf("Content-Length = %q, 应为 %d", got, len(content))
+	}
+	if rec.Body.String() != content {
+		t.Error("下载内容不一致")
+	}
+
+	page := do(t, h, "GET", "/logs/", nil, "Accept-Encoding", "gzip")
+	if page.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("目录页面没有压缩: %v", page.Header())
+	}
+	zr, err := gzip.NewReader(page.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); !strings.Contains(string(body), "app.log") {
+		t.Error("解压后的目录页面中没有 app.log")
+	}
+
+	// 关闭 -no-compress-downloads 后文本文件下载也压缩
+	compressed, _ := newTestServer(t, Config{Gzip: true}, files)
+	rec = do(t, compressed.Handler(), "GET", "/logs/app.log", nil, "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Content-Length") != "" || rec.Body.Len() >= len(content) {
+		t.Errorf("-no-compress-downloads=false: %v, %d 字节", rec.Header(), rec.Body.Len())
+	}
+}
+
+func TestPrecompressedSiblings(t *testing.T) {
+	s, root := newTestServer(t, Config{Precompressed: true}, map[string]string{
+		"app.js":       "console.log(1)",
+		"app.js.gz":    "GZ",
+		"app.js.br":    "BR",
+		"style.css":    "body{}",
+		"style.css.gz": "OLD",
+		"plain.txt":    "plain",
+	})
+	h := s.Handler()
+	now := time.Now()
+	for name, mtime := range map[string]time.Time{
+		"app.js": now.Add(-time.Hour), "app.js.gz": now, "app.js.br": now,
+		"style.css": now, "style.css.gz": now.Add(-time.Hour), // 原文件更新后压缩版本已过期
+	} {
+		if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		target, accept, body, encoding string
+	}{
+		{"/app.js", "gzip", "GZ", "gzip"},
+		{"/app.js", "gzip, deflate, br", "BR", "br"},
+		{"/app.js", "br;q=0, gzip", "GZ", "gzip"},
+		{"/app.js", "gzip;q=0", "console.log(1)", ""},
+		{"/app.js", "", "console.log(1)", ""},
+		{"/style.css", "gzip", "body{}", ""},
+		{"/plain.txt", "gzip, br", "plain", ""},
+	}
+	for _, tt := range tests {
+		rec := do(t, h, "GET", tt.target, nil, "Accept-Encoding", tt.accept)
+		if rec.Code != http.StatusOK || rec.Body.String() != tt.body || rec.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("GET %s (Accept-Encoding: %s) = %d %q, Content-Encoding: %q, 应为 %q %q",
+				tt.target, tt.accept, rec.Code, rec.Body.String(), rec.Header().Get("Content-Encoding"), tt.body, tt.encoding)
+		}
+		// 压缩版本使用原文件的类型和文件名
+		if tt.target == "/app.js" {
+			if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+				t.Errorf("GET /app.js (%s): Content-Type = %q", tt.accept, ct)
+			}
+			if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="app.js"`) {
+				t.Errorf("GET /app.js (%s): Content-Disposition = %q", tt.accept, cd)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("GET /app.js (%s): 没有 Vary: Accept-Encoding", tt.accept)
+			}
+		}
+	}
+	// 没有压缩版本的文件不需要 Vary
+	if rec := do(t, h, "GET", "/plain.txt", nil); rec.Header().Get("Vary") != "" {
+		t.Errorf("GET /plain.txt: Vary = %q", rec.Header().Get("Vary"))
+	}
+
+	// 直接访问压缩版本时按普通文件下载
+	if rec := do(t, h, "GET", "/app.js.gz", nil, "Accept-Encoding", "gzip"); rec.Body.String() != "GZ" || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("GET /app.js.gz = %q, Content-Encoding: %q", rec.Body.String(), rec.Header().Get("Content-Encoding"))
+	}
+}
+
+// 没有开启 -precompressed 时 a.txt.gz 只是另一个文件，不会代替 a.txt 发送
+func TestPrecompressedOptIn(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"report.txt": "report", "report.txt.gz": "other"})
+	rec := do(t, s.Handler(), "GET", "/report.txt", nil, "Accept-Encoding", "gzip, br")
+	if rec.Body.String() != "report" || rec.Header().Get("Content-Encoding") != "" || rec.Header().Get("Vary") != "" {
+		t.Errorf("未开启 -precompressed: %q, Content-Encoding %q", rec.Body.String(), rec.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,213 @@
+package fileshare
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// eventsDebounce 是合并目录变化的时间：复制大文件时每次写入都有事件，
+// 收到第一个事件后等这么久再通知，期间的其他事件不再单独通知
+const eventsDebounce = 500 * time.Millisecond
+
+// eventsPollInterval 是无法用 fsnotify 监听的目录(如某些网络文件系统、FUSE 挂载)退回轮询时的检查间隔
+const eventsPollInterval = 2 * time.Second
+
+// eventsPingInterval 是事件流没有变化时发送保活注释行的间隔
+const eventsPingInterval = 15 * time.Second
+
+// dirWatch 是一个目录的共享监听：同一目录的所有事件流共用一个，目录只加入 fsnotify 一次，
+// 打开很多个标签页也不会重复监听
+type dirWatch struct {
+	subs    map[chan struct{}]bool
+	pending bool          // 已安排在 eventsDebounce 后通知
+	poll    chan struct{} // 退回轮询时非 nil，关闭后轮询协程结束
+}
+
+// subscribeDir 订阅目录变化，返回的通道在目录变化时收到信号(未读的信号会合并)，用完调用 cancel。
+// 第一个订阅者把目录加入 fsnotify，最后一个退订时移除
+func (s *Server) subscribeDir(dirPath string) (changes <-chan struct{}, cancel func()) {
+	ch := make(chan struct{}, 1)
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	wt := s.watches[dirPath]
+	if wt == nil {
+		wt = &dirWatch{subs: map[chan struct{}]bool{}}
+		s.watches[dirPath] = wt
+		if err := s.watchDirLocked(dirPath); err != nil {
+			log.Printf("无法监听目录 %s 的变化，改为每 %v 检查一次: %v", dirPath, eventsPollInterval, err)
+			wt.poll = make(chan struct{})
+			go s.pollDir(dirPath, wt)
+		}
+	}
+	wt.subs[ch] = true
+	return ch, func() {
+		s.watchMu.Lock()
+		defer s.watchMu.Unlock()
+		delete(wt.subs, ch)
+		if len(wt.subs) > 0 || s.watches[dirPath] != wt {
+			return
+		}
+		delete(s.watches, dirPath)
+		if wt.poll != nil {
+			close(wt.poll)
+		} else {
+			s.watcher.Remove(dirPath)
+		}
+	}
+}
+
+// watchDirLocked 把目录加入 fsnotify，第一次调用时创建 watcher 并启动分发协程；调用方需持有 watchMu
+func (s *Server) watchDirLocked(dirPath string) error {
+	if s.watcher == nil {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		s.watcher = w
+		go s.dispatchEvents(w)
+	}
+	return s.watcher.Add(dirPath)
+}
+
+// dispatchEvents 把 fsnotify 的事件交给所在目录的订阅者，停止服务时关闭 watcher
+func (s *Server) dispatchEvents(w *fsnotify.Watcher) {
+	defer w.Close()
+	for {
+		select {
+		case <-s.stopping:
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			s.dirChanged(filepath.Dir(ev.Name))
+			// 被监听的目录自身被删除或改名时也通知一次，让页面刷新后显示错误
+			if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				s.dirChanged(ev.Name)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("监听目录变化出错: %v", err)
+		}
+	}
+}
+
+// dirChanged 在 eventsDebounce 后通知目录的所有订阅者，期间再有变化不重复安排
+func (s *Server) dirChanged(dirPath string) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	wt := s.watches[dirPath]
+	if wt == nil || wt.pending {
+		return
+	}
+	wt.pending = true
+	time.AfterFunc(eventsDebounce, func() {
+		s.watchMu.Lock()
+		defer s.watchMu.Unlock()
+		wt.pending = false
+		for ch := range wt.subs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	})
+}
+
+// pollDir 定期比较目录快照，变化时通知所有订阅者，直到 wt.poll 关闭
+func (s *Server) pollDir(dirPath string, wt *dirWatch) {
+	last, _ := dirSnapshot(dirPath)
+	ticker := time.NewTicker(eventsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopping:
+			return
+		case <-wt.poll:
+			return
+		case <-ticker.C:
+		}
+		snap, _ := dirSnapshot(dirPath) // 目录被删除时得到空快照，也算变化
+		if snap != last {
+			last = snap
+			s.dirChanged(dirPath)
+		}
+	}
+}
+
+// handleEvents 以 Server-Sent Events 推送目录变化，列表页收到 change 事件后自动刷新。
+// 变化由 subscribeDir 的共享监听发现；客户端断开时请求的 context 会被取消，随之退订
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	dirPath, _, err := s.resolvePath(r.URL.Query().Get("path"))
+	if err != nil || dirPath == "" || s.pathHidden(dirPath) {
+		s.renderError(w, r, http.StatusNotFound, "目录未找到")
+		return
+	}
+	if !s.checkDirAuth(w, r, dirPath) {
+		return
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		s.renderError(w, r, http.StatusNotFound, "目录未找到")
+		return
+	}
+
+	noTimeout(w)
+	rc := http.NewResponseController(w)
+	// 事件流是长连接，不受 -write-timeout 限制
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	changes, cancel := s.subscribeDir(dirPath)
+	defer cancel()
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		case <-changes:
+			fmt.Fprint(w, "event: change\ndata: {}\n\n")
+		case <-ping.C:
+			// 定期发送注释行保活，也能及时发现已断开的连接
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// dirSnapshot 返回目录内容的摘要(轮询时使用)，任一条目增删、改名、大小或修改时间变化都会改变结果
+func dirSnapshot(dirPath string) (string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,133 @@
+package fileshare
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsOnFileCreated(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"docs/a.txt": "a"})
+	base := startServer(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", base+"/_nfs/events?path=docs", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events = %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			select {
+			case lines <- sc.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	// 连接建立后先收到重连间隔，此时已经开始监视
+	if line := <-lines; line != "retry: 3000" {
+		t.Fatalf("第一行为 %q", line)
+	}
+
+	writeFiles(t, root, map[string]string{"docs/new.txt": "new"})
+	timeout := time.After(eventsDebounce + 3*time.Second)
+	for got := false; !got; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("事件流提前结束")
+			}
+			got = line == "event: change"
+		case <-timeout:
+			t.Fatal("新建文件后没有收到事件")
+		}
+	}
+
+	// 客户端断开后取消订阅，不再监听该目录
+	cancel()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s.watchMu.Lock()
+		n := len(s.watches)
+		s.watchMu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("断开后仍有 %d 个目录在监视", n)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// 同一目录的订阅者共用一个监听，短时间内的多次变化合并为一次通知
+func TestSubscribeDirShared(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"docs/a.txt": "a"})
+	t.Cleanup(func() { close(s.stopping) })
+	dir := filepath.Join(s.rootDir, "docs")
+	first, cancelFirst := s.subscribeDir(dir)
+	second, cancelSecond := s.subscribeDir(dir)
+	s.watchMu.Lock()
+	watches, polling := len(s.watches), s.watches[dir].poll != nil
+	s.watchMu.Unlock()
+	if watches != 1 {
+		t.Fatalf("两个订阅者共有 %d 个监听, 应为 1", watches)
+	}
+	if polling {
+		t.Skip("当前文件系统不支持 fsnotify")
+	}
+
+	for i := 0; i < 5; i++ {
+		writeFiles(t, root, map[string]string{"docs/a.txt": strings.Repeat("a", i+2)})
+	}
+	for name, ch := range map[string]<-chan struct{}{"第一个": first, "第二个": second} {
+		select {
+		case <-ch:
+		case <-time.After(eventsDebounce + 3*time.Second):
+			t.Fatalf("%s订阅者没有收到通知", name)
+		}
+	}
+	select {
+	case <-first:
+		t.Error("连续写入收到了多次通知")
+	case <-time.After(2 * eventsDebounce):
+	}
+
+	cancelFirst()
+	s.watchMu.Lock()
+	watches = len(s.watches)
+	s.watchMu.Unlock()
+	if watches != 1 {
+		t.Error("还有订阅者时移除了监听")
+	}
+	cancelSecond()
+	s.watchMu.Lock()
+	watches = len(s.watches)
+	s.watchMu.Unlock()
+	if watches != 0 || len(s.watcher.WatchList()) != 0 {
+		t.Errorf("全部退订后仍在监听 %v", s.watcher.WatchList())
+	}
+}
+
+func TestEventsRejectsUnknownPath(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"a.txt": "a"})
+	for _, target := range []string{"/_nfs/events?path=missing", "/_nfs/events?path=a.txt"} {
+		if rec := do(t, s.Handler(), "GET", target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, 应为404", target, rec.Code)
+		}
+	}
+}
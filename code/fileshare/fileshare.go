@@ -0,0 +1,365 @@
+package fileshare
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 版本信息，发布时通过 -ldflags 写入，如
+// -ldflags "-X github.com/mcpackms/Network-File-Share/code/fileshare.Version=v1.2.3 -X github.com/mcpackms/Network-File-Share/code/fileshare.Commit=$(git rev-parse --short HEAD) -X github.com/mcpackms/Network-File-Share/code/fileshare.BuildDate=$(date -u +%Y-%m-%d)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// VersionString 是 -version 输出的一行版本信息：
+// NetworkFileShare 版本 (commit 提交, built 构建日期, Go版本 系统/架构)
+func VersionString() string {
+	return fmt.Sprintf("NetworkFileShare %s (commit %s, built %s, %s %s/%s)", Version, Commit, BuildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// defaultFavicon 是内置的网站图标，可用 -favicon 替换
+//
+//go:embed favicon.ico
+var defaultFavicon []byte
+
+// assetsFS 是页面用到的静态资源(字体 CSS 等)，通过 /_nfs/assets/ 提供，页面不依赖外网 CDN
+//
+//go:embed assets
+var assetsFS embed.FS
+
+// errorTemplate 是浏览器访问出错时显示的页面，样式与目录列表一致
+var errorTemplate = template.Must(template.New("").Parse(`
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <link href="{{.Base}}/_nfs/assets/fonts.css" rel="stylesheet">
+    <title>{{.Status}} {{.StatusText}}</title>
+    <style>
+        body { font-family: "HarmonyOS Sans", "思源黑体", sans-serif; font-size:14px; max-width: 960px; margin: 0 auto; padding: 0 12px; }
+        a { color: #2196F3; }
+        .status { color: #999; }
+        @media (prefers-color-scheme: dark) {
+            body { background: #121212; color: #ddd; }
+            a { color: #64B5F6; }
+        }
+    </style>
+</head>
+<body>
+    <h2>⚠️ {{.Message}}</h2>
+    <p class="status">{{.Status}} {{.StatusText}}</p>
+    {{if .Unlock}}<form method="post" action="{{.Base}}/_nfs/unlock">
+        <input type="hidden" name="path" value="{{.Unlock}}">
+        <input type="hidden" name="next" value="{{.Next}}">
+        <input type="password" name="password" placeholder="目录密码" autofocus>
+        <button type="submit">确定</button>
+    </form>{{end}}
+    <p><a href="{{.Base}}/">返回首页</a></p>
+</body>
+</html>
+`))
+
+// Handler 注册全部路由并套上 IP 过滤、路径前缀和 CORS 中间件，
+// 使用独立的 ServeMux 而不是 http.DefaultServeMux。二维码、搜索、上传、WebDAV 等服务接口都放在保留的 /_nfs/ 下，
+// 共享目录根下名为 qr、search 等的文件不会被遮住
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.singleFile != "" {
+		mux.HandleFunc("/", s.serveSingleFile)
+		mux.HandleFunc("GET /favicon.ico", s.handleFavicon)
+		mux.HandleFunc("GET /_nfs/qr", s.handleQR)
+		mux.HandleFunc("GET "+healthPath, s.handleHealth)
+		return withServerHeader(s.withAccessLog(s.withIPFilter(s.withBasePath(s.withClientLimit(s.withAuth(s.withRequestTimeout(mux)))))))
+	}
+	if s.cfg.Dashboard {
+		s.browsePrefix = "/browse"
+		mux.HandleFunc("/{$}", s.handleDashboard)
+		mux.Handle("/browse/", http.StripPrefix(s.browsePrefix, http.HandlerFunc(s.serveFiles)))
+		// 兼容开启前的文件链接
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, s.basePath+s.browsePrefix+r.URL.EscapedPath(), http.StatusMovedPermanently)
+		})
+	} else {
+		mux.HandleFunc("/", s.serveFiles)
+	}
+
+	mux.HandleFunc("GET /favicon.ico", s.handleFavicon)
+	assets, _ := fs.Sub(assetsFS, "assets")
+	mux.Handle("GET /_nfs/assets/", http.StripPrefix("/_nfs/assets/", withCache(http.FileServer(http.FS(assets)))))
+	mux.HandleFunc("GET /_nfs/qr", s.handleQR)
+	mux.HandleFunc("GET /_nfs/thumb", s.handleThumb)
+	mux.HandleFunc("POST /_nfs/zip-selected", s.handleZipSelected)
+	mux.HandleFunc("GET /_nfs/share", s.handleShare)
+	mux.HandleFunc("GET "+sharedPath, s.handleSharedDownload)
+	mux.HandleFunc("GET /_nfs/events", s.handleEvents)
+	mux.HandleFunc("GET /_nfs/stats", s.handleStats)
+	mux.HandleFunc("GET /_nfs/search", s.handleSearch)
+	mux.HandleFunc("POST /_nfs/unlock", s.handleUnlock)
+	mux.HandleFunc("GET "+healthPath, s.handleHealth)
+
+	// 修改类接口是否可用由 withReadOnly 统一决定
+	mux.HandleFunc("POST /_nfs/mkdir", s.handleMkdir)
+	mux.HandleFunc("POST /_nfs/delete", s.handleDelete)
+	mux.HandleFunc("POST /_nfs/move", s.handleMove)
+	mux.HandleFunc("POST /_nfs/upload", s.handleUpload)
+	mux.HandleFunc("POST /_nfs/upload/create", s.handleUploadCreate)
+	mux.HandleFunc("POST /_nfs/upload/chunk", s.handleUploadChunk)
+	mux.HandleFunc("GET /_nfs/upload/status", s.handleUploadStatus)
+	mux.HandleFunc(tusPrefix, s.handleTus)
+	if s.cfg.WebDAV {
+		mux.HandleFunc(davPrefix, s.handleDAV)
+	}
+
+	return withServerHeader(s.withAccessLog(s.withIPFilter(s.withBasePath(s.withClientLimit(s.withCORS(s.withAuth(s.withReadOnly(s.withGzip(s.withRequestTimeout(mux))))))))))
+}
+
+// readOnlyPOST 是只读模式下仍然允许的 POST 接口，它们不修改文件
+var readOnlyPOST = map[string]bool{"/_nfs/zip-selected": true, "/_nfs/unlock": true}
+
+// withReadOnly 是服务器级别的读写策略：只读模式(默认)下，除 GET、HEAD、OPTIONS、PROPFIND
+// 和 readOnlyPOST 以外的请求(上传、删除、新建文件夹、WebDAV 写操作等)一律拒绝，各接口不再单独判断。
+// 对文件地址直接发的 DELETE 等方法返回405和 Allow，其余返回403
+func (s *Server) withReadOnly(next http.Handler) http.Handler {
+	if s.cfg.Writable {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions || r.Method == "PROPFIND":
+		case r.Method == http.MethodPost && readOnlyPOST[r.URL.Path]:
+		case r.Method != http.MethodPost && !strings.HasPrefix(r.URL.Path, davPrefix):
+			// 对文件地址的 DELETE、PUT 等：只读模式下这些方法不可用，按405告诉客户端能用哪些
+			log.Printf("[readonly]%s 拒绝 %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			s.renderError(w, r, http.StatusMethodNotAllowed, "不支持的请求方法")
+			return
+		default:
+			log.Printf("[readonly]%s 拒绝 %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			s.renderError(w, r, http.StatusForbidden, "服务器为只读模式，不允许修改")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveSingleFile 是单文件模式(-file)的处理器：只在 / 和 /<文件名> 提供该文件下载，其他路径一律404
+func (s *Server) serveSingleFile(w http.ResponseWriter, r *http.Request) {
+	s.requestCount.Add(1)
+	if s.accessLog == nil {
+		log.Printf("[request]%s %s", r.Method, r.URL.Path)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.renderError(w, r, http.StatusMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+	name := filepath.Base(s.singleFile)
+	if r.URL.Path != "/" && r.URL.Path != "/"+name {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+
+	file, err := os.Open(s.singleFile)
+	if err != nil {
+		log.Printf("打开文件失败: %v", err)
+		s.renderFSError(w, r, err)
+		return
+	}
+	defer file.Close()
+	s.sendFile(w, r, file, name)
+}
+
+// serveFiles 处理文件浏览和下载：目录显示列表，文件按参数下载、预览或计算校验值
+func (s *Server) serveFiles(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	reqPath := r.URL.Path
+	s.requestCount.Add(1)
+	if s.accessLog == nil {
+		log.Printf("[request]%s %s", r.Method, reqPath)
+	}
+
+	// 开启 -writable 时可以直接对文件地址发 DELETE，其余修改操作走各自的接口
+	if r.Method == http.MethodDelete && s.cfg.Writable {
+		if _, ok := s.deletePath(w, r, reqPath); ok {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		if s.cfg.Writable {
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS, DELETE")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.renderError(w, r, http.StatusMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+
+	// 限制同时处理的请求数，已满时直接拒绝而不是排队等待
+	if s.connSem != nil {
+		select {
+		case s.connSem <- struct{}{}:
+		default:
+			log.Printf("[busy]%s %s 并发请求已达上限 %d", r.Method, reqPath, s.cfg.MaxConns)
+			w.Header().Set("Retry-After", "5")
+			s.renderError(w, r, http.StatusServiceUnavailable, "服务器繁忙，请稍后重试")
+			return
+		}
+	}
+
+	defer func() {
+		if s.connSem != nil {
+			<-s.connSem
+		}
+		if s.accessLog == nil {
+			log.Printf("[finish]%s %s 耗时: %v", r.Method, reqPath, time.Since(startTime))
+		}
+	}()
+
+	fullPath, cleanedPath, err := s.resolvePath(reqPath)
+	if errors.Is(err, os.ErrNotExist) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	} else if err != nil {
+		log.Printf("非法路径: %v", err)
+		s.renderError(w, r, http.StatusForbidden, "禁止访问")
+		return
+	}
+	if fullPath == "" {
+		s.listMounts(w, r)
+		return
+	}
+
+	// 调试日志：打印处理后的路径
+	if s.cfg.Verbose {
+		log.Printf("处理路径: %s → %s", reqPath, fullPath)
+	}
+
+	if s.pathHidden(fullPath) || !s.exactCase(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if !s.checkDirAuth(w, r, fullPath) {
+		return
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		log.Printf("打开文件失败: %v", err)
+		s.renderFSError(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		log.Printf("获取文件信息失败: %v", err)
+		s.renderFSError(w, r, err)
+		return
+	}
+
+	if !fileInfo.IsDir() && !s.extAllowed(fileInfo.Name()) {
+		log.Printf("扩展名不允许访问: %s", fullPath)
+		s.renderError(w, r, http.StatusForbidden, "禁止访问")
+		return
+	}
+
+	// 目录统一以"/"结尾、文件不带"/"，和常见 Web 服务器一致，相对链接才能解析到正确位置
+	if fileInfo.IsDir() != strings.HasSuffix(reqPath, "/") && cleanedPath != "." {
+		target := s.siteURL(filepath.ToSlash(cleanedPath))
+		if fileInfo.IsDir() {
+			target = s.dirURL(filepath.ToSlash(cleanedPath))
+		}
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	if fileInfo.IsDir() && r.URL.Query().Get("download") == "zip" {
+		s.sendDirZip(w, r, fullPath, "")
+	} else if fileInfo.IsDir() && r.URL.Query().Get("download") == "tar.gz" {
+		s.sendDirTarGz(w, r, fullPath)
+	} else if fileInfo.IsDir() {
+		s.listDir(w, r, fullPath, cleanedPath)
+	} else if r.URL.Query().Get("checksum") == "sha256" {
+		s.sendChecksum(w, r, file)
+	} else if r.URL.Query().Get("preview") == "1" {
+		s.previewFile(w, r, file, fileInfo.Name())
+	} else {
+		s.sendFile(w, r, file, fileInfo.Name())
+	}
+}
+
+// renderError 返回错误响应：浏览器显示带样式的错误页，其他客户端(curl、脚本等)返回纯文本
+func (s *Server) renderError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	s.renderErrorPage(w, r, status, msg, "", "")
+}
+
+// renderErrorPage 输出错误页，unlock 不为空时页面上带输入该目录密码的表单，提交后回到 next
+func (s *Server) renderErrorPage(w http.ResponseWriter, r *http.Request, status int, msg, unlock, next string) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	data := struct {
+		Status     int
+		StatusText string
+		Message    string
+		Base       string
+		Unlock     string
+		Next       string
+	}{status, http.StatusText(status), msg, s.basePath, unlock, next}
+	if err := errorTemplate.Execute(w, data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
+
+// renderFSError 按文件系统错误的类型返回对应状态码：
+// 不存在为404，没有权限为403，其他意外错误才是500
+func (s *Server) renderFSError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+	case errors.Is(err, os.ErrPermission):
+		s.renderError(w, r, http.StatusForbidden, "没有访问权限")
+	default:
+		s.renderError(w, r, http.StatusInternalServerError, "文件访问错误")
+	}
+}
+
+// handleFavicon 返回网站图标，浏览器每次打开页面都会请求，允许缓存一天
+func (s *Server) handleFavicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", s.faviconType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.favicon)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(s.favicon)
+}
@@ -0,0 +1,100 @@
+package fileshare
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// compressibleTypes 是 -gzip 会压缩的响应类型：页面、JSON、文本等。
+// 文件下载（带 Content-Disposition: attachment）默认不压缩，保留 Content-Length，
+// 浏览器才能显示下载进度；-no-compress-downloads=false 时文本类文件下载也会压缩
+var compressibleTypes = []string{"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml"}
+
+// shouldCompress 在响应头写出前判断是否压缩
+func (s *Server) shouldCompress(h http.Header, status int) bool {
+	if status != http.StatusOK || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if s.cfg.NoCompressDownloads && strings.HasPrefix(h.Get("Content-Disposition"), "attachment") {
+		return false
+	}
+	ctype := h.Get("Content-Type")
+	if strings.HasPrefix(ctype, "text/event-stream") {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(ctype, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter 在第一次写出响应头时决定是否压缩
+type gzipResponseWriter struct {
+	s *Server
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	h := g.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if g.s.shouldCompress(h, status) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap 让 http.ResponseController 能找到底层连接，设置读写超时
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// withGzip 对支持 gzip 的客户端压缩页面等响应，未开启 -gzip 时原样返回
+func (s *Server) withGzip(next http.Handler) http.Handler {
+	if !s.cfg.Gzip {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{s: s, ResponseWriter: w}
+		defer func() {
+			if gw.gz != nil {
+				gw.gz.Close()
+			}
+		}()
+		next.ServeHTTP(gw, r)
+	})
+}
@@ -0,0 +1,88 @@
+package fileshare
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hideFileName 是目录内的隐藏规则文件，每行一个 filepath.Match 通配符，匹配文件名
+const hideFileName = ".nfshide"
+
+// readHideFile 读取目录下的 .nfshide，不存在时返回空
+func readHideFile(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, hideFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取 %s 失败: %v", hideFileName, err)
+		}
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
+
+// matchHidden 判断文件名是否被隐藏，.nfshide 本身总是隐藏
+func matchHidden(patterns []string, name string) bool {
+	if name == hideFileName || name == authFileName || strings.HasPrefix(name, uploadTempPrefix) {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHidden 从目标一路向上检查到共享根目录，任何一级被所在目录的 .nfshide 隐藏，
+// 整个路径都视为不存在
+func (s *Server) pathHidden(fullPath string) bool {
+	for p := fullPath; !s.isShareRoot(p); {
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		if matchHidden(readHideFile(parent), filepath.Base(p)) {
+			return true
+		}
+		p = parent
+	}
+	return false
+}
+
+// parseExtList 解析逗号分隔的扩展名列表，统一为小写并带"."前缀
+func parseExtList(v string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(v, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts[ext] = true
+	}
+	return exts
+}
+
+// extAllowed 判断文件能否按扩展名被列出和下载（不区分大小写）：
+// 在 -deny-ext 中的一律拒绝；设置了 -allow-ext 时只放行其中的扩展名
+func (s *Server) extAllowed(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if s.denyExt[ext] {
+		return false
+	}
+	if len(s.allowExt) > 0 {
+		return s.allowExt[ext]
+	}
+	return true
+}
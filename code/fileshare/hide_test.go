@@ -0,0 +1,68 @@
+package fileshare
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMatchHidden(t *testing.T) {
+	patterns := []string{"secret.txt", "*.bak", "draft-?.md"}
+	tests := map[string]bool{
+		"secret.txt":   true,
+		"secret.txt2":  false,
+		"a.bak":        true,
+		".bak":         true,
+		"a.bak.txt":    false,
+		"draft-1.md":   true,
+		"draft-10.md":  false,
+		"readme.md":    false,
+		hideFileName:   true, // 规则文件本身总是隐藏
+		authFileName:   true,
+		"notes.txt":    false,
+		"SECRET.TXT":   false, // filepath.Match 区分大小写
+		"sub/a.bak":    false, // 只匹配文件名
+		"secret.txt/x": false,
+	}
+	for name, want := range tests {
+		if got := matchHidden(patterns, name); got != want {
+			t.Errorf("matchHidden(%q) = %v, 应为 %v", name, got, want)
+		}
+	}
+	if matchHidden(nil, "a.bak") {
+		t.Error("没有规则时不应隐藏普通文件")
+	}
+}
+
+func TestHideFile(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{
+		"docs/" + hideFileName: "# 注释\nsecret.txt\n\n*.bak\nprivate\n",
+		"docs/secret.txt":      "s",
+		"docs/old.bak":         "b",
+		"docs/keep.txt":        "k",
+		"docs/private/inner":   "i",
+		"other/secret.txt":     "其他目录不受影响",
+	})
+	h := s.Handler()
+
+	body := do(t, h, "GET", "/docs/", nil).Body.String()
+	if !strings.Contains(body, "keep.txt") {
+		t.Error("列表中没有 keep.txt")
+	}
+	for _, name := range []string{"secret.txt", "old.bak", "private", hideFileName} {
+		if strings.Contains(body, name) {
+			t.Errorf("列表中出现了隐藏的 %s", name)
+		}
+	}
+
+	for _, target := range []string{"/docs/secret.txt", "/docs/old.bak", "/docs/" + hideFileName, "/docs/private/", "/docs/private/inner"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, 应为404", target, rec.Code)
+		}
+	}
+	for target, want := range map[string]string{"/docs/keep.txt": "k", "/other/secret.txt": "其他目录不受影响"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,802 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dirListTemplate 是内置的目录列表模板，分为 header、row、footer 三部分，
+// 条目很多时 listDir 逐行执行 row 边生成边发送，不必先把整页放进内存
+var dirListTemplate = template.Must(template.New("").Funcs(template.FuncMap{"row": newListRow}).Parse(`{{template "header" .}}{{range .Files}}{{template "row" row . $}}{{end}}{{template "footer" .}}
+{{define "header"}}
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <!-- HarmonyOS Sans / 思源黑体，使用本机字体 -->
+    <link href="{{.Base}}/_nfs/assets/fonts.css" rel="stylesheet">
+    <title>文件服务 - {{.RelPath}}</title>
+    <style>
+        /* 免费商用字体配置 */
+        body {
+            font-family: "HarmonyOS Sans", "思源黑体", sans-serif;
+            max-width: 960px;
+            margin: 0 auto;
+            padding: 0 12px;
+            background: #fff;
+            color: #222;
+        }
+        a { color: inherit; }
+        ul { padding-left: 0; list-style: none; }
+        li { 
+            font-size:14px; 
+            line-height:1.8;
+            padding: 6px 0;
+            border-bottom: 1px solid #eee;
+            word-break: break-all;
+        }
+        dir { color: #2196F3; }
+        file { color: #4CAF50; }
+        .verify { font-size:12px; color: #999; }
+        .total { color: #666; font-size:13px; }
+        .size { font-size:12px; color: #999; }
+        .pager a { margin-right: 16px; }
+        form.inline { display: inline; }
+        .delete { font-size:12px; color: #F44336; background: none; border: none; cursor: pointer; }
+        .move { font-size:12px; color: #2196F3; background: none; border: none; cursor: pointer; }
+        table.files { width: 100%; border-collapse: collapse; }
+        .files th, .files td { font-size:14px; line-height:1.8; padding: 6px 4px; border-bottom: 1px solid #eee; text-align: left; word-break: break-all; }
+        .files th { font-size:13px; font-weight: normal; color: #666; }
+        .files th a { text-decoration: none; }
+        .files td.size, .files th.size, .files th.mtime { white-space: nowrap; }
+        ul.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(160px, 1fr)); gap: 8px; }
+        ul.grid li { border: none; text-align: center; }
+        .thumb { display: block; width: 100%; height: 140px; object-fit: cover; border-radius: 4px; background: #eee; }
+        .copy { font-size:12px; color: #999; background: none; border: none; cursor: pointer; padding: 0; }
+        .qr img { width: 200px; height: 200px; margin-top: 8px; }
+        .readme { border: 1px solid #eee; border-radius: 4px; padding: 0 16px; margin: 12px 0; font-size:14px; line-height:1.6; }
+        .readme pre { background: #f5f5f5; padding: 12px; overflow-x: auto; white-space: pre-wrap; word-break: break-all; }
+        /* 手机上加大点击区域 */
+        @media (max-width: 600px) {
+            li { font-size:16px; padding: 10px 0; }
+            li > a:first-child { display: block; }
+            .files td { font-size:16px; padding: 10px 4px; }
+            .mtime { display: none; }
+            .verify, .delete, .move { font-size:14px; padding: 4px 8px 4px 0; }
+        }
+        @media (prefers-color-scheme: dark) {
+            body { background: #121212; color: #ddd; }
+            li, .files th, .files td { border-bottom-color: #333; }
+            dir { color: #64B5F6; }
+            file { color: #81C784; }
+            .total, .verify { color: #888; }
+            .readme { border-color: #333; }
+            .readme pre { background: #1e1e1e; }
+        }
+    </style>
+</head>
+<body>
+    <h2>📂 当前目录：{{.RelPath}}</h2>
+    <p class="total">共 {{.Total}} 项{{if .Paged}}，第 {{.Page}}/{{.Pages}} 页{{end}}
+        {{if not .ShowSizes}}<a class="verify" href="?sizes=1">显示文件夹大小</a>{{end}}
+        {{if not .Details}}<a class="verify" href="?details=1">显示权限</a>{{end}}
+        {{if .Grid}}<a class="verify" href="?">列表视图</a>{{else}}<a class="verify" href="?view=grid">缩略图视图</a>{{end}}
+        {{if .Grid}}排序：{{range .SortLinks}}<a class="verify" href="?sort={{.Key}}&order={{.Next}}">{{.Label}}{{.Arrow}}</a> {{end}}{{end}}</p>
+    <form method="get" action="{{.Base}}/_nfs/search">
+        <input type="hidden" name="path" value="{{.Dir}}">
+        <input type="text" name="q" placeholder="在此文件夹中搜索文件名，可用 * ? 通配符" required>
+        <button type="submit">搜索</button>
+    </form>
+    {{if and .ShareURL (not .HasParent)}}<details class="qr"><summary class="verify">手机扫码访问</summary>
+        <img src="{{.Base}}/_nfs/qr" alt="{{.ShareURL}}"><br><span class="total">{{.ShareURL}}</span>
+    </details>{{end}}
+    {{if .Writable}}<form method="post" action="{{.Base}}/_nfs/mkdir">
+        <input type="hidden" name="dir" value="{{.Dir}}">
+        <input type="text" name="name" placeholder="文件夹名称" required>
+        <button type="submit">新建文件夹</button>
+    </form>
+    <form method="post" action="{{.Base}}/_nfs/upload" enctype="multipart/form-data" onsubmit="uploadFiles(); return false;">
+        <input type="hidden" name="dir" value="{{.Dir}}">
+        <input type="file" id="upload-file" name="file" multiple> <button type="submit">上传</button>
+        <span id="upload-progress" class="total"></span>
+    </form>{{end}}
+    {{if .Readme}}<div class="readme">{{.Readme}}</div>{{end}}
+    <form id="zip-selected" method="post" action="{{.Base}}/_nfs/zip-selected">
+        <button type="submit">打包下载选中文件</button>
+        <a class="verify" href="?download=zip">打包下载整个文件夹</a>
+        <a class="verify" href="?download=tar.gz">(tar.gz)</a>
+    </form>
+    {{if .Grid}}<ul class="grid">
+        {{if .HasParent}}<li><a href="{{.ParentPath}}">↑ 返回上级</a></li>{{end}}
+    {{else}}<table class="files">
+        <thead><tr>{{range .SortLinks}}<th{{if ne .Key "name"}} class="{{.Key}}"{{end}}><a href="?sort={{.Key}}&order={{.Next}}">{{.Label}}{{.Arrow}}</a></th>{{end}}<th></th></tr></thead>
+        <tbody>
+        {{if .HasParent}}<tr><td colspan="4"><a href="{{.ParentPath}}">↑ 返回上级</a></td></tr>{{end}}
+    {{end}}
+{{end}}{{define "row"}}{{if .List.Grid}}
+            <li>{{if .Thumb}}<a href="{{.URL}}?preview=1"><img class="thumb" src="{{.Thumb}}" alt="{{.Name}}" loading="lazy"></a>{{end}}
+                {{template "name" .}}{{if .Size}} <span class="size">{{.Size}}</span>{{end}}{{template "actions" .}}</li>
+{{else}}
+            <tr><td>{{template "name" .}}</td>
+                <td class="size">{{.Size}}</td>
+                <td class="size mtime">{{.MTime}}</td>
+                <td>{{template "actions" .}}</td></tr>
+{{end}}{{end}}{{define "name"}}{{if not .IsDir}}<input type="checkbox" name="path" value="{{.Path}}" form="zip-selected"> {{end}}<a href="{{.URL}}">
+                {{if .IsDir}}<dir>📁 {{.Name}}</dir>
+                {{else}}<file>📄 {{.Name}}</file>{{end}}
+            </a>{{if .List.Details}} <span class="size">{{.Mode}} {{.Owner}}{{if .Group}}:{{.Group}}{{end}}</span>{{end}}{{end}}{{define "actions"}}{{if not .IsDir}} <a class="verify" href="{{.URL}}?inline=1" target="_blank">打开</a> <a class="verify" href="{{.URL}}?preview=1">预览</a> <a class="verify" href="{{.URL}}?checksum=sha256">校验</a>
+            <button class="copy" type="button" data-link="{{.AbsURL}}" onclick="copyLink(this)">复制链接</button>{{end}}
+            {{if .List.CanShare}}<button class="move" type="button" data-path="{{.Path}}" onclick="shareLink(this)">分享24小时</button>{{end}}
+            {{if .List.Writable}}<form class="inline" method="post" action="{{.List.Base}}/_nfs/delete" onsubmit="return confirm('确定删除吗？')">
+                <input type="hidden" name="path" value="{{.Path}}">
+                <button class="delete" type="submit">删除</button>
+            </form>
+            <form class="inline" method="post" action="{{.List.Base}}/_nfs/move" onsubmit="return askMove(this)">
+                <input type="hidden" name="path" value="{{.Path}}">
+                <input type="hidden" name="to">
+                <button class="move" type="submit">重命名/移动</button>
+            </form>{{end}}{{end}}{{define "footer"}}
+    {{if .Grid}}</ul>{{else}}</tbody></table>{{end}}
+    <script>
+        // 局域网 http 页面不是安全上下文，没有 Clipboard API 时退回 execCommand
+        function copyLink(btn) {
+            var link = btn.dataset.link;
+            var done = function() { btn.textContent = "已复制"; };
+            if (navigator.clipboard && window.isSecureContext) {
+                navigator.clipboard.writeText(link).then(done);
+                return;
+            }
+            var input = document.createElement("textarea");
+            input.value = link;
+            document.body.appendChild(input);
+            input.select();
+            if (document.execCommand("copy")) { done(); }
+            document.body.removeChild(input);
+        }
+        {{if .CanShare}}// 生成 24 小时有效的签名链接，拿到链接的人不需要密码，只能访问这一个文件或文件夹
+        function shareLink(btn) {
+            fetch({{.Base}} + "/_nfs/share?ttl=24h&path=" + encodeURIComponent(btn.dataset.path)).then(function(resp) {
+                return resp.text().then(function(text) {
+                    if (!resp.ok) { throw new Error(text); }
+                    btn.dataset.link = text.trim();
+                    copyLink(btn);
+                    prompt("24小时内有效的分享链接：", btn.dataset.link);
+                });
+            }).catch(function(err) { alert("生成分享链接失败：" + err.message); });
+        }
+        {{end}}{{if .Writable}}// 大文件分块上传。上传 ID 由服务器生成并记在 localStorage 里，断线后重新选择同一文件即可从缺少的分块继续
+        var chunkSize = 8 << 20;
+        async function createUpload(file, total, overwrite) {
+            var query = new URLSearchParams({dir: {{.Dir}}, name: file.name, total: total, overwrite: overwrite});
+            return fetch({{.Base}} + "/_nfs/upload/create?" + query, {method: "POST"});
+        }
+        async function uploadFiles() {
+            var progress = document.getElementById("upload-progress");
+            for (var file of document.getElementById("upload-file").files) {
+                var total = Math.max(1, Math.ceil(file.size / chunkSize));
+                var key = "nfs-upload:" + {{.Dir}} + "/" + file.name + ":" + file.size + ":" + file.lastModified;
+                var id = localStorage.getItem(key), done = new Set();
+                if (id) {
+                    var resp = await fetch({{.Base}} + "/_nfs/upload/status?id=" + id);
+                    if (resp.ok) { done = new Set((await resp.json()).received); } else { id = null; }
+                }
+                if (!id) {
+                    var resp = await createUpload(file, total, 0);
+                    if (resp.status == 409 && confirm(file.name + " 已存在，是否覆盖？")) {
+                        resp = await createUpload(file, total, 1);
+                    }
+                    if (!resp.ok) { progress.textContent = file.name + " 上传失败：" + await resp.text(); return; }
+                    id = (await resp.json()).id;
+                    localStorage.setItem(key, id);
+                }
+                for (var i = 0; i < total; i++) {
+                    if (done.has(i)) { continue; }
+                    var resp = await fetch({{.Base}} + "/_nfs/upload/chunk?id=" + id + "&index=" + i, {method: "POST", body: file.slice(i * chunkSize, (i + 1) * chunkSize)});
+                    if (!resp.ok) { progress.textContent = file.name + " 上传失败：" + await resp.text(); return; }
+                    progress.textContent = file.name + " " + Math.round((i + 1) * 100 / total) + "%";
+                }
+                localStorage.removeItem(key);
+            }
+            location.reload();
+        }
+        // 输入新路径：只改文件名是重命名，改前面的文件夹是移动
+        function askMove(form) {
+            var from = form.elements.path.value;
+            var to = prompt("新的路径(相对共享目录)：", from);
+            if (!to || to == from) { return false; }
+            form.elements.to.value = to;
+            return true;
+        }
+        {{end}}// 目录内容变化时服务器推送 change 事件，自动刷新列表
+        if (window.EventSource) {
+            new EventSource({{.Base}} + "/_nfs/events?path=" + encodeURIComponent({{.Dir}})).addEventListener("change", function() {
+                location.reload();
+            });
+        }
+    </script>
+    {{if .Paged}}<p class="pager">
+        {{if .HasPrev}}<a href="?page={{.PrevPage}}&per={{.Per}}&sort={{.Sort}}&order={{.Order}}">← 上一页</a>{{end}}
+        {{if .HasNext}}<a href="?page={{.NextPage}}&per={{.Per}}&sort={{.Sort}}&order={{.Order}}">下一页 →</a>{{end}}
+    </p>{{end}}
+    {{if .TotalSize}}<p class="total">{{.DirCount}} 个文件夹，{{.FileCount}} 个文件，共 {{.TotalSize}}</p>{{end}}
+    <p class="total"><a href="{{.Base}}/_nfs/stats">下载统计</a></p>
+</body>
+</html>
+{{end}}`))
+
+// DirListData 是目录列表模板可以使用的全部字段，自定义模板(-template)也按此取值
+type DirListData struct {
+	RelPath    string      // 当前目录相对共享根目录的路径（已转义，用于显示）
+	Dir        string      // 当前目录的相对路径（"/"分隔，用于表单）
+	Writable   bool        // 是否开启了 -writable
+	CanShare   bool        // 当前请求能否生成限时分享链接
+	ShareURL   string      // 局域网访问地址，根目录页面显示它的二维码
+	ParentPath string      // 上级目录链接
+	HasParent  bool        // 是否显示"返回上级"
+	Files      []FileEntry // 当前页的条目
+	Total      int         // 目录下条目总数
+	Paged      bool        // 是否分页
+	Page       int         // 当前页码，从1开始
+	Pages      int         // 总页数
+	Per        int         // 每页条目数
+	HasPrev    bool
+	HasNext    bool
+	PrevPage   int
+	NextPage   int
+	ShowSizes  bool   // 是否计算了文件夹的总大小(?sizes=1)
+	BaseURL    string // 根据请求推断的站点地址，如 http://192.168.1.42:8080
+	Grid       bool   // 缩略图视图(?view=grid)
+	Base       string // 站点路径前缀(-base-url)，站内链接都以它开头
+	DirCount   int    // 当前目录下的文件夹数（不分页）
+	FileCount  int    // 当前目录下的文件数（不分页）
+	TotalSize  string // 当前目录下文件的总大小，不含子文件夹的内容
+	Details    bool   // 是否显示权限和所有者(?details=1)
+
+	Sort      string     // 排序字段(?sort=)：name、size 或 mtime
+	Order     string     // asc 或 desc(?order=)
+	SortLinks []sortLink // 页面上切换排序的链接
+
+	// Readme 是 -render-readme 时目录下 README 的渲染结果(已转义)
+	Readme template.HTML
+}
+
+// FileEntry 是目录列表中的一个条目
+type FileEntry struct {
+	URL    string // 已编码的链接
+	Name   string // 显示用的文件名
+	Path   string // 相对共享根目录的路径（"/"分隔）
+	IsDir  bool
+	Size   string // 可读的大小，文件夹只在 ?sizes=1 时计算
+	MTime  string // 修改时间，如 2024-05-01 13:45
+	AbsURL string // 带协议和主机的完整链接，用于复制分享
+	Thumb  string // 缩略图视图下图片的缩略图链接
+	Mode   string // 权限，如 -rw-r--r--，只在 ?details=1 时填写
+	Owner  string // 所有者和所属组，Windows 上为空
+	Group  string
+}
+
+// requestBaseURL 根据请求推断浏览器看到的站点地址；
+// 位于反向代理之后时优先使用代理传来的 X-Forwarded-Proto/X-Forwarded-Host
+func (s *Server) requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme, _, _ = strings.Cut(proto, ",")
+	}
+	host := r.Host
+	if fwdHost := r.Header.Get("X-Forwarded-Host"); fwdHost != "" {
+		host, _, _ = strings.Cut(fwdHost, ",")
+	}
+	return strings.TrimSpace(scheme) + "://" + strings.TrimSpace(host) + s.basePath
+}
+
+// serveIndexFile 按 -index-files 的顺序查找目录下的默认文档，找到第一个就在浏览器中直接显示，
+// 返回 true；都不存在(或被隐藏、扩展名不允许)时返回 false，由调用方显示目录列表
+func (s *Server) serveIndexFile(w http.ResponseWriter, r *http.Request, dirPath string) bool {
+	if len(s.indexFiles) == 0 {
+		return false
+	}
+	hidePatterns := readHideFile(dirPath)
+	for _, name := range s.indexFiles {
+		// 首页文件是符号链接时同样不能指向共享目录以外
+		p := filepath.Join(dirPath, name)
+		if matchHidden(hidePatterns, name) || !s.extAllowed(name) || !s.linkConfined(p) {
+			continue
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+		if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		// 和 ?inline=1 打开网页一样放进沙箱，index.html 里的脚本不能以本站身份发请求
+		if activeContent(s.detectContentType(file)) {
+			w.Header().Set("Content-Security-Policy", "sandbox")
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		s.sendFileAs(w, r, file, name, "inline")
+		return true
+	}
+	return false
+}
+
+// parentDir 返回上级目录的相对路径("/"分隔)，顶层目录的上级是共享根目录，返回空字符串；
+// relPath 本身就是根目录("" 或 ".")时没有上级，ok 为 false
+func parentDir(relPath string) (parent string, ok bool) {
+	rel := path.Clean(filepath.ToSlash(relPath))
+	if rel == "." || rel == "/" || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	parent = path.Dir(strings.TrimPrefix(rel, "/"))
+	if parent == "." {
+		parent = ""
+	}
+	return parent, true
+}
+
+func (s *Server) listDir(w http.ResponseWriter, r *http.Request, dirPath string, relPath string) {
+	asJSON := wantsJSON(r)
+	w.Header().Add("Vary", "Accept") // 同一地址按 Accept 返回 HTML 或 JSON
+	if !asJSON && s.serveIndexFile(w, r, dirPath) {
+		return
+	}
+
+	files, err := os.ReadDir(dirPath)
+	if err != nil {
+		log.Printf("读取目录失败: %v", err)
+		s.renderFSError(w, r, err)
+		return
+	}
+
+	hidePatterns := readHideFile(dirPath)
+	visible := files[:0]
+	for _, file := range files {
+		if matchHidden(hidePatterns, file.Name()) {
+			continue
+		}
+		if file.Type()&fs.ModeSymlink != 0 && !s.linkConfined(filepath.Join(dirPath, file.Name())) {
+			continue // 点进去也是403，不必列出
+		}
+		if file.IsDir() || s.extAllowed(file.Name()) {
+			visible = append(visible, file)
+		}
+	}
+	files = visible
+	sortKey, order := sortParams(r)
+	sortDirEntries(files, sortKey, order == "desc")
+
+	if asJSON {
+		s.sendDirJSON(w, r, dirPath, relPath, files)
+		return
+	}
+
+	parentURL := ""
+	parent, hasParent := parentDir(relPath)
+	if hasParent {
+		parentURL = s.dirURL(parent)
+	}
+
+	data := DirListData{
+		RelPath:    html.EscapeString(relPath),
+		Dir:        filepath.ToSlash(relPath),
+		Writable:   s.cfg.Writable,
+		CanShare:   s.canShare(r),
+		ShareURL:   s.shareURL,
+		HasParent:  hasParent,
+		ParentPath: parentURL, // 父路径URL编码
+		Total:      len(files),
+		BaseURL:    s.requestBaseURL(r),
+		Base:       s.basePath,
+		Sort:       sortKey,
+		Order:      order,
+		SortLinks:  sortLinks(sortKey, order),
+	}
+	if s.cfg.RenderReadme {
+		data.Readme = dirReadme(dirPath, files)
+	}
+
+	query := r.URL.Query()
+	data.Grid = query.Get("view") == "grid"
+	data.Details = query.Get("details") == "1"
+	data.ShowSizes = query.Get("sizes") == "1"
+
+	// 汇总整个目录（不只是当前页），只统计直接包含的文件，不递归。
+	// 分页时先统计全部条目；不分页时在逐行输出的同时统计，不为此多遍历一遍
+	var sum dirSummary
+	all := files
+
+	// 分页：上面已按文件名排序，直接截取当前页的窗口
+	per := s.cfg.PageSize
+	if v, err := strconv.Atoi(r.URL.Query().Get("per")); err == nil && v > 0 {
+		per = v
+	}
+	if per > 0 {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start, end, page, pages := paginate(len(files), page, per)
+		files = files[start:end]
+		data.Paged = true
+		data.Page = page
+		data.Pages = pages
+		data.Per = per
+		data.HasPrev = page > 1
+		data.HasNext = page < pages
+		data.PrevPage = page - 1
+		data.NextPage = page + 1
+	}
+	if data.Paged {
+		for _, file := range all {
+			sum.add(file)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// 内置模板逐行输出；自定义模板(-template)和需要并发统计文件夹大小时，先生成全部条目再渲染
+	if s.cfg.Template == "" && !data.ShowSizes {
+		if r.Method == http.MethodHead {
+			return
+		}
+		s.streamDirList(w, &data, files, relPath, &sum)
+		return
+	}
+
+	for _, file := range files {
+		entry := s.newFileEntry(relPath, data.BaseURL, file)
+		s.decorateEntry(&entry, &data, file)
+		if !data.Paged {
+			sum.add(file)
+		}
+		data.Files = append(data.Files, entry)
+	}
+	sum.fill(&data)
+
+	if data.ShowSizes {
+		s.fillDirSizes(dirPath, data.Files)
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := s.listTemplate.Execute(w, data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
+
+// streamRowsPerFlush 是逐行输出目录列表时每隔多少行刷新一次，让浏览器尽早开始显示
+const streamRowsPerFlush = 256
+
+// streamDirList 依次执行内置模板的 header、每个条目的 row 和 footer，边生成边发送：
+// 第一个字节很快送达，内存占用也不随条目数增长
+func (s *Server) streamDirList(w http.ResponseWriter, data *DirListData, files []os.DirEntry, relPath string, sum *dirSummary) {
+	rc := http.NewResponseController(w)
+	if err := s.listTemplate.ExecuteTemplate(w, "header", data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+		return
+	}
+	for i, file := range files {
+		entry := s.newFileEntry(relPath, data.BaseURL, file)
+		s.decorateEntry(&entry, data, file)
+		if !data.Paged {
+			sum.add(file)
+		}
+		if err := s.listTemplate.ExecuteTemplate(w, "row", listRow{entry, data}); err != nil {
+			log.Printf("模板渲染失败: %v", err)
+			return
+		}
+		if (i+1)%streamRowsPerFlush == 0 {
+			rc.Flush()
+		}
+	}
+	sum.fill(data)
+	if err := s.listTemplate.ExecuteTemplate(w, "footer", data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
+
+// listRow 是模板 row 部分的数据：条目本身，加上整个页面的数据(Writable、Base 等)
+type listRow struct {
+	FileEntry
+	List *DirListData
+}
+
+func newListRow(entry FileEntry, data DirListData) listRow {
+	return listRow{entry, &data}
+}
+
+// dirSummary 统计目录直接包含的文件夹数、文件数和文件总大小
+type dirSummary struct {
+	dirs, files int
+	bytes       int64
+}
+
+func (s *dirSummary) add(file os.DirEntry) {
+	if file.IsDir() {
+		s.dirs++
+	} else if info, err := file.Info(); err == nil {
+		s.files++
+		s.bytes += info.Size()
+	}
+}
+
+func (s *dirSummary) fill(data *DirListData) {
+	data.DirCount = s.dirs
+	data.FileCount = s.files
+	data.TotalSize = humanizeBytes(s.bytes)
+}
+
+// newFileEntry 生成目录列表中的一个条目
+func (s *Server) newFileEntry(relPath, baseURL string, file os.DirEntry) FileEntry {
+	name := file.Name()
+	// 对文件名进行URL编码，但显示时保持原样
+	urlPath := s.siteURL(filepath.ToSlash(filepath.Join(relPath, name)))
+	if file.IsDir() {
+		urlPath = s.dirURL(filepath.ToSlash(filepath.Join(relPath, name)))
+	}
+	entry := FileEntry{
+		URL:   urlPath,                 // 直接使用编码后的URL
+		Name:  html.EscapeString(name), // 显示时转义HTML
+		Path:  filepath.ToSlash(filepath.Join(relPath, name)),
+		IsDir: file.IsDir(),
+		// 按路径段编码，保留"/"
+		AbsURL: baseURL + strings.TrimPrefix(urlPath, s.basePath),
+	}
+	if info, err := file.Info(); err == nil {
+		entry.MTime = info.ModTime().Format("2006-01-02 15:04")
+		if !file.IsDir() {
+			entry.Size = humanizeBytes(info.Size())
+		}
+	}
+	return entry
+}
+
+// wantsJSON 判断目录请求是否要 JSON 列表：?format=json，或 Accept 里最优先的类型是 application/json
+// (浏览器的 Accept 以 text/html 开头，不受影响)
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	first, _, _ := strings.Cut(r.Header.Get("Accept"), ",")
+	mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(first))
+	return mediaType == "application/json"
+}
+
+// jsonEntry 是 JSON 目录列表中的一项
+type jsonEntry struct {
+	Name  string    `json:"name"`
+	Path  string    `json:"path"` // 相对共享根目录的路径，"/"分隔
+	URL   string    `json:"url"`
+	IsDir bool      `json:"isDir"`
+	Size  int64     `json:"size"` // 文件夹为0
+	MTime time.Time `json:"mtime"`
+	MIME  string    `json:"mime,omitempty"`
+}
+
+// sendDirJSON 以 JSON 返回目录内容，供脚本和 App 使用。不分页，符号链接按目标的类型和大小返回，
+// MIME 类型只按扩展名判断，不为此打开每个文件
+func (s *Server) sendDirJSON(w http.ResponseWriter, r *http.Request, dirPath, relPath string, files []os.DirEntry) {
+	entries := make([]jsonEntry, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(dirPath, file.Name()))
+		if err != nil {
+			continue // 失效的链接
+		}
+		p := filepath.ToSlash(filepath.Join(relPath, file.Name()))
+		entry := jsonEntry{Name: file.Name(), Path: p, URL: s.siteURL(p), IsDir: info.IsDir(), MTime: info.ModTime().UTC()}
+		if info.IsDir() {
+			entry.URL = s.dirURL(p)
+		} else {
+			entry.Size = info.Size()
+			entry.MIME = s.mimeByName(file.Name())
+		}
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Path    string      `json:"path"`
+		Entries []jsonEntry `json:"entries"`
+	}{filepath.ToSlash(relPath), entries})
+}
+
+// decorateEntry 按页面选项补充条目的缩略图(?view=grid)和权限、所有者(?details=1)
+func (s *Server) decorateEntry(entry *FileEntry, data *DirListData, file os.DirEntry) {
+	if data.Grid && !entry.IsDir && thumbnailable(entry.Path) {
+		entry.Thumb = s.basePath + "/_nfs/thumb?w=200&path=" + url.QueryEscape(entry.Path)
+	}
+	if data.Details {
+		if info, err := file.Info(); err == nil {
+			entry.Mode = info.Mode().String()
+			entry.Owner, entry.Group = s.fileOwner(info)
+		}
+	}
+}
+
+// sortParams 读取 ?sort= 和 ?order=，无效的值按文件名升序处理
+func sortParams(r *http.Request) (key, order string) {
+	key, order = r.URL.Query().Get("sort"), r.URL.Query().Get("order")
+	if key != "size" && key != "mtime" {
+		key = "name"
+	}
+	if order != "desc" {
+		order = "asc"
+	}
+	return key, order
+}
+
+// sortDirEntries 排序目录条目：文件夹总在文件前面，各自按 key 排序，
+// 大小、时间相同时按文件名的自然顺序。desc 只反转 key 的顺序，不改变文件夹在前
+func sortDirEntries(files []os.DirEntry, key string, desc bool) {
+	type sortItem struct {
+		file  os.DirEntry
+		size  int64
+		mtime time.Time
+	}
+	items := make([]sortItem, len(files))
+	for i, file := range files {
+		items[i].file = file
+		if key == "name" {
+			continue
+		}
+		if info, err := file.Info(); err == nil {
+			items[i].mtime = info.ModTime()
+			if !file.IsDir() {
+				items[i].size = info.Size() // 文件夹按大小排序时按名称排列
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.file.IsDir() != b.file.IsDir() {
+			return a.file.IsDir()
+		}
+		cmp := 0
+		switch {
+		case key == "size" && a.size != b.size:
+			cmp = -1
+			if a.size > b.size {
+				cmp = 1
+			}
+		case key == "mtime" && !a.mtime.Equal(b.mtime):
+			cmp = a.mtime.Compare(b.mtime)
+		case naturalLess(a.file.Name(), b.file.Name()):
+			cmp = -1
+		case naturalLess(b.file.Name(), a.file.Name()):
+			cmp = 1
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	for i := range items {
+		files[i] = items[i].file
+	}
+}
+
+// sortLink 是页面上的一个排序链接，点击当前排序的字段时切换升降序
+type sortLink struct {
+	Key, Label string
+	Next       string // 点击后的顺序
+	Arrow      string // 当前排序字段显示 ↑ 或 ↓
+}
+
+func sortLinks(key, order string) []sortLink {
+	links := []sortLink{{Key: "name", Label: "名称"}, {Key: "size", Label: "大小"}, {Key: "mtime", Label: "修改时间"}}
+	for i := range links {
+		l := &links[i]
+		// 大小和时间第一次点击时从大到小、从新到旧
+		l.Next = "asc"
+		if l.Key != "name" {
+			l.Next = "desc"
+		}
+		if l.Key == key {
+			l.Arrow, l.Next = "↑", "desc"
+			if order == "desc" {
+				l.Arrow, l.Next = "↓", "asc"
+			}
+		}
+	}
+	return links
+}
+
+// naturalLess 按"自然顺序"比较文件名：连续的数字按数值比较，file2 排在 file10 前面；
+// 其他字符不区分大小写。数值相同时位数少的(不补零的)在前，完全相同再按原字符串比较，保证顺序稳定
+func naturalLess(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		ca, cb := ra[i], rb[j]
+		if isDigit(ca) && isDigit(cb) {
+			si, sj := i, j
+			for i < len(ra) && isDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && isDigit(rb[j]) {
+				j++
+			}
+			na := strings.TrimLeft(string(ra[si:i]), "0")
+			nb := strings.TrimLeft(string(rb[sj:j]), "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			if i-si != j-sj {
+				return i-si < j-sj
+			}
+			continue
+		}
+		la, lb := unicode.ToLower(ca), unicode.ToLower(cb)
+		if la != lb {
+			return la < lb
+		}
+		i++
+		j++
+	}
+	if len(ra)-i != len(rb)-j {
+		return len(ra)-i < len(rb)-j
+	}
+	return a < b
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// humanizeBytes 把字节数转换为 1.5 KB、2.3 GB 这样的可读形式
+func humanizeBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// paginate 计算第 page 页（从1开始）在 total 个条目中的下标范围，
+// 越界的页码会被修正到第一页或最后一页
+func paginate(total, page, per int) (start, end, curPage, pages int) {
+	pages = (total + per - 1) / per
+	if pages < 1 {
+		pages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+	start = (page - 1) * per
+	end = start + per
+	if end > total {
+		end = total
+	}
+	return start, end, page, pages
+}
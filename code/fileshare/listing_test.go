@@ -0,0 +1,552 @@
+package fileshare
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		total, page, per           int
+		start, end, curPage, pages int
+	}{
+		{0, 1, 10, 0, 0, 1, 1},
+		{10, 1, 10, 0, 10, 1, 1},  // 正好一页
+		{11, 1, 10, 0, 10, 1, 2},  // 多出一项
+		{11, 2, 10, 10, 11, 2, 2}, // 最后一页只有一项
+		{25, 3, 10, 20, 25, 3, 3}, // 最后一页不满
+		{20, 2, 10, 10, 20, 2, 2}, // 最后一页正好满
+		{25, 9, 10, 20, 25, 3, 3}, // 超出范围退到最后一页
+		{25, 0, 10, 0, 10, 1, 3},  // 小于1退到第一页
+		{25, -4, 10, 0, 10, 1, 3},
+	}
+	for _, tt := range tests {
+		start, end, curPage, pages := paginate(tt.total, tt.page, tt.per)
+		if start != tt.start || end != tt.end || curPage != tt.curPage || pages != tt.pages {
+			t.Errorf("paginate(%d, %d, %d) = %d, %d, %d, %d, 应为 %d, %d, %d, %d",
+				tt.total, tt.page, tt.per, start, end, curPage, pages, tt.start, tt.end, tt.curPage, tt.pages)
+		}
+	}
+}
+
+func TestListingPages(t *testing.T) {
+	files := map[string]string{}
+	for i := 1; i <= 5; i++ {
+		files[fmt.Sprintf("f%d.txt", i)] = "x"
+	}
+	s, _ := newTestServer(t, Config{PageSize: 2}, files)
+	h := s.Handler()
+
+	for page, want := range map[int][]string{1: {"f1.txt", "f2.txt"}, 2: {"f3.txt", "f4.txt"}, 3: {"f5.txt"}} {
+		body := do(t, h, "GET", fmt.Sprintf("/?page=%d", page), nil).Body.String()
+		if n := strings.Count(body, `form="zip-selected"`); n != len(want) {
+			t.Errorf("第 %d 页有 %d 项，应为 %d", page, n, len(want))
+		}
+		for _, name := range want {
+			if !strings.Contains(body, `value="`+name+`"`) {
+				t.Errorf("第 %d 页缺少 %s", page, name)
+			}
+		}
+		if !strings.Contains(body, fmt.Sprintf("第 %d/3 页", page)) {
+			t.Errorf("第 %d 页没有显示页码", page)
+		}
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	tmpl := writeConfig(t, "list.html", `<p>{{.Dir}}|{{range .Files}}{{.Name}}{{if .IsDir}}/{{end}};{{end}}|{{.Total}}</p>`)
+	s, _ := newTestServer(t, Config{Template: tmpl}, map[string]string{"docs/a.txt": "a", "docs/b.txt": "b", "docs/sub/c.txt": "c"})
+
+	rec := do(t, s.Handler(), "GET", "/docs/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /docs/ = %d", rec.Code)
+	}
+	const want = "<p>docs|sub/;a.txt;b.txt;|3</p>"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("自定义模板输出 %q, 应为 %q", got, want)
+	}
+}
+
+func TestCustomTemplateMustParse(t *testing.T) {
+	for _, tmpl := range []string{
+		writeConfig(t, "bad.html", `{{range .Files}}`),
+		filepath.Join(t.TempDir(), "missing.html"),
+	} {
+		_, err := New(Config{Dirs: []string{t.TempDir()}, Template: tmpl})
+		if err == nil || !strings.Contains(err.Error(), "加载模板失败") {
+			t.Errorf("%s: 错误为 %v，应启动失败", tmpl, err)
+		}
+	}
+}
+
+// 目录列表、预览、搜索和错误页都适配手机屏幕和深色模式
+func TestPagesResponsiveAndDarkMode(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"docs/a.txt": "a"})
+	h := s.Handler()
+	for _, target := range []string{"/", "/docs/", "/docs/a.txt?preview=1", "/_nfs/search?q=a", "/missing"} {
+		body := do(t, h, "GET", target, nil, "Accept", "text/html").Body.String()
+		if !strings.Contains(body, `<meta name="viewport" content="width=device-width, initial-scale=1">`) {
+			t.Errorf("%s: 没有 viewport meta 标签", target)
+		}
+		if !strings.Contains(body, "@media (prefers-color-scheme: dark)") {
+			t.Errorf("%s: 没有深色模式样式", target)
+		}
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{
+		"tree/a.bin":           strings.Repeat("a", 100),
+		"tree/sub/b.bin":       strings.Repeat("b", 1000),
+		"tree/sub/deep/c.bin":  strings.Repeat("c", 24),
+		"tree/sub/deep/d/e.go": "",
+		"tree/empty/.keep":     "",
+		"other.bin":            strings.Repeat("x", 5000),
+	})
+	tree := filepath.Join(root, "tree")
+	for dir, want := range map[string]int64{"tree": 1124, "tree/sub": 1024, "tree/sub/deep": 24, "tree/empty": 0} {
+		if got, err := s.dirSize(filepath.Join(root, dir)); err != nil || got != want {
+			t.Errorf("dirSize(%s) = %d, %v, 应为 %d", dir, got, err, want)
+		}
+	}
+
+	// 缓存有效期内新增的文件不影响结果，过期后重新统计
+	writeFiles(t, root, map[string]string{"tree/new.bin": strings.Repeat("n", 76)})
+	if got, _ := s.dirSize(tree); got != 1124 {
+		t.Errorf("缓存有效期内 dirSize = %d, 应仍为 1124", got)
+	}
+	entry, _ := s.dirSizes.get(tree)
+	entry.at = entry.at.Add(-dirSizeTTL)
+	s.dirSizes.put(tree, entry)
+	if got, _ := s.dirSize(tree); got != 1200 {
+		t.Errorf("缓存过期后 dirSize = %d, 应为 1200", got)
+	}
+}
+
+func TestListingDirSizes(t *testing.T) {
+	tmpl := writeConfig(t, "sizes.html", `{{range .Files}}{{.Name}}={{.Size}};{{end}}`)
+	s, _ := newTestServer(t, Config{Template: tmpl}, map[string]string{
+		"big/a.bin":   strings.Repeat("a", 2048),
+		"big/s/b.bin": strings.Repeat("b", 1024),
+		"small/c.txt": "ccc",
+		"f.txt":       "f",
+	})
+	h := s.Handler()
+	if got := do(t, h, "GET", "/?sizes=1", nil).Body.String(); got != "big=3.0 KB;small=3 B;f.txt=1 B;" {
+		t.Errorf("?sizes=1 列表为 %q", got)
+	}
+	// 默认不统计文件夹大小
+	if got := do(t, h, "GET", "/", nil).Body.String(); strings.Contains(got, "KB") {
+		t.Errorf("默认列表统计了文件夹大小: %q", got)
+	}
+}
+
+func TestParentDir(t *testing.T) {
+	tests := []struct {
+		rel, parent string
+		ok          bool
+	}{
+		{"", "", false},
+		{".", "", false},
+		{"/", "", false},
+		{"..", "", false},
+		{"../etc", "", false},
+		{"docs", "", true},
+		{"docs/", "", true},
+		{"/docs", "", true},
+		{"docs/2024/photos", "docs/2024", true},
+		{"docs/./2024//photos/", "docs/2024", true},
+	}
+	for _, tt := range tests {
+		parent, ok := parentDir(tt.rel)
+		if parent != tt.parent || ok != tt.ok {
+			t.Errorf("parentDir(%q) = %q, %v, 应为 %q, %v", tt.rel, parent, ok, tt.parent, tt.ok)
+		}
+	}
+}
+
+// 根目录没有"返回上级"，一级目录返回根目录，多级目录返回上一级，加 -base-url 前缀后同样如此
+func TestListingParentLink(t *testing.T) {
+	files := map[string]string{"docs/2024/photos/a.jpg": "x"}
+	for _, base := range []string{"", "/nfs"} {
+		s, _ := newTestServer(t, Config{BaseURL: base}, files)
+		h := s.Handler()
+		for target, want := range map[string]string{
+			base + "/docs/":                 base + "/",
+			base + "/docs/2024/photos/":     base + "/docs/2024/",
+			base + "/docs/2024/photos/?a=1": base + "/docs/2024/",
+		} {
+			body := do(t, h, "GET", target, nil).Body.String()
+			if !strings.Contains(body, `<a href="`+want+`">↑ 返回上级</a>`) {
+				t.Errorf("GET %s: 返回上级的链接应为 %s", target, want)
+			}
+		}
+		body := do(t, h, "GET", base+"/", nil).Body.String()
+		if strings.Contains(body, "返回上级") {
+			t.Errorf("GET %s/: 根目录不应有返回上级的链接", base)
+		}
+	}
+}
+
+func TestListingAbsoluteLinks(t *testing.T) {
+	files := map[string]string{"docs/my file.txt": "x"}
+	plain, _ := newTestServer(t, Config{}, files)
+	prefixed, _ := newTestServer(t, Config{BaseURL: "/nfs"}, files)
+
+	tests := []struct {
+		s      *Server
+		target string
+		header []string
+		want   string
+	}{
+		{plain, "http://files.lan:8080/docs/", nil, "http://files.lan:8080/docs/my%20file.txt"},
+		{plain, "https://files.lan/docs/", nil, "https://files.lan/docs/my%20file.txt"},
+		{plain, "http://127.0.0.1:8080/docs/", []string{"X-Forwarded-Proto", "https", "X-Forwarded-Host", "share.example.com, proxy.lan"}, "https://share.example.com/docs/my%20file.txt"},
+		{prefixed, "http://files.lan:8080/nfs/docs/", nil, "http://files.lan:8080/nfs/docs/my%20file.txt"},
+	}
+	for _, tt := range tests {
+		body := do(t, tt.s.Handler(), "GET", tt.target, nil, tt.header...).Body.String()
+		if !strings.Contains(body, `data-link="`+tt.want+`"`) {
+			t.Errorf("GET %s %v: 页面中没有完整链接 %s", tt.target, tt.header, tt.want)
+		}
+	}
+}
+
+func TestRenderFSErrorStatus(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, nil)
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&fs.PathError{Op: "open", Path: "x", Err: fs.ErrNotExist}, http.StatusNotFound},
+		{&fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}, http.StatusForbidden},
+		{fmt.Errorf("读取目录: %w", fs.ErrPermission), http.StatusForbidden},
+		{errors.New("input/output error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.renderFSError(rec, httptest.NewRequest("GET", "/", nil), tt.err)
+		if rec.Code != tt.want {
+			t.Errorf("%v: 状态码 %d, 应为 %d", tt.err, rec.Code, tt.want)
+		}
+	}
+}
+
+// 没有读取权限的目录返回403而不是500
+func TestListingPermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 不支持用权限位禁止读取目录")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root 不受目录权限限制")
+	}
+	s, root := newTestServer(t, Config{}, map[string]string{"locked/a.txt": "a"})
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	for _, target := range []string{"/locked/", "/locked/a.txt"} {
+		if rec := do(t, s.Handler(), "GET", target, nil, "Accept", "text/html"); rec.Code != http.StatusForbidden {
+			t.Errorf("GET %s = %d, 应为403", target, rec.Code)
+		}
+	}
+}
+
+func TestListingSummary(t *testing.T) {
+	s, _ := newTestServer(t, Config{PageSize: 2}, map[string]string{
+		"docs/a.bin":        strings.Repeat("a", 1024),
+		"docs/b.bin":        strings.Repeat("b", 512),
+		"docs/c.txt":        "",
+		"docs/sub1/big.bin": strings.Repeat("x", 10000), // 子文件夹的内容不计入
+		"docs/sub2/.keep":   "",
+		"empty/.keep":       "",
+	})
+	h := s.Handler()
+	// 分页不影响统计，每一页都显示整个目录的汇总
+	for _, target := range []string{"/docs/", "/docs/?page=3"} {
+		body := do(t, h, "GET", target, nil).Body.String()
+		if want := "2 个文件夹，3 个文件，共 1.5 KB"; !strings.Contains(body, want) {
+			t.Errorf("GET %s: 页脚中没有 %q", target, want)
+		}
+	}
+	if body := do(t, h, "GET", "/", nil).Body.String(); !strings.Contains(body, "2 个文件夹，0 个文件，共 0 B") {
+		t.Error("只有文件夹的目录汇总不对")
+	}
+
+	tmpl := writeConfig(t, "summary.html", `{{.DirCount}}/{{.FileCount}}/{{.TotalSize}}`)
+	custom, _ := newTestServer(t, Config{Template: tmpl}, map[string]string{"a/x": "12345", "b/.keep": "", "c.txt": "abc"})
+	if got := do(t, custom.Handler(), "GET", "/", nil).Body.String(); got != "2/1/3 B" {
+		t.Errorf("模板中的汇总为 %q, 应为 2/1/3 B", got)
+	}
+}
+
+// 目录统一以 / 结尾、文件不带 /，另一种写法 301 重定向过去并保留查询参数
+func TestTrailingSlashRedirect(t *testing.T) {
+	files := map[string]string{"photos/2024 夏天/a.jpg": "jpg", "photos/b.txt": "b"}
+	plain, _ := newTestServer(t, Config{}, files)
+	prefixed, _ := newTestServer(t, Config{BaseURL: "/nfs"}, files)
+
+	tests := []struct {
+		s            *Server
+		target, want string
+	}{
+		{plain, "/photos", "/photos/"},
+		{plain, "/photos?sort=size&order=desc", "/photos/?sort=size&order=desc"},
+		{plain, "/photos/2024%20%E5%A4%8F%E5%A4%A9", "/photos/2024%20%E5%A4%8F%E5%A4%A9/"},
+		{plain, "/photos/b.txt/", "/photos/b.txt"},
+		{plain, "/photos/b.txt/?checksum=sha256", "/photos/b.txt?checksum=sha256"},
+		{prefixed, "/nfs/photos", "/nfs/photos/"},
+		{prefixed, "/nfs/photos/b.txt/", "/nfs/photos/b.txt"},
+	}
+	for _, tt := range tests {
+		rec := do(t, tt.s.Handler(), "GET", tt.target, nil)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("GET %s = %d %q, 应重定向到 %s", tt.target, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+
+	h := plain.Handler()
+	for _, target := range []string{"/", "/photos/", "/photos/b.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, 应为200", target, rec.Code)
+		}
+	}
+	if rec := do(t, h, "GET", "/missing/", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的路径 GET /missing/ = %d, 应为404", rec.Code)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	want := []string{
+		"9", "10",
+		"a", "a1", "a01", "abc", "b",
+		"file", "file1.txt", "file2.txt", "file02.txt", "file002.txt", "File3.txt", "file10.txt",
+		"img2", "img12a", "img12B", "img12c",
+		"v1.2.9", "v1.2.10", "v1.10.0",
+		"x9y9", "x9y10",
+		"中文1", "中文2", "中文10",
+	}
+	// 比较是严格弱序：前面的小于后面的，反过来不成立
+	for i := range want {
+		for j := range want {
+			if got := naturalLess(want[i], want[j]); got != (i < j) {
+				t.Errorf("naturalLess(%q, %q) = %v", want[i], want[j], got)
+			}
+		}
+	}
+
+	got := []string{}
+	for i := len(want) - 1; i >= 0; i-- {
+		got = append(got, want[(i*7)%len(want)])
+	}
+	sort.Slice(got, func(i, j int) bool { return naturalLess(got[i], got[j]) })
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("排序结果 %q", got)
+	}
+}
+
+func TestListingNaturalOrder(t *testing.T) {
+	tmpl := writeConfig(t, "names.html", `{{range .Files}}{{.Name}} {{end}}`)
+	s, _ := newTestServer(t, Config{Template: tmpl}, map[string]string{
+		"file10.txt": "", "file2.txt": "", "file1.txt": "", "File02.txt": "", "dir10/.keep": "", "dir9/.keep": "",
+	})
+	h := s.Handler()
+	for target, want := range map[string]string{
+		"/":                      "dir9 dir10 file1.txt file2.txt File02.txt file10.txt ",
+		"/?sort=name&order=desc": "dir10 dir9 file10.txt File02.txt file2.txt file1.txt ",
+	} {
+		if got := do(t, h, "GET", target, nil).Body.String(); got != want {
+			t.Errorf("GET %s = %q, 应为 %q", target, got, want)
+		}
+	}
+}
+
+// -index-files 按顺序找第一个存在的默认文档直接显示，都没有时显示目录列表
+func TestIndexFiles(t *testing.T) {
+	files := map[string]string{
+		"site/index.html":         "<h1>index</h1>",
+		"site/default.htm":        "<h1>default</h1>",
+		"alt/default.htm":         "<h1>alt</h1>",
+		"plain/a.txt":             "x",
+		"hidden/index.html":       "<h1>hidden</h1>",
+		"hidden/" + hideFileName:  "index.html\n",
+		"nested/index.html/a.txt": "x", // 同名的是目录
+	}
+	s, _ := newTestServer(t, Config{IndexFiles: []string{" index.html", "default.htm "}}, files)
+	h := s.Handler()
+
+	for target, want := range map[string]string{"/site/": "<h1>index</h1>", "/alt/": "<h1>alt</h1>"} {
+		rec := do(t, h, "GET", target, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q, 应为 %q", target, rec.Code, rec.Body.String(), want)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("GET %s: Content-Type = %q, 应为 text/html", target, ct)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "inline") {
+			t.Errorf("GET %s: Content-Disposition = %q, 应在浏览器中直接显示", target, cd)
+		}
+		// 默认文档中的脚本在沙箱中运行，不能以本站身份发请求
+		if csp := rec.Header().Get("Content-Security-Policy"); csp != "sandbox" {
+			t.Errorf("GET %s: Content-Security-Policy = %q, 应为 sandbox", target, csp)
+		}
+	}
+
+	for _, target := range []string{"/plain/", "/hidden/", "/nested/"} {
+		rec := do(t, h, "GET", target, nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "↑ 返回上级") || strings.Contains(rec.Body.String(), "<h1>hidden</h1>") {
+			t.Errorf("GET %s = %d, 没有默认文档时应显示目录列表", target, rec.Code)
+		}
+	}
+	// 请求 JSON 时仍然返回目录内容
+	if rec := do(t, h, "GET", "/site/", nil, "Accept", "application/json"); !strings.Contains(rec.Body.String(), `"index.html"`) {
+		t.Errorf("GET /site/ Accept: application/json = %q", rec.Body.String())
+	}
+
+	// 不设置 -index-files 时总是显示目录列表
+	plain, _ := newTestServer(t, Config{}, files)
+	if body := do(t, plain.Handler(), "GET", "/site/", nil).Body.String(); body == "<h1>index</h1>" {
+		t.Error("未设置 -index-files 时不应显示默认文档")
+	}
+}
+
+// 内置模板逐行输出的页面和一次执行整个模板的结果相同。
+// 设置 cfg.Template 让 listDir 走整体渲染的路径，模板仍是内置模板
+func TestStreamedListingMatchesTemplate(t *testing.T) {
+	files := map[string]string{"sub/x.txt": "x", "README.md": "# 说明"}
+	for i := 0; i < streamRowsPerFlush+10; i++ {
+		files[fmt.Sprintf("file%03d <&>.txt", i)] = strings.Repeat("x", i)
+	}
+	s, _ := newTestServer(t, Config{RenderReadme: true}, files)
+	h := s.Handler()
+
+	for _, target := range []string{"/", "/?view=grid", "/?details=1", "/?sort=size&order=desc", "/?per=50&page=2", "/sub/"} {
+		streamed := do(t, h, "GET", target, nil).Body.String()
+		s.cfg.Template = "builtin"
+		whole := do(t, h, "GET", target, nil).Body.String()
+		s.cfg.Template = ""
+		if strings.TrimSpace(streamed) != strings.TrimSpace(whole) {
+			t.Errorf("GET %s: 逐行输出的页面与整体渲染不同\n逐行: %.300q\n整体: %.300q", target, streamed, whole)
+		}
+	}
+}
+
+// 对比条目很多的目录逐行输出和整体渲染的耗时与内存
+func BenchmarkListLargeDir(b *testing.B) {
+	const n = 20000
+	root := b.TempDir()
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%05d.txt", i)), nil, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	s, err := New(Config{Dirs: []string{root}, Force: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := s.Handler()
+
+	for _, mode := range []string{"streamed", "whole"} {
+		b.Run(mode, func(b *testing.B) {
+			if mode == "whole" {
+				s.cfg.Template = "builtin"
+				defer func() { s.cfg.Template = "" }()
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(&discardWriter{}, httptest.NewRequest("GET", "/", nil))
+			}
+		})
+	}
+}
+
+func TestEscapeURLPath(t *testing.T) {
+	tests := map[string]string{
+		"/a+b %.txt":  "/a%2Bb%20%25.txt",
+		"/hash#1.txt": "/hash%231.txt",
+		"/q?.txt":     "/q%3F.txt",
+		"/50%off/":    "/50%25off/",
+		"/中文.txt":     "/%E4%B8%AD%E6%96%87.txt",
+	}
+	for in, want := range tests {
+		if got := escapeURLPath(in); got != want {
+			t.Errorf("escapeURLPath(%q) = %q, 应为 %q", in, got, want)
+		}
+	}
+}
+
+// 文件名含 +、%、#、? 和空格时，列表页生成的链接请求回来仍然是同一个文件
+func TestListingTrickyNames(t *testing.T) {
+	files := map[string]string{
+		"a+b %.txt":          "plus-percent",
+		"hash#1.txt":         "hash",
+		"空 格.txt":            "space",
+		"50%off/in+side.txt": "nested",
+		"%2e%2e/x.txt":       "dots", // 已编码的形式不能被解码两次
+	}
+	if runtime.GOOS != "windows" {
+		files["q?.txt"] = "question"
+	}
+	s, _ := newTestServer(t, Config{}, files)
+	h := s.Handler()
+
+	// 从根目录开始顺着列表页中的链接访问，记录每个文件链接返回的内容
+	hrefRe := regexp.MustCompile(`<a href="(/[^"?]*)"`)
+	found := map[string]string{}
+	visited := map[string]bool{}
+	queue := []string{"/"}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		rec := do(t, h, "GET", dir, nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", dir, rec.Code)
+			continue
+		}
+		for _, m := range hrefRe.FindAllStringSubmatch(rec.Body.String(), -1) {
+			link := html.UnescapeString(m[1])
+			if visited[link] || !strings.HasPrefix(link, dir) || link == dir {
+				continue
+			}
+			visited[link] = true
+			if strings.HasSuffix(link, "/") {
+				queue = append(queue, link)
+				continue
+			}
+			rec := do(t, h, "GET", link, nil)
+			found[rec.Body.String()] = link
+		}
+	}
+	for name, content := range files {
+		if _, ok := found[content]; !ok {
+			t.Errorf("%s: 列表页中没有能下载到它的链接, 访问过 %q", name, found)
+		}
+	}
+
+	// 客户端没有编码 + 时也能找到文件，下载的文件名保持原样
+	rec := do(t, h, "GET", "/a+b%20%25.txt", nil)
+	if rec.Body.String() != "plus-percent" {
+		t.Errorf("GET /a+b%%20%%25.txt = %d %q", rec.Code, rec.Body.String())
+	}
+	if _, params, _ := mime.ParseMediaType(rec.Header().Get("Content-Disposition")); params["filename"] != "a+b %.txt" {
+		t.Errorf("Content-Disposition = %q", rec.Header().Get("Content-Disposition"))
+	}
+}
@@ -0,0 +1,84 @@
+package fileshare
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// LogFile 是按大小切割的日志文件：写入后超过 maxSize 时把 app.log 改名为 app.log.1，
+// 原来的 .1 改为 .2，依此类推，只保留 keep 个旧文件
+type LogFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+}
+
+// openRotatingFile 以追加方式打开日志文件
+func openRotatingFile(path string, maxSize int64, keep int) (*LogFile, error) {
+	f := &LogFile{path: path, maxSize: maxSize, keep: keep}
+	if err := f.Reopen(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reopen 关闭并重新打开日志文件。交给 logrotate 切割时(把 -log-max-size 设为 0)，
+// logrotate 改名后调用它，之后的日志写到新建的文件里
+func (f *LogFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.openLocked()
+}
+
+func (f *LogFile) openLocked() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *LogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotateLocked(); err != nil {
+			fmt.Fprintf(os.Stderr, "切割日志文件失败: %v\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotateLocked 依次后移旧文件，超出 keep 的最旧文件被覆盖删除
+func (f *LogFile) rotateLocked() error {
+	if f.keep < 1 {
+		f.file.Close()
+		if err := os.Truncate(f.path, 0); err != nil {
+			return err
+		}
+		return f.openLocked()
+	}
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.keep))
+	for i := f.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	return f.openLocked()
+}
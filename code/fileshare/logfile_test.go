@@ -0,0 +1,166 @@
+package fileshare
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := OpenLogFile(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.file.Close() })
+	line := func(i int) string { return fmt.Sprintf("第 %02d 行 %s\n", i, strings.Repeat("x", 28)) } // 40 字节
+
+	for i := 1; i <= 2; i++ {
+		fmt.Fprint(w, line(i))
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatal("没有超过大小就切割了")
+	}
+	fmt.Fprint(w, line(3)) // 超过 100 字节，先切割再写入
+	if data, err := os.ReadFile(path + ".1"); err != nil || string(data) != line(1)+line(2) {
+		t.Fatalf("app.log.1 = %q, %v", data, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != line(3) {
+		t.Errorf("切割后 app.log = %q", data)
+	}
+
+	// 只保留 2 个旧文件，最旧的被删除
+	for i := 4; i <= 9; i++ {
+		fmt.Fprint(w, line(i))
+	}
+	for name, want := range map[string]string{
+		path:        line(9),
+		path + ".1": line(7) + line(8),
+		path + ".2": line(5) + line(6),
+	} {
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, 应为 %q", filepath.Base(name), data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("保留了超过 keep 个旧文件")
+	}
+}
+
+// logrotate 把日志文件改名后调用 Reopen(main 中收到 SIGHUP 时)，之后的日志写到新建的文件里
+func TestLogFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := OpenLogFile(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.file.Close() })
+	fmt.Fprint(w, "旧文件\n")
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(w, "新文件\n")
+	if data, _ := os.ReadFile(path); string(data) != "新文件\n" {
+		t.Errorf("重新打开后 app.log = %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".old"); string(data) != "旧文件\n" {
+		t.Errorf("改名的旧文件 = %q", data)
+	}
+}
+
+// Server.Reopen 同时重新打开访问日志和审计日志
+func TestServerReopenLogs(t *testing.T) {
+	dir := t.TempDir()
+	accessPath, auditPath := filepath.Join(dir, "access.log"), filepath.Join(dir, "audit.log")
+	s, _ := newTestServer(t, Config{AccessLog: accessPath, AuditLog: auditPath}, map[string]string{"a.txt": "a"})
+	t.Cleanup(func() {
+		s.accessFile.file.Close()
+		s.audit.file.Close()
+	})
+	h := s.Handler()
+	do(t, h, "GET", "/a.txt", nil)
+	for _, p := range []string{accessPath, auditPath} {
+		if err := os.Rename(p, p+".1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	do(t, h, "GET", "/a.txt", nil)
+	for _, p := range []string{accessPath, auditPath} {
+		old, _ := os.ReadFile(p + ".1")
+		cur, err := os.ReadFile(p)
+		if err != nil || strings.Count(string(old), "\n") != 1 || strings.Count(string(cur), "\n") != 1 {
+			t.Errorf("%s: 切割前 %q, 重新打开后 %q, %v", filepath.Base(p), old, cur, err)
+		}
+	}
+}
+
+// clfLine 是 Apache 通用日志格式：host ident user [time] "request" status bytes
+var clfLine = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "(\S+) (\S+) (HTTP/\d\.\d)" (\d{3}) (\d+|-)$`)
+
+func TestAccessLogCLF(t *testing.T) {
+	buf := captureLog(t)
+	s, _ := newTestServer(t, Config{LogFormat: "clf", User: "bob", Password: "secret"}, map[string]string{"a b.txt": "hello"})
+	h := s.Handler()
+
+	send := func(method, target string, auth bool) {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = "192.168.1.7:52100"
+		if auth {
+			req.SetBasicAuth("bob", "secret")
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	before := time.Now().Truncate(time.Second)
+	send("GET", "/a%20b.txt?x=1", true)
+	send("GET", "/missing.txt", true)
+	send("HEAD", "/a%20b.txt", true)
+	send("GET", "/a%20b.txt", false)
+	send("GET", healthPath, false) // 健康检查不记录
+
+	// 其他日志(如打开文件失败)带 log 包的时间前缀，访问日志行以客户端地址开头
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "192.168.1.7 ") {
+			lines = append(lines, line)
+		}
+	}
+	want := []struct {
+		user, method, uri, status, bytes string
+	}{
+		{"bob", "GET", "/a%20b.txt?x=1", "200", "5"},
+		{"bob", "GET", "/missing.txt", "404", ""},
+		{"bob", "HEAD", "/a%20b.txt", "200", "-"},
+		{"-", "GET", "/a%20b.txt", "401", ""},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("有 %d 行访问日志，应为 %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, w := range want {
+		m := clfLine.FindStringSubmatch(lines[i])
+		if m == nil {
+			t.Errorf("第 %d 行不是 CLF 格式: %q", i+1, lines[i])
+			continue
+		}
+		if m[1] != "192.168.1.7" || m[2] != "-" || m[3] != w.user || m[5] != w.method || m[6] != w.uri || m[7] != "HTTP/1.1" || m[8] != w.status {
+			t.Errorf("第 %d 行 = %q", i+1, lines[i])
+		}
+		if w.bytes != "" && m[9] != w.bytes {
+			t.Errorf("第 %d 行字节数为 %s, 应为 %s", i+1, m[9], w.bytes)
+		}
+		ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[4])
+		if err != nil || ts.Before(before) || ts.After(time.Now()) {
+			t.Errorf("第 %d 行时间 %q 无效: %v", i+1, m[4], err)
+		}
+	}
+}
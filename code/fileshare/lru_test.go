@@ -0,0 +1,36 @@
+package fileshare
+
+import (
+	"fmt"
+	"testing"
+)
+
+// 超出容量时丢弃最久没有使用的条目，读取也算使用
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache[int](3)
+	for i := 1; i <= 3; i++ {
+		c.put(fmt.Sprint(i), i)
+	}
+	c.get("1")
+	c.put("4", 4) // 丢弃最久没用的 2
+	for key, want := range map[string]bool{"1": true, "2": false, "3": true, "4": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("get(%s) 存在 = %v, 应为 %v", key, ok, want)
+		}
+	}
+	c.put("3", 30)
+	if v, _ := c.get("3"); v != 30 || c.order.Len() != 3 {
+		t.Errorf("更新后 get(3) = %d, 共 %d 条", v, c.order.Len())
+	}
+}
+
+// 文件夹大小的缓存有上限，大量不同的目录不会让内存无限增长
+func TestDirSizeCacheBounded(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"a/x.txt": "x"})
+	for i := 0; i < dirSizeCacheSize+10; i++ {
+		s.dirSizes.put(fmt.Sprintf("%s/dir%d", root, i), cachedSize{})
+	}
+	if n := s.dirSizes.order.Len(); n != dirSizeCacheSize {
+		t.Errorf("缓存了 %d 个文件夹, 应最多 %d 个", n, dirSizeCacheSize)
+	}
+}
@@ -0,0 +1,239 @@
+package fileshare
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 按 RFC 6762/6763 在局域网组播 224.0.0.251:5353 上应答查询：<名称>.local 的 A 记录，
+// 以及 _http._tcp(开启 -tls 时为 _https._tcp)服务的 PTR、SRV、TXT，
+// 访达、Windows 的网络发现、avahi-browse 等都能直接找到服务器。只用标准库，只支持 IPv4
+
+const (
+	mdnsPort     = 5353
+	mdnsHostTTL  = 120
+	mdnsOtherTTL = 4500
+)
+
+// DNS 记录类型
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+)
+
+// mdnsRecord 是一条资源记录，data 为已编码的 RDATA；flush 表示记录由本机独占(缓存刷新位)
+type mdnsRecord struct {
+	name  string
+	rtype uint16
+	flush bool
+	ttl   uint32
+	data  []byte
+}
+
+// validMDNSName 限制 -mdns 的名称为字母、数字和 -，可以直接作为主机名
+func validMDNSName(name string) bool {
+	if name == "" || len(name) > 63 || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendDNSName 按标签编码域名，不使用压缩
+func appendDNSName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// readDNSName 从 off 开始读取域名(支持压缩指针)，返回域名和紧随其后的位置
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("域名越界")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errors.New("域名压缩指针无效")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = (n&0x3F)<<8 | int(msg[off+1])
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("域名越界")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// mdnsRecords 生成要发布的全部记录，alive 为 false 时 TTL 全部为 0，表示服务下线(goodbye)
+func (s *Server) mdnsRecords(name, ip, port string, alive bool) []mdnsRecord {
+	service := "_http._tcp.local"
+	if s.useTLS {
+		service = "_https._tcp.local"
+	}
+	host := name + ".local"
+	instance := name + "." + service
+	portNum, _ := strconv.Atoi(port)
+
+	srv := binary.BigEndian.AppendUint16(make([]byte, 4), uint16(portNum))
+	srv = appendDNSName(srv, host)
+	txt := "path=" + s.basePath + "/"
+	records := []mdnsRecord{
+		{name: "_services._dns-sd._udp.local", rtype: dnsTypePTR, ttl: mdnsOtherTTL, data: appendDNSName(nil, service)},
+		{name: service, rtype: dnsTypePTR, ttl: mdnsOtherTTL, data: appendDNSName(nil, instance)},
+		{name: instance, rtype: dnsTypeSRV, flush: true, ttl: mdnsHostTTL, data: srv},
+		{name: instance, rtype: dnsTypeTXT, flush: true, ttl: mdnsOtherTTL, data: append([]byte{byte(len(txt))}, txt...)},
+		{name: host, rtype: dnsTypeA, flush: true, ttl: mdnsHostTTL, data: net.ParseIP(ip).To4()},
+	}
+	if !alive {
+		for i := range records {
+			records[i].ttl = 0
+		}
+	}
+	return records
+}
+
+// mdnsMessage 编码应答报文：questions 为原样附带的问题部分(只有普通 DNS 查询需要)
+func mdnsMessage(id uint16, questions []byte, qdcount int, answers, extra []mdnsRecord) []byte {
+	b := make([]byte, 0, 512)
+	for _, v := range []int{int(id), 0x8400, qdcount, len(answers), 0, len(extra)} {
+		b = binary.BigEndian.AppendUint16(b, uint16(v))
+	}
+	b = append(b, questions...)
+	for _, rec := range append(answers, extra...) {
+		class := uint16(1)
+		if rec.flush && questions == nil {
+			class |= 0x8000
+		}
+		b = appendDNSName(b, rec.name)
+		b = binary.BigEndian.AppendUint16(b, rec.rtype)
+		b = binary.BigEndian.AppendUint16(b, class)
+		b = binary.BigEndian.AppendUint32(b, rec.ttl)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(rec.data)))
+		b = append(b, rec.data...)
+	}
+	return b
+}
+
+// mdnsAnswer 解析一个查询报文，返回应答；查询的不是本机的记录时返回 nil
+func mdnsAnswer(query []byte, records []mdnsRecord, legacy bool) []byte {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[2:])&0x8000 != 0 {
+		return nil
+	}
+	qdcount := int(binary.BigEndian.Uint16(query[4:]))
+	off := 12
+	matched := map[int]bool{}
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readDNSName(query, off)
+		if err != nil || next+4 > len(query) {
+			return nil
+		}
+		qtype := binary.BigEndian.Uint16(query[next:])
+		off = next + 4
+		for j, rec := range records {
+			if strings.EqualFold(rec.name, name) && (qtype == dnsTypeANY || qtype == rec.rtype) {
+				matched[j] = true
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	// 其余记录放在附加部分，客户端一次就能拿到地址和端口
+	var answers, extra []mdnsRecord
+	for j, rec := range records {
+		if matched[j] {
+			answers = append(answers, rec)
+		} else if rec.name != "_services._dns-sd._udp.local" {
+			extra = append(extra, rec)
+		}
+	}
+	if !legacy {
+		return mdnsMessage(0, nil, 0, answers, extra)
+	}
+	// 源端口不是 5353 的是普通 DNS 查询(如 dig -p 5353 @224.0.0.251)，
+	// 要带上原来的 ID 和问题，问题紧跟报文头，原样复制后其中的压缩指针仍然有效
+	return mdnsMessage(binary.BigEndian.Uint16(query), query[12:off], qdcount, answers, extra)
+}
+
+// advertiseMDNS 发布 <name>.local 并应答查询，直到服务器退出时发送下线通知
+func (s *Server) advertiseMDNS(name, ip, port string) {
+	group := &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		log.Printf("[mdns]监听组播失败，不发布服务: %v", err)
+		return
+	}
+	records := s.mdnsRecords(name, ip, port, true)
+
+	// 启动时主动通告两次，间隔一秒(RFC 6762 第 8.3 节)
+	announce := mdnsMessage(0, nil, 0, records, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteToUDP(announce, group); err != nil {
+			log.Printf("[mdns]发送通告失败: %v", err)
+		}
+		if i == 0 {
+			time.Sleep(time.Second)
+		}
+	}
+	log.Printf("[mdns]已发布 %s.local (%s)", name, ip)
+
+	go func() {
+		<-s.stopping
+		conn.WriteToUDP(mdnsMessage(0, nil, 0, s.mdnsRecords(name, ip, port, false), nil), group)
+		conn.Close()
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("[mdns]读取失败: %v", err)
+			}
+			return
+		}
+		legacy := src.Port != mdnsPort
+		resp := mdnsAnswer(buf[:n], records, legacy)
+		if resp == nil {
+			continue
+		}
+		dst := group
+		if legacy {
+			dst = src
+		}
+		if _, err := conn.WriteToUDP(resp, dst); err != nil {
+			log.Printf("[mdns]发送应答失败: %v", err)
+		}
+	}
+}
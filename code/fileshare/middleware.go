@@ -0,0 +1,323 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientIP 从 RemoteAddr 中取出客户端 IP
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ipAllowed 判断 IP 是否在 -allow-cidr 允许的网段内，未设置时允许所有地址
+func (s *Server) ipAllowed(ip net.IP) bool {
+	if len(s.allowedNets) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range s.allowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusRecorder 记录响应的状态码和字节数，供访问日志使用
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// withAccessLog 在 -log-format clf 时按 Apache 通用日志格式(CLF)为每个请求写一行：
+// IP - 用户 [时间] "方法 路径 协议" 状态码 字节数；json 时每行一个 JSON 对象，另外带上耗时和 User-Agent
+func (s *Server) withAccessLog(next http.Handler) http.Handler {
+	if s.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 健康检查每隔几秒一次，记下来只会淹没真正的访问记录
+		if r.URL.Path == s.basePath+healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if host == "" {
+			host = "-"
+		}
+		user, _, ok := r.BasicAuth()
+		if !ok || user == "" {
+			user = "-"
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if s.logFormat == "json" {
+			user, _, _ := r.BasicAuth()
+			line, _ := json.Marshal(accessEntry{
+				Time:       start.Format(time.RFC3339),
+				RemoteIP:   host,
+				User:       user,
+				Method:     r.Method,
+				Path:       r.RequestURI,
+				Proto:      r.Proto,
+				Status:     status,
+				Bytes:      rec.bytes,
+				DurationMS: time.Since(start).Milliseconds(),
+				UserAgent:  r.UserAgent(),
+				Referer:    r.Referer(),
+			})
+			s.accessLog.Print(string(line))
+			return
+		}
+		size := "-"
+		if rec.bytes > 0 {
+			size = strconv.FormatInt(rec.bytes, 10)
+		}
+		s.accessLog.Printf("%s - %s [%s] %q %d %s", host, strings.ReplaceAll(user, " ", "_"),
+			start.Format("02/Jan/2006:15:04:05 -0700"), r.Method+" "+r.RequestURI+" "+r.Proto, status, size)
+	})
+}
+
+// accessEntry 是 -log-format json 的一行访问日志
+type accessEntry struct {
+	Time       string `json:"time"`
+	RemoteIP   string `json:"remote_ip"`
+	User       string `json:"user,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Proto      string `json:"proto"`
+	Status     int    `json:"status"`
+	Bytes      int64  `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	Referer    string `json:"referer,omitempty"`
+}
+
+// withIPFilter 在访问任何文件之前拒绝不在允许网段内的客户端
+func (s *Server) withIPFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.ipAllowed(clientIP(r)) {
+			log.Printf("[deny]%s %s %s 不在允许的网段内", r.RemoteAddr, r.Method, r.URL.Path)
+			s.renderError(w, r, http.StatusForbidden, "禁止访问")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientState 是一个客户端 IP 正在处理的请求数和请求速率的令牌桶
+type clientState struct {
+	active int
+	tokens float64
+	last   time.Time
+}
+
+// maxClientStates 超过这个数量时清理空闲的客户端记录，防止大量不同来源撑大内存
+const maxClientStates = 4096
+
+// withClientLimit 按客户端 IP 限制同时处理的请求数(-max-conns-per-ip)和每秒请求数(-rate-per-ip)，
+// 一个客户端开很多线程下载或者刷新过快时只影响它自己，不会占满 -max-conns。
+// 列表页的事件流(/_nfs/events)会一直保持连接，不计入并发数
+func (s *Server) withClientLimit(next http.Handler) http.Handler {
+	if s.cfg.MaxConnsPerIP <= 0 && s.cfg.RatePerIP <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.RemoteAddr
+		if ip := clientIP(r); ip != nil {
+			key = ip.String()
+		}
+		counted := s.cfg.MaxConnsPerIP > 0 && r.URL.Path != "/_nfs/events"
+		now := time.Now()
+
+		s.clientMu.Lock()
+		c := s.clientLimits[key]
+		if c == nil {
+			if len(s.clientLimits) >= maxClientStates {
+				for k, old := range s.clientLimits {
+					if old.active == 0 && now.Sub(old.last) > time.Minute {
+						delete(s.clientLimits, k)
+					}
+				}
+			}
+			c = &clientState{tokens: max(s.cfg.RatePerIP, 1), last: now}
+			s.clientLimits[key] = c
+		}
+		reason := ""
+		if s.cfg.RatePerIP > 0 {
+			c.tokens = min(max(s.cfg.RatePerIP, 1), c.tokens+now.Sub(c.last).Seconds()*s.cfg.RatePerIP)
+			if c.tokens < 1 {
+				reason = "请求过于频繁"
+			}
+		}
+		if reason == "" && counted && c.active >= s.cfg.MaxConnsPerIP {
+			reason = "同时进行的请求过多"
+		}
+		c.last = now
+		if reason == "" {
+			if s.cfg.RatePerIP > 0 {
+				c.tokens--
+			}
+			if counted {
+				c.active++
+			}
+		}
+		s.clientMu.Unlock()
+
+		if reason != "" {
+			log.Printf("[limit]%s %s %s %s", key, r.Method, r.URL.Path, reason)
+			w.Header().Set("Retry-After", "1")
+			s.renderError(w, r, http.StatusTooManyRequests, reason+"，请稍后重试")
+			return
+		}
+		if counted {
+			defer func() {
+				s.clientMu.Lock()
+				c.active--
+				s.clientMu.Unlock()
+			}()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAPIRequest 判断请求是否为供程序调用的接口（校验值、事件流、统计、JSON 目录列表），
+// CORS 头只加在这些响应上，HTML 页面不允许跨域读取
+func isAPIRequest(r *http.Request) bool {
+	return r.URL.Path == "/_nfs/events" || r.URL.Path == "/_nfs/stats" || r.URL.Query().Get("checksum") != "" || wantsJSON(r)
+}
+
+// corsOrigin 返回允许的来源：配置了 * 时为 "*"，否则回显匹配的 Origin，不匹配返回空
+func (s *Server) corsOrigin(origin string) (allow string, credentials bool) {
+	for _, o := range s.corsOrigins {
+		if o == "*" {
+			return "*", false
+		}
+		if strings.EqualFold(o, origin) {
+			// 回显具体来源而不是 *，浏览器才允许携带凭据
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// withCORS 为 API 响应加上跨域头，并直接应答预检(OPTIONS)请求
+func (s *Server) withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(s.corsOrigins) == 0 || origin == "" || !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allow, credentials := s.corsOrigin(origin)
+		if allow != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			if credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allow == "" {
+				log.Printf("[cors]拒绝来源 %s", origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withBasePath 去掉请求路径中的 -base-url 前缀后再交给后续处理，不带前缀的请求返回404
+func (s *Server) withBasePath(next http.Handler) http.Handler {
+	if s.basePath == "" {
+		return next
+	}
+	strip := http.StripPrefix(s.basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == s.basePath:
+			http.Redirect(w, r, s.basePath+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, s.basePath+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// withServerHeader 在所有响应上带上 Server: NetworkFileShare/版本号，便于确认部署的是哪个版本
+func withServerHeader(next http.Handler) http.Handler {
+	server := "NetworkFileShare/" + strings.TrimPrefix(Version, "v")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", server)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withCache 为内置的静态资源加上缓存头，资源随程序发布，一天内不必重新请求
+func withCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		next.ServeHTTP(w, r)
+	})
+}
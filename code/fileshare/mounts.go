@@ -0,0 +1,104 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// mount 是以 /名称/ 为前缀挂载的一个共享目录
+type mount struct {
+	name string
+	root string
+}
+
+// parseMounts 解析 -dir 参数：单个不带名称的目录沿用原来的单目录模式，
+// 否则每个参数都必须是 名称=路径 的形式
+func parseMounts(dirs []string) (root string, mounts []mount, err error) {
+	if len(dirs) == 1 {
+		if name, _, ok := strings.Cut(dirs[0], "="); !ok || !validName(name) {
+			return dirs[0], nil, nil
+		}
+	}
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		name, path, ok := strings.Cut(d, "=")
+		if !ok || !validName(name) || path == "" {
+			return "", nil, fmt.Errorf("多个目录需使用 名称=路径 的形式: %s", d)
+		}
+		if seen[name] {
+			return "", nil, fmt.Errorf("目录名称重复: %s", name)
+		}
+		seen[name] = true
+		mounts = append(mounts, mount{name: name, root: path})
+	}
+	return "", mounts, nil
+}
+
+// findMount 按名称查找挂载的目录
+func (s *Server) findMount(name string) (mount, bool) {
+	for _, m := range s.mounts {
+		if m.name == name {
+			return m, true
+		}
+	}
+	return mount{}, false
+}
+
+// isShareRoot 判断路径是否为某个共享根目录本身，根目录不能被删除
+func (s *Server) isShareRoot(fullPath string) bool {
+	if fullPath == s.rootDir {
+		return true
+	}
+	for _, m := range s.mounts {
+		if fullPath == m.root {
+			return true
+		}
+	}
+	return false
+}
+
+// listMounts 在多目录模式下列出所有挂载的共享目录，和普通目录一样支持 JSON 格式
+func (s *Server) listMounts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		entries := make([]jsonEntry, 0, len(s.mounts))
+		for _, m := range s.mounts {
+			entry := jsonEntry{Name: m.name, Path: m.name, URL: s.dirURL(m.name), IsDir: true}
+			if info, err := os.Stat(m.root); err == nil {
+				entry.MTime = info.ModTime().UTC()
+			}
+			entries = append(entries, entry)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodHead {
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Path    string      `json:"path"`
+			Entries []jsonEntry `json:"entries"`
+		}{".", entries})
+		return
+	}
+
+	data := DirListData{RelPath: "/", Dir: ".", Total: len(s.mounts), Base: s.basePath}
+	for _, m := range s.mounts {
+		data.Files = append(data.Files, FileEntry{
+			URL:   s.dirURL(m.name),
+			Name:  m.name,
+			Path:  m.name,
+			IsDir: true,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := s.listTemplate.Execute(w, data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
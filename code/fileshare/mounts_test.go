@@ -0,0 +1,108 @@
+package fileshare
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newMountServer 共享 base 下的 photos 和 docs 两个目录，base 本身不共享
+func newMountServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	base := t.TempDir()
+	writeFiles(t, base, map[string]string{
+		"photos/cat.jpg":  "cat",
+		"docs/readme.txt": "docs",
+		"docs2/other.txt": "docs2",
+		"private.txt":     "secret",
+	})
+	s, err := New(Config{Dirs: []string{
+		"photos=" + filepath.Join(base, "photos"),
+		"docs=" + filepath.Join(base, "docs"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, base
+}
+
+func TestMountsRouteByPrefix(t *testing.T) {
+	s, _ := newMountServer(t)
+	h := s.Handler()
+
+	rec := do(t, h, "GET", "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / = %d", rec.Code)
+	}
+	for _, want := range []string{"photos", "docs"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("根目录列表中没有 %s", want)
+		}
+	}
+	if strings.Contains(rec.Body.String(), "private.txt") {
+		t.Error("根目录列表显示了上级目录的文件")
+	}
+
+	for target, want := range map[string]string{"/photos/cat.jpg": "cat", "/docs/readme.txt": "docs"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET %s = %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+	for _, target := range []string{"/photos/readme.txt", "/docs/cat.jpg", "/docs2/other.txt", "/doc/readme.txt", "/private.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, 应为404", target, rec.Code)
+		}
+	}
+}
+
+func TestMountsResolveAgainstOwnRoot(t *testing.T) {
+	s, base := newMountServer(t)
+
+	tests := []struct {
+		path string
+		want string // 空表示应返回错误
+	}{
+		{"photos/cat.jpg", filepath.Join(base, "photos", "cat.jpg")},
+		{"docs/readme.txt", filepath.Join(base, "docs", "readme.txt")},
+		{"photos/../docs/readme.txt", filepath.Join(base, "docs", "readme.txt")}, // 清理后落在 docs 挂载中
+		{"photos/../private.txt", ""},
+		{"photos/../../private.txt", ""},
+		{"../private.txt", ""},
+		{"docs2/other.txt", ""},
+	}
+	for _, tt := range tests {
+		full, _, err := s.resolvePath(tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolvePath(%q) = %s, 应返回错误", tt.path, full)
+			}
+			continue
+		}
+		real, _ := filepath.EvalSymlinks(tt.want)
+		if err != nil || full != real {
+			t.Errorf("resolvePath(%q) = %s, %v, 应为 %s", tt.path, full, err, real)
+		}
+	}
+}
+
+// 一个挂载中的符号链接不能指向另一个挂载或上级目录
+func TestMountsSymlinkCannotCrossMounts(t *testing.T) {
+	s, base := newMountServer(t)
+	for name, target := range map[string]string{
+		"to-docs.txt":    filepath.Join(base, "docs", "readme.txt"),
+		"to-private.txt": filepath.Join(base, "private.txt"),
+	} {
+		if err := os.Symlink(target, filepath.Join(base, "photos", name)); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+	h := s.Handler()
+	for _, target := range []string{"/photos/to-docs.txt", "/photos/to-private.txt"} {
+		rec := do(t, h, "GET", target, nil)
+		if rec.Code == http.StatusOK {
+			t.Errorf("GET %s = 200 %q, 应被拒绝", target, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package fileshare
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// browserCommand 返回在 goos 系统上用默认浏览器打开 url 的命令。
+// Windows 用 rundll32 而不是 cmd /c start，URL 里的 & 不会被 cmd 当成命令分隔符
+func browserCommand(goos, url string) (name string, args []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{url}
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	default:
+		return "xdg-open", []string{url}
+	}
+}
+
+// browserURL 是 -open 打开的地址：本机回环地址加实际监听的端口，带上 -base-url 前缀
+func (s *Server) browserURL() string {
+	return s.hostURL("127.0.0.1", s.port) + "/"
+}
+
+// launchBrowser 打开浏览器访问共享页面，失败只记录日志，不影响服务运行
+func launchBrowser(url string) {
+	name, args := browserCommand(runtime.GOOS, url)
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		log.Printf("[warn]无法打开浏览器，请手动访问 %s: %v", url, err)
+		return
+	}
+	// 回收子进程，避免留下僵尸进程
+	go cmd.Wait()
+}
+
+// listenErrorHint 把监听失败的常见原因翻译成可操作的提示，其他错误原样输出
+func listenErrorHint(err error, port string) string {
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return fmt.Sprintf("端口 %s 已被占用，请用 -port 换一个端口(如 -port 8082)，或 -port 0 自动选择", port)
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Sprintf("没有权限监听端口 %s，1024 以下的端口通常需要管理员权限，请改用更高的端口", port)
+	}
+	return fmt.Sprintf("%v (可能原因：端口被占用或权限不足，建议改高端口，如8082)", err)
+}
+
+// parsePort 校验端口参数，只接受 0-65535 的数字，0 表示由系统分配
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q 不是数字", s)
+	}
+	if p < 0 || p > 65535 {
+		return 0, fmt.Errorf("%d 超出范围，应为 1-65535，或0表示自动选择", p)
+	}
+	return p, nil
+}
+
+// listenUnix 监听 Unix 套接字，先清理上次异常退出遗留的套接字文件；
+// 同名的普通文件不会被删除。权限设为 0660，便于同组的反向代理访问
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s 已存在且不是套接字文件", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// localAddrs 保存可用于局域网访问的本机地址，没有对应协议的地址时为空
+type localAddrs struct {
+	IPv4 string
+	IPv6 string
+}
+
+func getLocalIP() localAddrs {
+	var addrs localAddrs
+	// 通过 UDP "连接"公共地址获取出口地址，并不会真正发送数据
+	if conn, err := net.Dial("udp4", "8.8.8.8:80"); err == nil {
+		addrs.IPv4 = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+	}
+	if conn, err := net.Dial("udp6", "[2001:4860:4860::8888]:80"); err == nil {
+		addrs.IPv6 = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+	}
+	if addrs.IPv4 != "" && addrs.IPv6 != "" {
+		return addrs
+	}
+
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err == nil {
+		fallback := pickLocalAddrs(ifaceAddrs)
+		if addrs.IPv4 == "" {
+			addrs.IPv4 = fallback.IPv4
+		}
+		if addrs.IPv6 == "" {
+			addrs.IPv6 = fallback.IPv6
+		}
+	}
+	if addrs.IPv4 == "" && addrs.IPv6 == "" {
+		addrs.IPv4 = "127.0.0.1"
+	}
+	return addrs
+}
+
+// pickLocalAddrs 从网卡地址中各挑选一个非回环的 IPv4 和 IPv6 地址，
+// IPv6 链路本地地址(fe80::)需要指定网卡才能访问，因此跳过
+func pickLocalAddrs(ifaceAddrs []net.Addr) localAddrs {
+	var addrs localAddrs
+	for _, addr := range ifaceAddrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			if addrs.IPv4 == "" {
+				addrs.IPv4 = ipNet.IP.String()
+			}
+		} else if addrs.IPv6 == "" && !ipNet.IP.IsLinkLocalUnicast() {
+			addrs.IPv6 = ipNet.IP.String()
+		}
+	}
+	return addrs
+}
+
+// hostURL 拼接访问地址，IPv6 地址会自动加上方括号
+func (s *Server) hostURL(ip, port string) string {
+	scheme := "http://"
+	if s.useTLS {
+		scheme = "https://"
+	}
+	return scheme + net.JoinHostPort(ip, port) + s.basePath
+}
+
+// selfSignedCert 生成自签名证书，私钥只保存在内存里，每次启动都不同。
+// 证书包含 localhost、主机名和本机局域网地址，用哪个地址访问都能通过主机名校验(仍需手动信任)
+func selfSignedCert(addrs localAddrs) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "Network File Share", Organization: []string{"Network File Share"}},
+		NotBefore:    time.Now().Add(-time.Hour), // 容忍客户端时钟略慢
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, host)
+	}
+	for _, ip := range []string{addrs.IPv4, addrs.IPv6} {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, parsed)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// certFingerprint 返回证书的 SHA-256 指纹，格式和浏览器证书详情里显示的一致(冒号分隔的大写十六进制)
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,197 @@
+package fileshare
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeAddr 是不是 *net.IPNet 的地址，如 Unix 套接字
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "fake" }
+func (a fakeAddr) String() string  { return string(a) }
+
+func ipNet(s string) net.Addr {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	n.IP = ip
+	return n
+}
+
+func TestPickLocalAddrs(t *testing.T) {
+	tests := []struct {
+		name  string
+		addrs []net.Addr
+		want  localAddrs
+	}{
+		{"只有回环", []net.Addr{ipNet("127.0.0.1/8"), ipNet("::1/128")}, localAddrs{}},
+		{"跳过链路本地 IPv6", []net.Addr{ipNet("fe80::1/64"), ipNet("192.168.1.5/24")}, localAddrs{IPv4: "192.168.1.5"}},
+		{"双栈", []net.Addr{ipNet("127.0.0.1/8"), ipNet("fd00::2/64"), ipNet("10.0.0.7/8")}, localAddrs{IPv4: "10.0.0.7", IPv6: "fd00::2"}},
+		{"各取第一个", []net.Addr{ipNet("10.0.0.1/8"), ipNet("10.0.0.2/8"), ipNet("2001:db8::1/64"), ipNet("2001:db8::2/64")}, localAddrs{IPv4: "10.0.0.1", IPv6: "2001:db8::1"}},
+		{"忽略非 IPNet", []net.Addr{fakeAddr("/tmp/sock"), ipNet("2001:db8::9/64")}, localAddrs{IPv6: "2001:db8::9"}},
+	}
+	for _, tt := range tests {
+		if got := pickLocalAddrs(tt.addrs); got != tt.want {
+			t.Errorf("%s: pickLocalAddrs = %+v, 应为 %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHostURL(t *testing.T) {
+	s := &Server{}
+	if got := s.hostURL("fd00::2", "8080"); got != "http://[fd00::2]:8080" {
+		t.Errorf("IPv6 地址应加方括号: %s", got)
+	}
+	s = &Server{useTLS: true, basePath: "/files"}
+	if got := s.hostURL("192.168.1.5", "8443"); got != "https://192.168.1.5:8443/files" {
+		t.Errorf("hostURL = %s", got)
+	}
+}
+
+func TestBrowserURL(t *testing.T) {
+	tests := []struct {
+		s    *Server
+		want string
+	}{
+		{&Server{port: "8080"}, "http://127.0.0.1:8080/"},
+		{&Server{port: "8443", useTLS: true, basePath: "/files"}, "https://127.0.0.1:8443/files/"},
+	}
+	for _, tt := range tests {
+		if got := tt.s.browserURL(); got != tt.want {
+			t.Errorf("browserURL = %s, 应为 %s", got, tt.want)
+		}
+	}
+}
+
+func TestBrowserCommand(t *testing.T) {
+	const u = "http://127.0.0.1:8080/?a=1&b=2"
+	tests := []struct {
+		goos string
+		want []string
+	}{
+		{"darwin", []string{"open", u}},
+		{"windows", []string{"rundll32", "url.dll,FileProtocolHandler", u}},
+		{"linux", []string{"xdg-open", u}},
+		{"freebsd", []string{"xdg-open", u}},
+	}
+	for _, tt := range tests {
+		name, args := browserCommand(tt.goos, u)
+		if got := append([]string{name}, args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: browserCommand = %q, 应为 %q", tt.goos, got, tt.want)
+		}
+	}
+}
+
+// 找不到打开浏览器的命令时只记录警告，不会失败或阻塞
+func TestLaunchBrowserFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 会在系统目录中查找 rundll32")
+	}
+	t.Setenv("PATH", "")
+	buf := captureLog(t)
+	launchBrowser("http://127.0.0.1:8080/")
+	if !strings.Contains(buf.String(), "[warn]无法打开浏览器，请手动访问 http://127.0.0.1:8080/") {
+		t.Errorf("日志中没有警告: %q", buf.String())
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"0", 0, true}, // 由系统分配
+		{"1", 1, true},
+		{"8080", 8080, true},
+		{"65535", 65535, true},
+		{"65536", 0, false},
+		{"99999", 0, false},
+		{"-1", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+		{"80 ", 0, false},
+		{"8080.0", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePort(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parsePort(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+// 端口为0时由系统分配，Listen 之后 port 是实际监听的端口
+func TestListenEphemeralPort(t *testing.T) {
+	s, _ := newTestServer(t, Config{Port: "0"}, nil)
+	base := startServer(t, s)
+	if s.port == "0" || s.port != strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port) {
+		t.Fatalf("port = %s, 监听地址为 %s", s.port, s.listener.Addr())
+	}
+	resp, err := http.Get(base + healthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.HasSuffix(s.shareURL, ":"+s.port) {
+		t.Errorf("访问地址 %s 没有使用实际端口", s.shareURL)
+	}
+}
+
+// 端口被占用时 Listen 直接返回说明原因的错误，不输出启动信息
+func TestListenPortInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+
+	s, _ := newTestServer(t, Config{Port: port}, nil)
+	buf := captureLog(t)
+	err = s.Listen()
+	if err == nil {
+		s.listener.Close()
+		t.Fatal("端口被占用时 Listen 应返回错误")
+	}
+	if runtime.GOOS != "windows" {
+		if want := "端口 " + port + " 已被占用，请用 -port 换一个端口"; !strings.Contains(err.Error(), want) {
+			t.Errorf("错误为 %q, 应包含 %q", err, want)
+		}
+	}
+	if strings.Contains(buf.String(), "[start]") || strings.Contains(buf.String(), "本地访问") {
+		t.Errorf("监听失败时输出了启动信息:\n%s", buf.String())
+	}
+	if s.httpServer != nil {
+		t.Error("监听失败时不应创建 http.Server")
+	}
+}
+
+func TestListenErrorHint(t *testing.T) {
+	wrap := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", errno)}
+	}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{wrap(syscall.EADDRINUSE), "端口 8080 已被占用"},
+		{wrap(syscall.EACCES), "没有权限监听端口 8080"},
+		{errors.New("其他错误"), "其他错误 (可能原因"},
+	}
+	for _, tt := range tests {
+		if got := listenErrorHint(tt.err, "8080"); !strings.Contains(got, tt.want) {
+			t.Errorf("listenErrorHint(%v) = %q, 应包含 %q", tt.err, got, tt.want)
+		}
+	}
+}
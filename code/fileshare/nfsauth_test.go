@@ -0,0 +1,185 @@
+package fileshare
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 以下哈希由 libxcrypt 的 crypt(3) 生成，用来确认 htpasswd 等工具生成的各种 $2?$ 前缀都能校验
+const secretHash = "$2b$04$abcdefghijklmnopqrstuuqQh/LPiQEJnVfZ.DaezbimbBxInWG2m" // 中文密码
+
+func TestBcryptCompare(t *testing.T) {
+	long := strings.Repeat("0123456789", 7) + "ab" // 正好 72 字节
+	tests := []struct {
+		hash, password string
+		want           bool
+	}{
+		{"$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s.", "", true},
+		{"$2a$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i", "abc", true},
+		{"$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", "allmine", true},
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{"$2b$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{"$2y$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true},
+		{secretHash, "中文密码", true},
+		// 只取前 72 字节，之后的内容不影响结果
+		{"$2b$04$XXXXXXXXXXXXXXXXXXXXXOscGDWgzGAgWGKFkXsmEdhaEQmfRPzoC", long, true},
+		{"$2b$04$XXXXXXXXXXXXXXXXXXXXXOscGDWgzGAgWGKFkXsmEdhaEQmfRPzoC", long + "extra", true},
+		{"$2b$04$XXXXXXXXXXXXXXXXXXXXXOscGDWgzGAgWGKFkXsmEdhaEQmfRPzoC", long[:71], false},
+		{"$2b$04$XXXXXXXXXXXXXXXXXXXXXOqrOD2xw0m3XTM28oOgwOz2RmPQK1z4.", long[:71], true},
+		// 密码错误
+		{"$2a$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i", "abd", false},
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U ", false},
+		{secretHash, "", false},
+		// 格式错误
+		{"$2a$03$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", false},
+		{"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOe", "U*U", false},
+	}
+	for _, tt := range tests {
+		if got := passwordHashOK(tt.hash, tt.password); got != tt.want {
+			t.Errorf("passwordHashOK(%s, %q) = %v, 应为 %v", tt.hash, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestDirAuth(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{
+		"public.txt":               "public",
+		"private/" + authFileName:  "# 用户名不做检查\nalice:" + secretHash + "\n",
+		"private/secret.txt":       "secret",
+		"private/sub/deep.txt":     "deep",
+		"privateer/not-locked.txt": "open",
+	})
+	h := s.Handler()
+	get := func(target, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if password != "" {
+			req.SetBasicAuth("anyone", password)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{"/private/", "/private/secret.txt", "/private/sub/", "/private/sub/deep.txt"} {
+		rec := get(target, "")
+		if rec.Code != http.StatusUnauthorized || !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic ") {
+			t.Errorf("未登录 GET %s = %d %q, 应为401", target, rec.Code, rec.Header().Get("WWW-Authenticate"))
+		}
+		if rec := get(target, "错误密码"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("密码错误 GET %s = %d, 应为401", target, rec.Code)
+		}
+		if rec := get(target, "中文密码"); rec.Code != http.StatusOK {
+			t.Errorf("密码正确 GET %s = %d, 应为200", target, rec.Code)
+		}
+	}
+	if rec := get("/private/secret.txt", "中文密码"); rec.Body.String() != "secret" {
+		t.Errorf("登录后内容为 %q", rec.Body.String())
+	}
+	for _, target := range []string{"/public.txt", "/", "/privateer/not-locked.txt"} {
+		if rec := get(target, ""); rec.Code != http.StatusOK {
+			t.Errorf("不受保护的 GET %s = %d", target, rec.Code)
+		}
+	}
+
+	// .nfsauth 本身既不列出也不能下载
+	if body := get("/private/", "中文密码").Body.String(); strings.Contains(body, authFileName) {
+		t.Error("目录列表中出现了 .nfsauth")
+	}
+	if rec := get("/private/"+authFileName, "中文密码"); rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), secretHash) {
+		t.Errorf("GET .nfsauth = %d, 不应能下载", rec.Code)
+	}
+
+	// 修改 .nfsauth 后缓存失效，新密码立即生效
+	authPath := filepath.Join(root, "private", authFileName)
+	if err := os.WriteFile(authPath, []byte("$2a$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(authPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get("/private/secret.txt", "中文密码"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("更换密码后旧密码 = %d, 应为401", rec.Code)
+	}
+	if rec := get("/private/secret.txt", "abc"); rec.Code != http.StatusOK {
+		t.Errorf("更换密码后新密码 = %d, 应为200", rec.Code)
+	}
+}
+
+// 开启全站登录时 Basic 认证是登录账号，目录密码改在表单中输入，通过后由 cookie 保存
+func TestDirAuthWithSiteLogin(t *testing.T) {
+	s, root := newTestServer(t, Config{Auth: "admin:site-pass"}, map[string]string{
+		"private/" + authFileName: secretHash + "\n",
+		"private/secret.txt":      "secret",
+		"other/" + authFileName:   secretHash + "\n",
+		"other/b.txt":             "b",
+	})
+	h := s.Handler()
+	send := func(method, target string, body io.Reader, cookies []*http.Cookie, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.SetBasicAuth("admin", "site-pass")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	unlock := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"path": {"private"}, "password": {password}, "next": {"/private/secret.txt"}}
+		return send("POST", "/_nfs/unlock", strings.NewReader(form.Encode()), nil, "Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	// 登录后访问受保护目录：不要求浏览器重新登录(不带 WWW-Authenticate)，页面上是输入目录密码的表单
+	rec := send("GET", "/private/secret.txt", nil, nil, "Accept", "text/html")
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("未输入目录密码 = %d, WWW-Authenticate %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+	for _, want := range []string{`action="/_nfs/unlock"`, `name="path" value="private"`, `name="next" value="/private/secret.txt"`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("密码表单中没有 %s", want)
+		}
+	}
+
+	if rec := unlock("错误密码"); rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Errorf("目录密码错误 = %d, cookie %v", rec.Code, rec.Result().Cookies())
+	}
+	rec = unlock("中文密码")
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/private/secret.txt" || len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("目录密码正确 = %d %q, cookie %v", rec.Code, rec.Header().Get("Location"), cookies)
+	}
+	if rec := send("GET", "/private/secret.txt", nil, cookies); rec.Code != http.StatusOK || rec.Body.String() != "secret" {
+		t.Errorf("带 cookie 访问 = %d %q", rec.Code, rec.Body.String())
+	}
+	// cookie 只对输入过密码的目录有效，也仍然需要全站登录
+	if rec := send("GET", "/other/b.txt", nil, cookies); rec.Code != http.StatusUnauthorized {
+		t.Errorf("cookie 用于其他目录 = %d, 应为401", rec.Code)
+	}
+	req := httptest.NewRequest("GET", "/private/secret.txt", nil)
+	req.AddCookie(cookies[0])
+	anon := httptest.NewRecorder()
+	h.ServeHTTP(anon, req)
+	if anon.Code != http.StatusUnauthorized || anon.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("未登录只带 cookie = %d, 应要求全站登录", anon.Code)
+	}
+
+	// 更换目录密码后旧的 cookie 失效
+	authPath := filepath.Join(root, "private", authFileName)
+	os.WriteFile(authPath, []byte("$2a$06$If6bvum7DFjUnE9p2uDeDu0YHzrHM6tf.iqN8.yx.jNN1ILEf7h0i\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(authPath, later, later)
+	if rec := send("GET", "/private/secret.txt", nil, cookies); rec.Code != http.StatusUnauthorized {
+		t.Errorf("更换密码后旧 cookie = %d, 应为401", rec.Code)
+	}
+}
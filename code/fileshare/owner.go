@@ -0,0 +1,34 @@
+package fileshare
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+)
+
+// fileOwner 返回文件的所有者和所属组名，查不到名字时显示数字 ID；
+// 取不到 uid/gid 的平台(见 statOwner)返回空
+func (s *Server) fileOwner(info fs.FileInfo) (owner, group string) {
+	uid, gid, ok := statOwner(info)
+	if !ok {
+		return "", ""
+	}
+	return s.lookupOwner("u", uid), s.lookupOwner("g", gid)
+}
+
+func (s *Server) lookupOwner(kind string, id uint64) string {
+	key := kind + strconv.FormatUint(id, 10)
+	if name, ok := s.ownerNames.Load(key); ok {
+		return name.(string)
+	}
+	name := strconv.FormatUint(id, 10)
+	if kind == "u" {
+		if u, err := user.LookupId(name); err == nil {
+			name = u.Username
+		}
+	} else if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	s.ownerNames.Store(key, name)
+	return name
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fileshare
+
+import "io/fs"
+
+// statOwner 在没有 uid/gid 的平台(如 Windows)上总是返回 false，列表不显示所有者
+func statOwner(info fs.FileInfo) (uid, gid uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package fileshare
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// statOwner 从 Stat_t 中读取文件的 uid 和 gid
+func statOwner(info fs.FileInfo) (uid, gid uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Uid), uint64(st.Gid), true
+}
@@ -0,0 +1,129 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newEscapeServer 返回一个共享目录，其中 out 链接到共享目录以外的 outside 目录，
+// secret.txt 链接到 outside 中的文件，inner 链接到共享目录内的 docs
+func newEscapeServer(t *testing.T, cfg Config) (s *Server, outside string) {
+	t.Helper()
+	outside = t.TempDir()
+	writeFiles(t, outside, map[string]string{"secret.txt": "SECRET"})
+	s, root := newTestServer(t, cfg, map[string]string{"a.txt": "A", "docs/b.txt": "B"})
+	for link, target := range map[string]string{
+		"out":        outside,
+		"secret.txt": filepath.Join(outside, "secret.txt"),
+		"inner":      filepath.Join(root, "docs"),
+		"broken":     filepath.Join(outside, "missing"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+	return s, outside
+}
+
+func TestResolvePath(t *testing.T) {
+	s, _ := newEscapeServer(t, Config{})
+	root := s.rootDir
+
+	tests := []struct {
+		path string
+		want string // 空表示应返回错误
+	}{
+		{"a.txt", filepath.Join(root, "a.txt")},
+		{"/docs/b.txt", filepath.Join(root, "docs", "b.txt")},
+		{"../a.txt", filepath.Join(root, "a.txt")}, // ".." 在根目录处截止
+		{"../../../../etc/passwd", filepath.Join(root, "etc", "passwd")},
+		{"docs/../../a.txt", filepath.Join(root, "a.txt")},
+		{"%2e%2e/a.txt", filepath.Join(root, "%2e%2e", "a.txt")}, // 已解码过一次，只是普通的文件名
+		{"docs/new.txt", filepath.Join(root, "docs", "new.txt")}, // 还不存在的文件(如上传)
+		{"inner/b.txt", filepath.Join(root, "inner", "b.txt")},   // 链接指向共享目录内
+		{"out", ""},
+		{"out/secret.txt", ""},
+		{"out/new.txt", ""},
+		{"secret.txt", ""},
+		{"broken", ""},
+		{"broken/new.txt", ""},
+	}
+	for _, tt := range tests {
+		full, _, err := s.resolvePath(tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolvePath(%q) = %s, 应返回错误", tt.path, full)
+			}
+			continue
+		}
+		if err != nil || full != tt.want {
+			t.Errorf("resolvePath(%q) = %s, %v, 应为 %s", tt.path, full, err, tt.want)
+		}
+	}
+
+	// -follow-symlinks 时允许链接指向共享目录以外，但 ".." 仍然不能越过共享目录
+	follow, outside := newEscapeServer(t, Config{FollowSymlinks: true})
+	if full, _, err := follow.resolvePath("out/secret.txt"); err != nil || full != filepath.Join(follow.rootDir, "out", "secret.txt") {
+		t.Errorf("-follow-symlinks: resolvePath(out/secret.txt) = %s, %v", full, err)
+	}
+	rel, _ := filepath.Rel(follow.rootDir, filepath.Join(outside, "secret.txt"))
+	if full, _, err := follow.resolvePath(filepath.ToSlash(rel)); err == nil && !withinDir(follow.rootDir, full) {
+		t.Errorf("-follow-symlinks: resolvePath(%q) = %s, 越出了共享目录", rel, full)
+	}
+}
+
+func TestConfined(t *testing.T) {
+	s, outside := newEscapeServer(t, Config{})
+	root := s.rootDir
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{root, true},
+		{filepath.Join(root, "a.txt"), true},
+		{filepath.Join(root, "missing", "deeper", "new.txt"), true},
+		{filepath.Join(root, "inner", "b.txt"), true},
+		{filepath.Join(root, "out"), false},
+		{filepath.Join(root, "out", "secret.txt"), false},
+		{filepath.Join(root, "out", "missing", "new.txt"), false},
+		{filepath.Join(root, "broken"), false},
+		{filepath.Join(outside, "secret.txt"), false},
+	}
+	for _, tt := range tests {
+		if got := confined(root, tt.path); got != tt.want {
+			t.Errorf("confined(%s) = %v, 应为 %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// 通过 HTTP 请求时，".."(包括编码后的 %2e%2e、%2f)最多回到共享目录的根，指向外部的链接返回403
+func TestTraversalRequests(t *testing.T) {
+	s, outside := newEscapeServer(t, Config{Writable: true})
+	h := s.Handler()
+
+	for _, target := range []string{"/%2e%2e/a.txt", "/%2E%2E%2Fa.txt", "/..%2fa.txt", "/docs/%2e%2e/%2e%2e/a.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusOK || rec.Body.String() != "A" {
+			t.Errorf("GET %s = %d %q, 应在共享目录的根截止并返回 a.txt", target, rec.Code, rec.Body.String())
+		}
+	}
+	for _, target := range []string{"/out/secret.txt", "/out/", "/secret.txt", "/%2e%2e/out/secret.txt", "/docs/%2e%2e/out/secret.txt", "/broken"} {
+		rec := do(t, h, "GET", target, nil)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "SECRET") {
+			t.Errorf("GET %s = %d, 应为403且不返回共享目录以外的内容", target, rec.Code)
+		}
+	}
+	// 写入同样不能跟随链接到共享目录以外
+	if rec := postForm(t, h, "/_nfs/mkdir", url.Values{"dir": {"out"}, "name": {"new"}}); rec.Code != http.StatusForbidden {
+		t.Errorf("在 out 中新建文件夹 = %d, 应为403", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Error("在共享目录以外创建了文件夹")
+	}
+	if rec := do(t, h, "GET", "/inner/b.txt", nil); rec.Body.String() != "B" {
+		t.Errorf("GET /inner/b.txt = %d %q, 指向共享目录内的链接应可访问", rec.Code, rec.Body.String())
+	}
+}
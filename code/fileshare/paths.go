@@ -0,0 +1,195 @@
+package fileshare
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// siteURL 返回文件浏览的站内链接：加上 -base-url 前缀(和 -dashboard 的 /browse)，并按路径段编码（保留"/"）
+func (s *Server) siteURL(relPath string) string {
+	return s.basePath + s.browsePrefix + escapeURLPath("/"+strings.TrimPrefix(relPath, "/"))
+}
+
+// escapeURLPath 按路径段编码(保留"/")，文件名里的空格、%、#、? 都会被编码。
+// "+" 在路径里本来不需要编码，但不少代理和客户端会把它当成空格，这里也编码成 %2B，
+// 服务端解码 r.URL.Path 时 %2B 和 + 都还原为 +，生成的链接和请求解析保持一致
+func escapeURLPath(p string) string {
+	return strings.ReplaceAll((&url.URL{Path: p}).EscapedPath(), "+", "%2B")
+}
+
+// dirURL 返回目录的站内链接，以"/"结尾
+func (s *Server) dirURL(relPath string) string {
+	u := s.siteURL(relPath)
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// resolvePath 把请求中的相对路径限制在共享目录内，返回绝对路径和清理后的相对路径；
+// 先以"/"为根清理，"../"之类的片段无法越过共享目录，再解析符号链接确认实际位置也在共享目录内。
+// 多目录模式下第一段路径为挂载名称，访问顶层时返回空的 fullPath
+func (s *Server) resolvePath(reqPath string) (fullPath string, cleanedPath string, err error) {
+	cleanedPath = filepath.Clean(strings.TrimPrefix(filepath.Clean("/"+filepath.FromSlash(reqPath)), string(filepath.Separator)))
+
+	root, sub := s.rootDir, cleanedPath
+	if len(s.mounts) > 0 {
+		if cleanedPath == "." {
+			return "", cleanedPath, nil
+		}
+		name, rest, _ := strings.Cut(cleanedPath, string(filepath.Separator))
+		m, ok := s.findMount(name)
+		if !ok {
+			return "", "", fmt.Errorf("未知的共享目录 %s: %w", name, os.ErrNotExist)
+		}
+		root, sub = m.root, rest
+	}
+
+	fullPath = filepath.Join(root, sub)
+	if !withinDir(root, fullPath) {
+		return "", "", fmt.Errorf("路径越出共享目录: %s", reqPath)
+	}
+	if !s.cfg.FollowSymlinks && !confined(root, fullPath) {
+		return "", "", fmt.Errorf("符号链接指向共享目录以外: %s", reqPath)
+	}
+	return fullPath, cleanedPath, nil
+}
+
+// relativePath 是 resolvePath 的反向：返回 fullPath 对应的请求路径(斜杠分隔)，多目录模式下以挂载名称开头
+func (s *Server) relativePath(fullPath string) string {
+	root := s.shareRootOf(fullPath)
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	for _, m := range s.mounts {
+		if m.root == root {
+			return path.Join(m.name, rel)
+		}
+	}
+	return rel
+}
+
+// withinDir 判断 p 是否为 dir 本身或在 dir 之下(只比较路径字符串)
+func withinDir(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// confined 解析 fullPath 中的符号链接，检查实际位置是否仍在 root 内(root 启动时已解析过)。
+// 路径还不存在时(如上传的新文件)检查最近一级存在的上级目录；失效的链接一律拒绝，
+// 否则写入时可能跟随链接在共享目录以外创建文件。共享目录本身也无法解析时(如部分 FUSE 挂载)不做判断
+func confined(root, fullPath string) bool {
+	for p := fullPath; ; p = filepath.Dir(p) {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return withinDir(root, real)
+		}
+		if info, err := os.Lstat(p); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return false
+		}
+		if p == root || p == filepath.Dir(p) {
+			return true
+		}
+	}
+}
+
+// linkConfined 检查共享目录中的符号链接是否指向共享目录以内，开启 -follow-symlinks 时都允许
+func (s *Server) linkConfined(fullPath string) bool {
+	return s.cfg.FollowSymlinks || confined(s.shareRootOf(fullPath), fullPath)
+}
+
+// shareRootOf 返回 fullPath 所属的共享根目录
+func (s *Server) shareRootOf(fullPath string) string {
+	roots := []string{s.rootDir}
+	for _, m := range s.mounts {
+		roots = append(roots, m.root)
+	}
+	for _, root := range roots {
+		if root != "" && (fullPath == root || strings.HasPrefix(fullPath, root+string(filepath.Separator))) {
+			return root
+		}
+	}
+	return ""
+}
+
+// isCaseInsensitive 找一个含字母的条目，把文件名换成另一种大小写后看是否指向同一个文件；
+// 目录里没有可供判断的条目时按系统猜测（macOS、Windows 默认不区分）
+func (s *Server) isCaseInsensitive(root string) bool {
+	if v, ok := s.caseInsensitive.Load(root); ok {
+		return v.(bool)
+	}
+	if d, err := os.Open(root); err == nil {
+		names, _ := d.Readdirnames(256)
+		d.Close()
+		for _, name := range names {
+			swapped := strings.Map(func(c rune) rune {
+				if unicode.IsUpper(c) {
+					return unicode.ToLower(c)
+				}
+				return unicode.ToUpper(c)
+			}, name)
+			if swapped == name {
+				continue
+			}
+			a, err1 := os.Lstat(filepath.Join(root, name))
+			b, err2 := os.Lstat(filepath.Join(root, swapped))
+			result := err1 == nil && err2 == nil && os.SameFile(a, b)
+			s.caseInsensitive.Store(root, result)
+			return result
+		}
+	}
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// exactCase 在不区分大小写的文件系统上逐段核对路径，每一段都必须与目录里的实际文件名完全一致，
+// 避免 report.pdf 打开了 Report.pdf，同一个文件有多个 URL
+func (s *Server) exactCase(fullPath string) bool {
+	root := s.shareRootOf(fullPath)
+	if root == "" || root == fullPath || !s.isCaseInsensitive(root) {
+		return true
+	}
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil {
+		return false
+	}
+	dir := root
+	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+		d, err := os.Open(dir)
+		if err != nil {
+			// 打不开时交给后面的流程返回对应的错误
+			return true
+		}
+		names, _ := d.Readdirnames(-1)
+		d.Close()
+		found := false
+		for _, name := range names {
+			if name == seg {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		dir = filepath.Join(dir, seg)
+	}
+	return true
+}
+
+// redirectToDir 操作完成后返回到对应目录的列表页
+func (s *Server) redirectToDir(w http.ResponseWriter, r *http.Request, relPath string) {
+	target := s.siteURL("")
+	if relPath != "." {
+		target = s.dirURL(filepath.ToSlash(relPath))
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
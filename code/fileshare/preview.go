@@ -0,0 +1,107 @@
+package fileshare
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// previewTemplate 用于在浏览器内预览图片和文本文件
+var previewTemplate = template.Must(template.New("").Parse(`
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <link href="{{.Base}}/_nfs/assets/fonts.css" rel="stylesheet">
+    <title>预览 - {{.Name}}</title>
+    <style>
+        body { font-family: "HarmonyOS Sans", "思源黑体", sans-serif; font-size:14px; max-width: 960px; margin: 0 auto; padding: 0 12px; }
+        a { color: #2196F3; }
+        img { max-width: 100%; }
+        pre { background: #f5f5f5; padding: 12px; overflow-x: auto; white-space: pre-wrap; word-break: break-all; }
+        .truncated { color: #999; }
+        @media (prefers-color-scheme: dark) {
+            body { background: #121212; color: #ddd; }
+            a { color: #64B5F6; }
+            pre { background: #1e1e1e; }
+        }
+    </style>
+</head>
+<body>
+    <h2>📄 {{.Name}}</h2>
+    <p><a href="{{.RawURL}}">下载原文件</a></p>
+    {{if .IsImage}}<img src="{{.RawURL}}" alt="{{.Name}}">
+    {{else}}<pre>{{.Text}}</pre>
+    {{if .Truncated}}<p class="truncated">文件过大，仅显示前 {{.Limit}} 字节</p>{{end}}{{end}}
+</body>
+</html>
+`))
+
+// maxPreviewSize 是文本预览最多读取的字节数
+const maxPreviewSize = 1 << 20
+
+// previewable 判断文件能否在页面内预览，返回是否为图片
+func previewable(ctype string) (ok bool, isImage bool) {
+	mediaType, _, _ := mime.ParseMediaType(ctype)
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return true, true
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/javascript",
+		mediaType == "application/xml":
+		return true, false
+	}
+	return false, false
+}
+
+// previewFile 在页面中内嵌显示图片或文本，其他类型直接下载
+func (s *Server) previewFile(w http.ResponseWriter, r *http.Request, file *os.File, fileName string) {
+	ok, isImage := previewable(s.detectContentType(file))
+	if !ok {
+		s.sendFile(w, r, file, fileName)
+		return
+	}
+
+	data := struct {
+		Name      string
+		RawURL    string
+		IsImage   bool
+		Text      string
+		Truncated bool
+		Limit     int
+		Base      string
+	}{
+		Name:    fileName,
+		RawURL:  "./" + escapeURLPath(fileName), // 加 ./ 避免 a:b.txt 这样的文件名被当成协议
+		IsImage: isImage,
+		Limit:   maxPreviewSize,
+		Base:    s.basePath,
+	}
+	if !isImage {
+		// 只读取开头部分，避免大文件占满内存
+		buf, err := io.ReadAll(io.LimitReader(file, maxPreviewSize+1))
+		if err != nil {
+			log.Printf("读取文件失败: %v", err)
+			s.renderError(w, r, http.StatusInternalServerError, "文件访问错误")
+			return
+		}
+		if len(buf) > maxPreviewSize {
+			buf = buf[:maxPreviewSize]
+			data.Truncated = true
+		}
+		data.Text = string(buf)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := previewTemplate.Execute(w, data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
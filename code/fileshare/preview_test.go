@@ -0,0 +1,46 @@
+package fileshare
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{
+		"pic.png":  "\x89PNG\r\n\x1a\n",
+		"note.txt": "<script>alert(1)</script> & more",
+		"big.txt":  strings.Repeat("x", maxPreviewSize+10),
+		"data.bin": "\x00\x01\x02\x03",
+	})
+	h := s.Handler()
+
+	body := do(t, h, "GET", "/pic.png?preview=1", nil).Body.String()
+	if !strings.Contains(body, `<img src="./pic.png" alt="pic.png">`) {
+		t.Errorf("图片预览没有 img 标签:\n%s", body)
+	}
+
+	rec := do(t, h, "GET", "/note.txt?preview=1", nil)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("文本预览 Content-Type = %q", ct)
+	}
+	body = rec.Body.String()
+	if !strings.Contains(body, "<pre>&lt;script&gt;alert(1)&lt;/script&gt; &amp; more</pre>") {
+		t.Errorf("文本预览没有转义内容:\n%s", body)
+	}
+	if strings.Contains(body, "<script>alert") {
+		t.Error("文本预览原样输出了 HTML")
+	}
+	if !strings.Contains(body, `<a href="./note.txt">下载原文件</a>`) {
+		t.Error("预览页没有下载链接")
+	}
+
+	body = do(t, h, "GET", "/big.txt?preview=1", nil).Body.String()
+	if !strings.Contains(body, "仅显示前") || strings.Contains(body, strings.Repeat("x", maxPreviewSize+1)) {
+		t.Error("大文件的预览没有截断")
+	}
+
+	// 不能预览的类型直接下载
+	if rec := do(t, h, "GET", "/data.bin?preview=1", nil); rec.Body.String() != "\x00\x01\x02\x03" {
+		t.Errorf("二进制文件的预览应直接下载，得到 %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,72 @@
+package fileshare
+
+import (
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQREndpointReturnsPNG(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, nil)
+	s.shareURL = "http://192.168.1.42:8080"
+
+	rec := do(t, s.Handler(), "GET", "/_nfs/qr", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("GET /qr = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("无法解码 PNG: %v", err)
+	}
+	// 24 字节需要版本2，即 25×25 个模块，加上两边的静区，每个模块 8 像素
+	b := img.Bounds()
+	if want := (25 + qrQuietZone*2) * 8; b.Dx() != want || b.Dy() != want {
+		t.Fatalf("图片大小 %dx%d, 应为 %dx%d", b.Dx(), b.Dy(), want, want)
+	}
+	dark := func(mx, my int) bool {
+		c := color.GrayModel.Convert(img.At((mx+qrQuietZone)*8+4, (my+qrQuietZone)*8+4)).(color.Gray)
+		return c.Y < 0x80
+	}
+	// 三个定位图形的中心和外框为深色，中间一圈为浅色
+	for _, c := range [][2]int{{3, 3}, {21, 3}, {3, 21}} {
+		if !dark(c[0], c[1]) || !dark(c[0]-3, c[1]) || dark(c[0]-2, c[1]) {
+			t.Errorf("(%d,%d) 处的定位图形不正确", c[0], c[1])
+		}
+	}
+	if dark(-1, -1) {
+		t.Error("静区不是浅色")
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		size int
+	}{
+		{1, 21},
+		{14, 21},  // 版本1最多14字节
+		{15, 25},  // 多一字节需要版本2
+		{213, 57}, // 版本10的上限
+	} {
+		q, err := encodeQR(strings.Repeat("a", tt.n))
+		if err != nil {
+			t.Errorf("%d 字节: %v", tt.n, err)
+			continue
+		}
+		if q.size != tt.size {
+			t.Errorf("%d 字节: 大小 %d, 应为 %d", tt.n, q.size, tt.size)
+		}
+		// 定时图形在定位图形之间深浅交替
+		for i := 8; i < q.size-8; i++ {
+			if q.modules[6][i] != (i%2 == 0) || q.modules[i][6] != (i%2 == 0) {
+				t.Errorf("%d 字节: 第 %d 个定时模块不正确", tt.n, i)
+				break
+			}
+		}
+	}
+	if _, err := encodeQR(strings.Repeat("a", 214)); err == nil {
+		t.Error("超过容量应返回错误")
+	}
+}
@@ -0,0 +1,171 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// downloadQuota 按客户端 IP 统计当天(本地时间)的下载字节数，超过 limit 后当天拒绝下载；
+// 只统计文件下载和打包下载，目录列表等页面不计入。字节数在发送前扣除(见 quotaWriter)，
+// 下载中途用完配额时截断响应。nil 表示不限制
+type downloadQuota struct {
+	mu    sync.Mutex
+	limit int64
+	day   string           // 计数所属的日期，如 2006-01-02，跨过零点后清零
+	used  map[string]int64 // IP -> 当天已下载字节数
+	dirty bool             // 有未保存到 -quota-file 的变化
+	now   func() time.Time // 当前时间，测试时可替换
+}
+
+func newDownloadQuota(limit int64) *downloadQuota {
+	return &downloadQuota{limit: limit, used: map[string]int64{}, now: time.Now}
+}
+
+// rollLocked 日期变化时清空计数，调用方需持有锁
+func (q *downloadQuota) rollLocked() {
+	if today := q.now().Format(time.DateOnly); q.day != today {
+		q.day = today
+		q.used = map[string]int64{}
+		q.dirty = true
+	}
+}
+
+func quotaKey(r *http.Request) string {
+	if ip := clientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// allowDownload 检查该客户端今天是否还能下载，已超出时返回429并在 Retry-After 中给出距零点的秒数
+func (s *Server) allowDownload(w http.ResponseWriter, r *http.Request) bool {
+	q := s.quota
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	q.rollLocked()
+	used := q.used[quotaKey(r)]
+	now := q.now()
+	q.mu.Unlock()
+	if used < q.limit {
+		return true
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	w.Header().Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+	s.renderError(w, r, http.StatusTooManyRequests, fmt.Sprintf("今日下载流量(%s)已用完，请明天再试", humanizeBytes(q.limit)))
+	return false
+}
+
+// take 从客户端 key 今天剩余的配额中扣除至多 n 字节，返回实际扣除的字节数
+func (q *downloadQuota) take(key string, n int64) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollLocked()
+	if left := q.limit - q.used[key]; n > left {
+		n = max(left, 0)
+	}
+	if n > 0 {
+		q.used[key] += n
+		q.dirty = true
+	}
+	return n
+}
+
+// errQuotaExceeded 表示下载中途用完了当天的配额
+var errQuotaExceeded = errors.New("今日下载流量已用完")
+
+// quotaWriter 在写入前扣除下载配额，只写入配额允许的部分，不够时返回 errQuotaExceeded。
+// 边发送边扣除，同一客户端同时进行的多个下载合计也不会超过配额
+type quotaWriter struct {
+	http.ResponseWriter
+	q   *downloadQuota
+	key string
+}
+
+// withQuota 在开启 -daily-quota 时用 quotaWriter 包装 w
+func (s *Server) withQuota(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if s.quota == nil {
+		return w
+	}
+	return &quotaWriter{ResponseWriter: w, q: s.quota, key: quotaKey(r)}
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	allowed := w.q.take(w.key, int64(len(p)))
+	n, err := w.ResponseWriter.Write(p[:allowed])
+	if err == nil && n < len(p) {
+		err = errQuotaExceeded
+	}
+	return n, err
+}
+
+// Unwrap 让 http.ResponseController 能找到底层连接
+func (w *quotaWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// quotaState 是 -quota-file 的内容
+type quotaState struct {
+	Day  string           `json:"day"`
+	Used map[string]int64 `json:"used"`
+}
+
+// load 读取保存的计数，只有日期是今天时才使用
+func (q *downloadQuota) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var state quotaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollLocked()
+	if state.Day == q.day && state.Used != nil {
+		q.used = state.Used
+	}
+	q.dirty = false
+	return nil
+}
+
+// save 把计数写入临时文件再改名，写到一半崩溃也不会留下损坏的文件
+func (q *downloadQuota) save(path string) error {
+	q.mu.Lock()
+	q.rollLocked()
+	data, err := json.Marshal(quotaState{Day: q.day, Used: q.used})
+	q.dirty = false
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// persist 每隔 interval 把有变化的计数保存到文件
+func (q *downloadQuota) persist(path string, interval time.Duration) {
+	for range time.Tick(interval) {
+		q.mu.Lock()
+		dirty := q.dirty
+		q.mu.Unlock()
+		if !dirty {
+			continue
+		}
+		if err := q.save(path); err != nil {
+			log.Printf("保存下载配额失败: %v", err)
+		}
+	}
+}
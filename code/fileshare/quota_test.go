@@ -0,0 +1,138 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 超出 -daily-quota 后当天的下载返回429，目录列表和其他客户端不受影响，过了零点恢复
+func TestDailyQuota(t *testing.T) {
+	s, _ := newTestServer(t, Config{DailyQuota: 10}, map[string]string{"a.txt": "123456", "dir/b.txt": "x"})
+	now := time.Date(2026, 3, 1, 23, 59, 30, 0, time.Local)
+	s.quota.now = func() time.Time { return now }
+	h := s.Handler()
+
+	get := func(ip, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = ip + ":40000"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("192.168.1.10", "/a.txt"); rec.Code != http.StatusOK || rec.Body.String() != "123456" {
+		t.Fatalf("第 1 次下载 = %d %q", rec.Code, rec.Body.String())
+	}
+	// 只剩 4 字节的配额，发送到一半截断，而不是整个文件发完再计数
+	if rec := get("192.168.1.10", "/a.txt"); rec.Body.String() != "1234" {
+		t.Fatalf("第 2 次下载收到 %q, 应在配额用完时截断为 4 字节", rec.Body.String())
+	}
+	rec := get("192.168.1.10", "/a.txt")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("超出配额后下载 = %d, 应为429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "31" {
+		t.Errorf("Retry-After = %q, 应为距零点的 31 秒", got)
+	}
+	if rec := get("192.168.1.10", "/dir/?download=zip"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("超出配额后打包下载 = %d, 应为429", rec.Code)
+	}
+	if rec := get("192.168.1.10", "/"); rec.Code != http.StatusOK {
+		t.Errorf("超出配额后目录列表 = %d, 应为200", rec.Code)
+	}
+	if rec := get("192.168.1.11", "/a.txt"); rec.Code != http.StatusOK {
+		t.Errorf("其他客户端下载 = %d, 应为200", rec.Code)
+	}
+
+	now = now.Add(31 * time.Second) // 第二天 00:00:01
+	if rec := get("192.168.1.10", "/a.txt"); rec.Code != http.StatusOK {
+		t.Errorf("过了零点后下载 = %d, 应为200", rec.Code)
+	}
+}
+
+// 多个下载同时进行时合计不超过配额，打包下载同样在配额用完时截断
+func TestDailyQuotaConcurrent(t *testing.T) {
+	files := map[string]string{"dir/a.bin": strings.Repeat("a", 64<<10), "dir/b.bin": strings.Repeat("b", 64<<10)}
+	s, _ := newTestServer(t, Config{DailyQuota: 100 << 10}, files)
+	h := s.Handler()
+
+	var wg sync.WaitGroup
+	var total atomic.Int64
+	for _, target := range []string{"/dir/a.bin", "/dir/b.bin", "/dir/?download=zip"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+			if rec.Code == http.StatusOK { // 开始时配额已用完的返回429，响应是错误信息
+				total.Add(int64(rec.Body.Len()))
+			}
+		}()
+	}
+	wg.Wait()
+	if got := total.Load(); got != 100<<10 {
+		t.Errorf("同时下载共发送 %d 字节, 应正好用完 %d 字节的配额", got, 100<<10)
+	}
+}
+
+func TestDownloadQuotaRoll(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	q := newDownloadQuota(100)
+	q.now = func() time.Time { return now }
+	req := httptest.NewRequest("GET", "/", nil)
+
+	key := quotaKey(req)
+	q.take(key, 60)
+	q.take(key, 30)
+	now = time.Date(2026, 3, 1, 23, 59, 59, 0, time.Local)
+	if got := q.take(key, 20); got != 10 {
+		t.Errorf("剩余 10 字节时扣除了 %d 字节", got)
+	}
+	if got := q.take(key, 5); got != 0 || q.used[key] != 100 {
+		t.Errorf("配额用完后扣除了 %d 字节, 累计 %d", got, q.used[key])
+	}
+	now = time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)
+	q.take(key, 7)
+	if got := q.used[quotaKey(req)]; got != 7 || q.day != "2026-03-02" {
+		t.Errorf("零点后累计 %d 字节(日期 %s), 应清零后重新计数", got, q.day)
+	}
+}
+
+// -quota-file 保存的计数重启后继续生效，但只用于同一天
+func TestDownloadQuotaPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	clock := func() time.Time { return now }
+	req := httptest.NewRequest("GET", "/", nil)
+
+	q := newDownloadQuota(100)
+	q.now = clock
+	q.take(quotaKey(req), 42)
+	if err := q.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newDownloadQuota(100)
+	restarted.now = clock
+	if err := restarted.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.used[quotaKey(req)]; got != 42 {
+		t.Errorf("重启后计数为 %d, 应为 42", got)
+	}
+
+	now = now.Add(24 * time.Hour)
+	nextDay := newDownloadQuota(100)
+	nextDay.now = clock
+	if err := nextDay.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextDay.used[quotaKey(req)]; got != 0 {
+		t.Errorf("第二天读取昨天的计数为 %d, 应为 0", got)
+	}
+}
@@ -0,0 +1,192 @@
+package fileshare
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxReadmeSize 是 -render-readme 读取 README 的上限，超出部分不显示
+const maxReadmeSize = 256 << 10
+
+// dirReadme 在目录条目中查找 README.md / README.txt(不区分大小写，优先 .md)并渲染，没有时返回空
+func dirReadme(dirPath string, files []os.DirEntry) template.HTML {
+	var name string
+	for _, file := range files {
+		lower := strings.ToLower(file.Name())
+		if file.IsDir() || (lower != "readme.md" && lower != "readme.txt") {
+			continue
+		}
+		if name == "" || lower == "readme.md" {
+			name = file.Name()
+		}
+	}
+	if name == "" {
+		return ""
+	}
+
+	f, err := os.Open(filepath.Join(dirPath, name))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, maxReadmeSize))
+	if err != nil {
+		return ""
+	}
+	if strings.EqualFold(filepath.Ext(name), ".md") {
+		return renderMarkdown(string(content))
+	}
+	return template.HTML("<pre>" + html.EscapeString(string(content)) + "</pre>")
+}
+
+// renderMarkdown 把常用的 Markdown 语法(标题、段落、列表、引用、代码块、分隔线、
+// 行内代码、粗体、斜体、链接和图片)转换成 HTML。所有文本都先转义，原始 HTML 不会生效
+func renderMarkdown(src string) template.HTML {
+	var b strings.Builder
+	var para []string
+	listTag := ""
+	inCode := false
+
+	flushPara := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + inlineMarkdown(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			b.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	listItem := func(tag, text string) {
+		flushPara()
+		if listTag != tag {
+			closeList()
+			b.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+		b.WriteString("<li>" + inlineMarkdown(text) + "</li>\n")
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		t := strings.TrimSpace(line)
+		if inCode {
+			if strings.HasPrefix(t, "```") {
+				b.WriteString("</code></pre>\n")
+				inCode = false
+			} else {
+				b.WriteString(html.EscapeString(line) + "\n")
+			}
+			continue
+		}
+
+		level := len(t) - len(strings.TrimLeft(t, "#"))
+		switch {
+		case strings.HasPrefix(t, "```"):
+			flushPara()
+			closeList()
+			b.WriteString("<pre><code>")
+			inCode = true
+		case t == "":
+			flushPara()
+			closeList()
+		case level >= 1 && level <= 6 && (len(t) == level || t[level] == ' '):
+			flushPara()
+			closeList()
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", level, inlineMarkdown(strings.TrimSpace(t[level:])), level)
+		case t == "---" || t == "***" || t == "___":
+			flushPara()
+			closeList()
+			b.WriteString("<hr>\n")
+		case strings.HasPrefix(t, ">"):
+			flushPara()
+			closeList()
+			b.WriteString("<blockquote>" + inlineMarkdown(strings.TrimSpace(t[1:])) + "</blockquote>\n")
+		case strings.HasPrefix(t, "- ") || strings.HasPrefix(t, "* ") || strings.HasPrefix(t, "+ "):
+			listItem("ul", t[2:])
+		default:
+			if num, text, ok := strings.Cut(t, ". "); ok && num != "" && strings.Trim(num, "0123456789") == "" {
+				listItem("ol", text)
+				continue
+			}
+			closeList()
+			para = append(para, t)
+		}
+	}
+	if inCode {
+		b.WriteString("</code></pre>\n")
+	}
+	flushPara()
+	closeList()
+	return template.HTML(b.String())
+}
+
+// inlineMarkdown 处理一行内的 `代码`、**粗体**、*斜体*、[链接](url) 和 ![图片](url)，其余文本转义输出
+func inlineMarkdown(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				b.WriteString("<code>" + html.EscapeString(rest[1:1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				b.WriteString("<strong>" + inlineMarkdown(rest[2:2+end]) + "</strong>")
+				i += end + 4
+				continue
+			}
+		case rest[0] == '*':
+			if end := strings.IndexByte(rest[1:], '*'); end > 0 {
+				b.WriteString("<em>" + inlineMarkdown(rest[1:1+end]) + "</em>")
+				i += end + 2
+				continue
+			}
+		case rest[0] == '[' || strings.HasPrefix(rest, "!["):
+			image := rest[0] == '!'
+			start := 1
+			if image {
+				start = 2
+			}
+			if mid := strings.Index(rest, "]("); mid > 0 {
+				if end := strings.IndexByte(rest[mid:], ')'); end > 0 {
+					text, link := rest[start:mid], safeLink(rest[mid+2:mid+end])
+					if image {
+						b.WriteString(`<img src="` + html.EscapeString(link) + `" alt="` + html.EscapeString(text) + `">`)
+					} else {
+						b.WriteString(`<a href="` + html.EscapeString(link) + `">` + inlineMarkdown(text) + "</a>")
+					}
+					i += mid + end + 1
+					continue
+				}
+			}
+		}
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return b.String()
+}
+
+// safeLink 只保留相对路径和 http/https/mailto 链接，其他协议(如 javascript:)替换为 #
+func safeLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil {
+		return "#"
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return link
+	}
+	return "#"
+}
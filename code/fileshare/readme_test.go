@@ -0,0 +1,68 @@
+package fileshare
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"# 标题\n\n正文 **粗体** 和 *斜体*\n第二行", "<h1>标题</h1>\n<p>正文 <strong>粗体</strong> 和 <em>斜体</em> 第二行</p>\n"},
+		{"- 一\n- 二\n\n1. 甲\n2. 乙", "<ul>\n<li>一</li>\n<li>二</li>\n</ul>\n<ol>\n<li>甲</li>\n<li>乙</li>\n</ol>\n"},
+		{"```\n<b>原样</b>\n```", "<pre><code>&lt;b&gt;原样&lt;/b&gt;\n</code></pre>\n"},
+		{"> 引用 `a<b`\n---", "<blockquote>引用 <code>a&lt;b</code></blockquote>\n<hr>\n"},
+		{"[文档](docs/a.md) ![图](a.png)", `<p><a href="docs/a.md">文档</a> <img src="a.png" alt="图"></p>` + "\n"},
+		// 原始 HTML 和危险链接都不生效
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"[点我](javascript:alert(1))", `<p><a href="#">点我</a>)</p>` + "\n"},
+	}
+	for _, tt := range tests {
+		if got := string(renderMarkdown(tt.src)); got != tt.want {
+			t.Errorf("renderMarkdown(%q) =\n%s\n应为\n%s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestListingReadme(t *testing.T) {
+	files := map[string]string{
+		"md/README.md":    "# 照片说明\n\n拍摄于 **2024** 年 <b>不是标签</b>",
+		"md/a.jpg":        "",
+		"txt/readme.txt":  "纯文本 <i>说明</i>\n第二行",
+		"both/README.txt": "文本版",
+		"both/README.md":  "Markdown 版",
+		"none/a.txt":      "",
+	}
+	s, _ := newTestServer(t, Config{RenderReadme: true}, files)
+	h := s.Handler()
+	tests := []struct {
+		target string
+		want   []string
+		reject []string
+	}{
+		{"/md/", []string{`<div class="readme"><h1>照片说明</h1>`, "<strong>2024</strong>", "&lt;b&gt;不是标签&lt;/b&gt;"}, []string{"<b>不是标签</b>"}},
+		{"/txt/", []string{`<div class="readme"><pre>纯文本 &lt;i&gt;说明&lt;/i&gt;` + "\n第二行</pre></div>"}, nil},
+		{"/both/", []string{"<p>Markdown 版</p>"}, []string{"文本版</pre>"}},
+		{"/none/", nil, []string{`<div class="readme">`}},
+	}
+	for _, tt := range tests {
+		body := do(t, h, "GET", tt.target, nil).Body.String()
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s: 页面中没有 %q", tt.target, want)
+			}
+		}
+		for _, reject := range tt.reject {
+			if strings.Contains(body, reject) {
+				t.Errorf("GET %s: 页面中不应有 %q", tt.target, reject)
+			}
+		}
+	}
+
+	// 默认不渲染
+	plain, _ := newTestServer(t, Config{}, files)
+	if body := do(t, plain.Handler(), "GET", "/md/", nil).Body.String(); strings.Contains(body, "照片说明") {
+		t.Error("没有 -render-readme 时渲染了 README")
+	}
+}
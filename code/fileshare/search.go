@@ -0,0 +1,250 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// searchTemplate 是 /_nfs/search 的结果页面
+var searchTemplate = template.Must(template.New("").Funcs(template.FuncMap{"size": humanizeBytes}).Parse(`
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <link href="{{.Base}}/_nfs/assets/fonts.css" rel="stylesheet">
+    <title>搜索 - {{.Query}}</title>
+    <style>
+        body { font-family: "HarmonyOS Sans", "思源黑体", sans-serif; font-size:14px; max-width: 960px; margin: 0 auto; padding: 0 12px; }
+        a { color: #2196F3; text-decoration: none; }
+        li { padding: 6px 0; border-bottom: 1px solid #eee; list-style: none; }
+        ul { padding: 0; }
+        .total, .size { color: #999; }
+        @media (prefers-color-scheme: dark) {
+            body { background: #121212; color: #ddd; }
+            a { color: #64B5F6; }
+            li { border-bottom-color: #333; }
+        }
+    </style>
+</head>
+<body>
+    <h2>🔍 搜索</h2>
+    <form method="get" action="{{.Base}}/_nfs/search">
+        <input type="hidden" name="path" value="{{.Dir}}">
+        <input type="text" name="q" value="{{.Query}}" placeholder="文件名，可用 * ? 通配符" required autofocus>
+        <button type="submit">搜索</button>
+    </form>
+    <p class="total">在 /{{.Dir}} 中找到 {{len .Results}} 个文件{{if .Truncated}}，只显示前 {{.Limit}} 个{{end}}
+        · <a href="{{.DirURL}}">返回目录</a></p>
+    <ul>{{range .Results}}
+        <li><a href="{{.URL}}">{{.Path}}</a> <span class="size">{{size .Size}}</span></li>{{end}}
+    </ul>
+</body>
+</html>
+`))
+
+// 搜索的限制：最多返回 searchLimit 个结果，searchWorkers 个协程分别遍历起点下的各个子目录
+const (
+	searchLimit   = 500
+	searchWorkers = 4
+)
+
+// searchRoot 是一个搜索起点：完整路径和相对共享根目录的路径
+type searchRoot struct {
+	full, rel string
+}
+
+// searchMatcher 返回按文件名匹配的函数：q 含 * ? [ 时按通配符匹配整个文件名，否则按包含关系，都不区分大小写
+func searchMatcher(q string) (func(name string) bool, error) {
+	q = strings.ToLower(q)
+	if !strings.ContainsAny(q, "*?[") {
+		return func(name string) bool { return strings.Contains(strings.ToLower(name), q) }, nil
+	}
+	if _, err := path.Match(q, ""); err != nil {
+		return nil, err
+	}
+	return func(name string) bool {
+		ok, _ := path.Match(q, strings.ToLower(name))
+		return ok
+	}, nil
+}
+
+// handleSearch 在目录树中按文件名搜索，如 /_nfs/search?q=报告&path=docs 或 /_nfs/search?q=*.mp4，
+// 加 ?format=json 或 Accept: application/json 返回 JSON。和打包下载一样跳过隐藏的、
+// 扩展名不允许的以及没有密码的受保护目录里的文件，遍历深度受 -max-depth 限制
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	match, err := searchMatcher(q)
+	if q == "" || err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "搜索条件无效")
+		return
+	}
+	fullPath, relPath, err := s.resolvePath(r.URL.Query().Get("path"))
+	if err != nil || fullPath != "" && s.pathHidden(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "目录未找到")
+		return
+	}
+	var roots []searchRoot
+	if fullPath == "" {
+		for _, m := range s.mounts {
+			roots = append(roots, searchRoot{m.root, m.name})
+		}
+	} else {
+		if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+			s.renderError(w, r, http.StatusNotFound, "目录未找到")
+			return
+		}
+		if !s.checkDirAuth(w, r, fullPath) {
+			return
+		}
+		roots = append(roots, searchRoot{fullPath, relPath})
+	}
+
+	var (
+		mu        sync.Mutex
+		results   = []jsonEntry{}
+		truncated bool
+		full      atomic.Bool // 结果已满，所有协程都停止遍历
+	)
+	// add 记录一个匹配的文件，结果已满时返回 filepath.SkipAll，让遍历停止
+	add := func(root searchRoot, p string) error {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root.full, p)
+		if err != nil {
+			return nil
+		}
+		rel = path.Join(filepath.ToSlash(root.rel), filepath.ToSlash(rel))
+		mu.Lock()
+		defer mu.Unlock()
+		if len(results) >= searchLimit {
+			truncated = true
+			full.Store(true)
+			return filepath.SkipAll
+		}
+		results = append(results, jsonEntry{Name: info.Name(), Path: rel, URL: s.siteURL(rel), Size: info.Size(), MTime: info.ModTime().UTC(), MIME: s.mimeByName(info.Name())})
+		return nil
+	}
+
+	// 起点目录里的文件直接匹配，子目录交给协程池遍历
+	jobs := make(chan searchRoot)
+	var wg sync.WaitGroup
+	for i := 0; i < searchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			include := s.archiveFilter(r, "")
+			for job := range jobs {
+				if full.Load() {
+					continue // 结果已满，取出剩下的任务但不再遍历
+				}
+				s.walkFrom(job.full, 1, walkOptions{}, func(p string, d fs.DirEntry) error {
+					if full.Load() {
+						return filepath.SkipAll
+					}
+					if err := r.Context().Err(); err != nil {
+						return err
+					}
+					if !d.Type().IsRegular() || !match(d.Name()) || !include(p, false) {
+						return nil
+					}
+					return add(job, p)
+				})
+			}
+		}()
+	}
+	include := s.archiveFilter(r, "")
+	stopped := false
+	for _, root := range roots {
+		entries, err := os.ReadDir(root.full)
+		if err != nil {
+			log.Printf("搜索时跳过 %s: %v", root.full, err)
+			continue
+		}
+		for _, entry := range entries {
+			if r.Context().Err() != nil || full.Load() {
+				stopped = true
+				break
+			}
+			p := filepath.Join(root.full, entry.Name())
+			if entry.Type()&fs.ModeSymlink != 0 {
+				if !s.linkConfined(p) {
+					continue
+				}
+				info, err := os.Stat(p)
+				if err != nil {
+					continue
+				}
+				entry = fs.FileInfoToDirEntry(info)
+			}
+			if entry.IsDir() {
+				if include(p, true) {
+					jobs <- searchRoot{p, filepath.Join(root.rel, entry.Name())}
+				}
+				continue
+			}
+			if entry.Type().IsRegular() && match(entry.Name()) && include(p, false) && add(root, p) != nil {
+				stopped = true
+				break
+			}
+		}
+		if stopped {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if r.Context().Err() != nil {
+		return
+	}
+	sort.Slice(results, func(i, j int) bool { return naturalLess(results[i].Path, results[j].Path) })
+	log.Printf("[search]%q 在 %s 中找到 %d 个文件", q, filepath.ToSlash(relPath), len(results))
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Accept")
+		if r.Method == http.MethodHead {
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Query     string      `json:"query"`
+			Path      string      `json:"path"`
+			Results   []jsonEntry `json:"results"`
+			Truncated bool        `json:"truncated"`
+		}{q, filepath.ToSlash(relPath), results, truncated})
+		return
+	}
+
+	dir := filepath.ToSlash(relPath)
+	if dir == "." {
+		dir = ""
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Vary", "Accept")
+	if r.Method == http.MethodHead {
+		return
+	}
+	err = searchTemplate.Execute(w, struct {
+		Query     string
+		Dir       string
+		DirURL    string
+		Results   []jsonEntry
+		Truncated bool
+		Limit     int
+		Base      string
+	}{q, dir, s.dirURL(dir), results, truncated, searchLimit, s.basePath})
+	if err != nil {
+		log.Printf("渲染搜索结果失败: %v", err)
+	}
+}
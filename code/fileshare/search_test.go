@@ -0,0 +1,29 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// 结果达到 searchLimit 后所有协程停止遍历，只返回前 searchLimit 个并标记 truncated
+func TestSearchLimit(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < searchLimit+100; i++ {
+		files[fmt.Sprintf("d%d/match%d.txt", i%8, i)] = "x"
+	}
+	files["top-match.txt"] = "x"
+	s, _ := newTestServer(t, Config{}, files)
+
+	rec := do(t, s.Handler(), "GET", "/_nfs/search?q=match&format=json", nil)
+	var got struct {
+		Results   []jsonEntry `json:"results"`
+		Truncated bool        `json:"truncated"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%d %v", rec.Code, err)
+	}
+	if len(got.Results) != searchLimit || !got.Truncated {
+		t.Errorf("找到 %d 个结果, truncated=%v, 应为 %d 个且 truncated", len(got.Results), got.Truncated, searchLimit)
+	}
+}
@@ -0,0 +1,95 @@
+package fileshare
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// evalSymlinks 用于 resolveRoot，测试中替换它来模拟无法解析符号链接的文件系统
+var evalSymlinks = filepath.EvalSymlinks
+
+// resolveRoot 解析共享根目录的符号链接。只有目录不存在才是致命错误；
+// 其他失败（如 Android /sdcard 这类 FUSE 挂载上无法解析链接）退回到清理后的绝对路径
+func resolveRoot(dir string) (string, error) {
+	resolved, err := evalSymlinks(dir)
+	if err == nil {
+		return resolved, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	abs, absErr := filepath.Abs(dir)
+	if absErr != nil {
+		return "", err
+	}
+	log.Printf("警告: 无法解析 %s 的符号链接(%v)，直接使用 %s", dir, err, abs)
+	return abs, nil
+}
+
+// sensitivePaths 返回 goos 系统上不应被整个共享出去的目录；getenv 用于读取 Windows 的系统盘位置，home 是用户目录
+func sensitivePaths(goos string, getenv func(string) string, home string) []string {
+	var paths []string
+	if goos == "windows" {
+		drive := getenv("SystemDrive")
+		if drive == "" {
+			drive = "C:"
+		}
+		paths = append(paths, drive+`\`, drive+`\Windows`)
+		if sysRoot := getenv("SystemRoot"); sysRoot != "" {
+			paths = append(paths, sysRoot)
+		}
+	} else {
+		paths = append(paths, "/", "/etc", "/root", "/boot", "/usr", "/var")
+	}
+	if home != "" {
+		paths = append(paths, home)
+	}
+	return paths
+}
+
+// isSensitivePath 判断共享目录是否就是敏感目录，或者包含了某个敏感目录（是它的上级）
+func isSensitivePath(root string) bool {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	home, _ := os.UserHomeDir()
+	for _, s := range sensitivePaths(runtime.GOOS, os.Getenv, home) {
+		if pathContains(runtime.GOOS, root, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathContains 判断 goos 系统上的 child 是否等于 parent 或位于 parent 之下；Windows 路径不区分大小写
+func pathContains(goos, parent, child string) bool {
+	sep := "/"
+	if goos == "windows" {
+		sep = `\`
+		parent, child = strings.ToLower(parent), strings.ToLower(child)
+	}
+	child = strings.TrimSuffix(child, sep)
+	if parent == child || parent == child+sep {
+		return true
+	}
+	if !strings.HasSuffix(parent, sep) {
+		parent += sep
+	}
+	return strings.HasPrefix(child, parent)
+}
+
+// ValidateDirectory 检查 path 是否为存在的目录
+func ValidateDirectory(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return os.ErrInvalid
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package fileshare
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSensitivePaths(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	tests := []struct {
+		goos      string
+		getenv    func(string) string
+		home      string
+		sensitive []string
+		safe      []string
+	}{
+		{
+			goos:      "linux",
+			getenv:    env(nil),
+			home:      "/home/alice",
+			sensitive: []string{"/", "/etc", "/etc/", "/root", "/usr", "/var", "/home", "/home/alice", "/home/alice/"},
+			safe:      []string{"/srv/share", "/etcetera", "/var/www", "/home/alice/Music", "/home/alicebob", "/mnt/usb"},
+		},
+		{
+			goos:      "darwin",
+			getenv:    env(nil),
+			home:      "/Users/alice",
+			sensitive: []string{"/", "/Users", "/Users/alice"},
+			safe:      []string{"/Users/alice/Movies", "/Volumes/usb", "/users/alice/movies"},
+		},
+		{
+			goos:      "windows",
+			getenv:    env(nil), // 没有 SystemDrive 时按 C: 处理
+			home:      `C:\Users\alice`,
+			sensitive: []string{`C:\`, `c:\`, `C:\Windows`, `c:\WINDOWS\`, `C:\Users`, `C:\Users\alice`, `c:\users\ALICE`},
+			safe:      []string{`C:\Users\alice\Pictures`, `D:\share`, `C:\Windows2`, `C:\Windows\Temp`},
+		},
+		{
+			goos:      "windows",
+			getenv:    env(map[string]string{"SystemDrive": "D:", "SystemRoot": `D:\WinNT`}),
+			sensitive: []string{`D:\`, `D:\WinNT`, `D:\Windows`},
+			safe:      []string{`C:\share`, `D:\share`, `D:\WinNT\Temp`},
+		},
+	}
+	for _, tt := range tests {
+		paths := sensitivePaths(tt.goos, tt.getenv, tt.home)
+		contains := func(root string) bool {
+			for _, p := range paths {
+				if pathContains(tt.goos, root, p) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, root := range tt.sensitive {
+			if !contains(root) {
+				t.Errorf("%s: %s 应为敏感目录(%q)", tt.goos, root, paths)
+			}
+		}
+		for _, root := range tt.safe {
+			if contains(root) {
+				t.Errorf("%s: %s 不应为敏感目录(%q)", tt.goos, root, paths)
+			}
+		}
+	}
+}
+
+// 共享敏感目录需要 Force 或确认，拒绝时 New 返回错误
+func TestNewConfirmsSensitiveRoot(t *testing.T) {
+	root := string(filepath.Separator)
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	if !isSensitivePath(root) {
+		t.Fatalf("%s 应为敏感目录", root)
+	}
+
+	asked := ""
+	_, err := New(Config{Dirs: []string{root}, ConfirmSensitive: func(r string) bool { asked = r; return false }})
+	if err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("拒绝确认时 New 返回 %v", err)
+	}
+	if asked == "" {
+		t.Error("没有请求确认")
+	}
+	if _, err := New(Config{Dirs: []string{root}}); err == nil {
+		t.Error("没有确认函数也没有 Force 时应拒绝")
+	}
+	if _, err := New(Config{Dirs: []string{root}, ConfirmSensitive: func(string) bool { return true }}); err != nil {
+		t.Errorf("确认后 New 返回 %v", err)
+	}
+	if _, err := New(Config{Dirs: []string{root}, Force: true}); err != nil {
+		t.Errorf("Force 时 New 返回 %v", err)
+	}
+	if _, err := New(Config{Dirs: []string{t.TempDir()}, ConfirmSensitive: func(string) bool { t.Error("普通目录不应请求确认"); return false }}); err != nil {
+		t.Error(err)
+	}
+}
+
+// 共享目录存在但无法解析符号链接时(如 Android 的 FUSE 挂载)退回到绝对路径，照常启动
+func TestResolveRootFallback(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "a"})
+	orig := evalSymlinks
+	t.Cleanup(func() { evalSymlinks = orig })
+	evalSymlinks = func(p string) (string, error) {
+		if _, err := os.Stat(p); err != nil {
+			return "", err
+		}
+		return "", &fs.PathError{Op: "lstat", Path: p, Err: syscall.EIO}
+	}
+
+	s, err := New(Config{Dirs: []string{root + string(filepath.Separator) + "."}, Force: true})
+	if err != nil {
+		t.Fatalf("无法解析符号链接时启动失败: %v", err)
+	}
+	if s.rootDir != root {
+		t.Errorf("rootDir = %q, 应为 %q", s.rootDir, root)
+	}
+	if rec := do(t, s.Handler(), "GET", "/a.txt", nil); rec.Body.String() != "a" {
+		t.Errorf("GET /a.txt = %d %q", rec.Code, rec.Body.String())
+	}
+
+	// 目录不存在仍然是致命错误
+	if _, err := resolveRoot(filepath.Join(root, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("目录不存在时 resolveRoot 返回 %v", err)
+	}
+}
@@ -0,0 +1,613 @@
+package fileshare
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/webdav"
+)
+
+// Config 是文件服务器的全部选项，字段与命令行参数一一对应，说明见 main 中的参数帮助；
+// config 标签是参数名，也是配置文件中的选项名(见 LoadConfigFile)。
+// 零值表示不开启对应功能(Port 为空时使用 8080)，命令行的默认值见 DefaultConfig
+type Config struct {
+	Dirs         []string `config:"dir"`  // 共享目录；多个时每个都是 名称=路径 的形式
+	File         string   `config:"file"` // 只共享这一个文件
+	Port         string   `config:"port"`
+	BaseURL      string   `config:"base-url"`
+	TLS          bool     `config:"tls"`
+	Cert         string   `config:"cert"`
+	Key          string   `config:"key"`
+	Unix         string   `config:"unix"`
+	PageSize     int      `config:"page-size"`
+	Writable     bool     `config:"writable"`
+	RenderReadme bool     `config:"render-readme"`
+	WebDAV       bool     `config:"webdav"`
+	Template     string   `config:"template"`
+	Force        bool     `config:"force"`
+
+	AllowExt   []string `config:"allow-ext,split"`
+	DenyExt    []string `config:"deny-ext,split"`
+	AllowCIDR  []string `config:"allow-cidr,split"`
+	CORS       []string `config:"cors,split"`
+	IndexFiles []string `config:"index-files,split"`
+	MIME       []string `config:"mime,split"` // 扩展名=类型
+
+	Auth      string `config:"auth"` // 用户名:密码 或 htpasswd:文件路径
+	User      string `config:"user"`
+	Password  string `config:"password"`
+	UsersFile string `config:"users-file"`
+
+	MaxDepth        int           `config:"max-depth"`
+	MaxConns        int           `config:"max-conns"`
+	MaxConnsPerIP   int           `config:"max-conns-per-ip"`
+	RatePerIP       float64       `config:"rate-per-ip"`
+	DailyQuota      ByteSize      `config:"daily-quota"`
+	QuotaFile       string        `config:"quota-file"`
+	MaxRate         ByteSize      `config:"max-rate"`
+	MaxRatePerConn  ByteSize      `config:"max-rate-per-conn"`
+	BufferSize      ByteSize      `config:"buffer-size"`
+	IdleTimeout     time.Duration `config:"idle-timeout"`
+	WriteTimeout    time.Duration `config:"write-timeout"`
+	RequestTimeout  time.Duration `config:"request-timeout"`
+	ShutdownTimeout time.Duration `config:"shutdown-timeout"`
+	FollowSymlinks  bool          `config:"follow-symlinks"`
+
+	Favicon     string `config:"favicon"`
+	AuditLog    string `config:"audit-log"`
+	ShareSecret string `config:"share-secret"`
+	Dashboard   bool   `config:"dashboard"`
+
+	LogFile    string   `config:"log-file"`
+	LogMaxSize ByteSize `config:"log-max-size"`
+	LogKeep    int      `config:"log-keep"`
+	LogFormat  string   `config:"log-format"`
+	AccessLog  string   `config:"access-log"`
+
+	Gzip                bool   `config:"gzip"`
+	NoCompressDownloads bool   `config:"no-compress-downloads"`
+	Precompressed       bool   `config:"precompressed"`
+	Verbose             bool   `config:"verbose"`
+	Open                bool   `config:"open"`
+	QR                  bool   `config:"qr"`
+	MDNS                string `config:"mdns"`
+
+	// ConfirmSensitive 在共享系统敏感目录(见 isSensitivePath)且没有 Force 时调用，
+	// 返回 false 则 New 报错；为 nil 时直接报错
+	ConfirmSensitive func(root string) bool `config:"-"`
+}
+
+// DefaultConfig 返回与命令行参数默认值相同的配置
+func DefaultConfig() Config {
+	return Config{
+		Port:                "8080",
+		MaxDepth:            64,
+		BufferSize:          32 << 10,
+		IdleTimeout:         time.Minute,
+		ShutdownTimeout:     30 * time.Second,
+		LogMaxSize:          10 << 20,
+		LogKeep:             5,
+		LogFormat:           "default",
+		NoCompressDownloads: true,
+	}
+}
+
+// ByteSize 是字节数，可以写成 10m、5GB 这样的大小(见 parseByteSize)
+type ByteSize int64
+
+// Set 解析 v 并保存，可直接作为 flag.Func 的回调
+func (b *ByteSize) Set(v string) error {
+	n, err := parseByteSize(v)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+// Server 是一个文件共享服务。New 按 Config 准备好共享目录、认证和日志，
+// Handler 返回处理全部请求的 http.Handler，Listen、Serve、Shutdown 负责监听和退出
+type Server struct {
+	cfg Config
+
+	rootDir      string  // 单目录模式的共享目录
+	mounts       []mount // 多目录模式下以 /名称/ 挂载的目录
+	singleFile   string  // 单文件模式下共享的文件
+	basePath     string  // -base-url 规范成 /files 的形式，没有时为空
+	browsePrefix string  // 开启 -dashboard 后文件浏览移到 /browse/ 下
+	port         string  // 监听的端口，-port 0 时 Listen 后为实际分配的端口
+	shareURL     string  // 二维码使用的访问地址
+	useTLS       bool
+	tlsConfig    *tls.Config
+	localIP      localAddrs
+	listener     net.Listener
+	httpServer   *http.Server
+
+	allowExt     map[string]bool
+	denyExt      map[string]bool
+	allowedNets  []*net.IPNet
+	corsOrigins  []string
+	indexFiles   []string
+	mimeTypes    map[string]string
+	favicon      []byte
+	faviconType  string
+	listTemplate *template.Template
+	authBackend  Authenticator // 全站认证，nil 表示不需要登录
+	shareSecret  string
+	bufferSize   int
+	logFormat    string
+	accessLog    *log.Logger     // -log-format clf/json 时的访问日志，不带 log 包的时间前缀
+	accessFile   *LogFile        // -access-log 打开的文件，nil 表示写到 log 包的输出
+	audit        *auditLog       // nil 表示不记录
+	quota        *downloadQuota  // -daily-quota 的计数，nil 表示不限制
+	globalRate   *tokenBucket    // -max-rate，所有下载共用，nil 表示不限速
+	connSem      chan struct{}   // -max-conns，nil 表示不限制
+	uploadDir    string          // 分块上传的暂存目录，每个上传一个子目录
+	dav          *webdav.Handler // -webdav 的处理器，LOCK 的锁保存在其中，未开启时为 nil
+
+	startedAt    time.Time
+	requestCount atomic.Int64
+	transfers    transferStats // 所有下载(单文件和打包)的传输情况，供 /_nfs/stats 使用
+	stopping     chan struct{} // 开始停止服务时关闭，通知事件流等长连接结束
+
+	// clientLimits 按 IP 记录 clientState，长时间空闲的条目在数量过多时清理
+	clientMu     sync.Mutex
+	clientLimits map[string]*clientState
+
+	watchMu sync.Mutex
+	watches map[string]*dirWatch
+	watcher *fsnotify.Watcher // 第一次订阅目录变化时创建，所有目录共用
+
+	dirSizes *lruCache[cachedSize] // 文件夹大小的统计结果，见 dirSize
+
+	// authFiles 缓存 .nfsauth 路径 → 解析出的哈希，修改时间变化后重新读取
+	authMu    sync.Mutex
+	authFiles map[string]authEntry
+	passwords passwordCache
+
+	// uploadLocks 保存每个上传 ID 的互斥锁，同一个上传的多个分块并发到达时，
+	// 只有一个请求会去检查是否收齐并拼接文件
+	uploadLocks sync.Map
+
+	thumbs          *lruCache[[]byte]
+	ownerNames      sync.Map // uid/gid 到名字的查询结果，键为 "u123" 或 "g123"
+	caseInsensitive sync.Map // 每个共享根目录所在的文件系统是否不区分大小写
+}
+
+// New 校验配置，解析共享目录的符号链接，加载模板、图标、认证和日志文件
+func New(cfg Config) (*Server, error) {
+	s := &Server{
+		cfg:          cfg,
+		port:         cfg.Port,
+		useTLS:       cfg.TLS || cfg.Cert != "",
+		basePath:     strings.TrimSuffix("/"+strings.Trim(cfg.BaseURL, "/"), "/"),
+		listTemplate: dirListTemplate,
+		favicon:      defaultFavicon,
+		faviconType:  "image/x-icon",
+		mimeTypes:    map[string]string{},
+		bufferSize:   int(cfg.BufferSize),
+		logFormat:    cfg.LogFormat,
+		shareSecret:  cfg.ShareSecret,
+		globalRate:   newTokenBucket(int64(cfg.MaxRate)),
+		startedAt:    time.Now(),
+		stopping:     make(chan struct{}),
+		clientLimits: map[string]*clientState{},
+		watches:      map[string]*dirWatch{},
+		dirSizes:     newLRUCache[cachedSize](dirSizeCacheSize),
+		authFiles:    map[string]authEntry{},
+		thumbs:       newLRUCache[[]byte](thumbCacheSize),
+	}
+	if err := s.initRoots(); err != nil {
+		return nil, err
+	}
+	if cfg.WebDAV {
+		s.dav = s.newDAVHandler()
+	}
+
+	if s.port == "" {
+		s.port = "8080"
+	}
+	if _, err := parsePort(s.port); err != nil {
+		return nil, fmt.Errorf("端口参数无效: %v", err)
+	}
+	if s.bufferSize == 0 {
+		s.bufferSize = 32 << 10
+	}
+	if s.bufferSize < 4<<10 || s.bufferSize > 16<<20 {
+		return nil, fmt.Errorf("缓冲区大小需在 4k 到 16m 之间: %d", s.bufferSize)
+	}
+	if s.cfg.MDNS != "" && !validMDNSName(s.cfg.MDNS) {
+		return nil, fmt.Errorf("-mdns 名称只能包含字母、数字和 -: %q", s.cfg.MDNS)
+	}
+
+	if len(cfg.AllowExt) > 0 {
+		s.allowExt = parseExtList(strings.Join(cfg.AllowExt, ","))
+	}
+	if len(cfg.DenyExt) > 0 {
+		s.denyExt = parseExtList(strings.Join(cfg.DenyExt, ","))
+	}
+	for _, cidr := range cfg.AllowCIDR {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("-allow-cidr: %v", err)
+		}
+		s.allowedNets = append(s.allowedNets, ipNet)
+	}
+	for _, origin := range cfg.CORS {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			s.corsOrigins = append(s.corsOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	for _, name := range cfg.IndexFiles {
+		if name = strings.TrimSpace(name); name != "" {
+			s.indexFiles = append(s.indexFiles, name)
+		}
+	}
+	for _, pair := range cfg.MIME {
+		ext, ctype, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || ext == "" || ctype == "" {
+			return nil, fmt.Errorf("-mime 格式应为 扩展名=类型: %s", pair)
+		}
+		if _, _, err := mime.ParseMediaType(ctype); err != nil {
+			return nil, fmt.Errorf("无效的 MIME 类型 %s: %v", ctype, err)
+		}
+		s.mimeTypes["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = ctype
+	}
+
+	if err := s.initAuth(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.ParseFiles(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("加载模板失败: %v", err)
+		}
+		s.listTemplate = tmpl
+	}
+	if cfg.Favicon != "" {
+		data, err := os.ReadFile(cfg.Favicon)
+		if err != nil {
+			return nil, fmt.Errorf("读取网站图标失败: %v", err)
+		}
+		s.favicon = data
+		s.faviconType = http.DetectContentType(data)
+	}
+
+	// HTTPS：指定了证书就用证书，否则生成只在本次运行有效的自签名证书
+	s.localIP = getLocalIP()
+	if (cfg.Cert == "") != (cfg.Key == "") {
+		return nil, errors.New("-cert 和 -key 需要同时指定")
+	}
+	if s.useTLS {
+		var cert tls.Certificate
+		var err error
+		if cfg.Cert != "" {
+			cert, err = tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		} else {
+			cert, err = selfSignedCert(s.localIP)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("加载 HTTPS 证书失败: %v", err)
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	if err := s.initLogs(); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxConns > 0 {
+		s.connSem = make(chan struct{}, cfg.MaxConns)
+	}
+	if cfg.DailyQuota > 0 {
+		s.quota = newDownloadQuota(int64(cfg.DailyQuota))
+		if cfg.QuotaFile != "" {
+			if err := s.quota.load(cfg.QuotaFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("读取下载配额文件失败: %v", err)
+			}
+			go s.quota.persist(cfg.QuotaFile, 30*time.Second)
+		}
+	}
+	if s.shareSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("生成分享密钥失败: %v", err)
+		}
+		s.shareSecret = hex.EncodeToString(secret)
+	}
+	return s, nil
+}
+
+// initRoots 确定共享的是单个文件、单个目录还是多个挂载的目录，并解析它们的符号链接。
+// 共享系统敏感目录时需要 Force 或 ConfirmSensitive 确认
+func (s *Server) initRoots() error {
+	var err error
+	s.rootDir, s.mounts, err = parseMounts(s.cfg.Dirs)
+	if err != nil {
+		return fmt.Errorf("共享目录参数无效: %v", err)
+	}
+
+	// -dir 指向普通文件时按单文件模式处理
+	s.singleFile = s.cfg.File
+	if s.rootDir != "" && s.singleFile == "" {
+		if info, err := os.Stat(s.rootDir); err == nil && info.Mode().IsRegular() {
+			s.singleFile, s.rootDir = s.rootDir, ""
+		}
+	}
+	if s.singleFile != "" {
+		info, err := os.Stat(s.singleFile)
+		if err != nil || !info.Mode().IsRegular() {
+			return fmt.Errorf("共享文件无效: %s", s.singleFile)
+		}
+		if s.singleFile, err = filepath.Abs(s.singleFile); err != nil {
+			return fmt.Errorf("共享文件无效: %v", err)
+		}
+		s.rootDir, s.mounts = "", nil
+		return nil
+	}
+	if s.rootDir == "" && len(s.mounts) == 0 {
+		return errors.New("没有指定共享目录")
+	}
+
+	if s.rootDir != "" {
+		if s.rootDir, err = resolveRoot(s.rootDir); err != nil {
+			return fmt.Errorf("解析符号链接失败: %v", err)
+		}
+	}
+	for i := range s.mounts {
+		if err := ValidateDirectory(s.mounts[i].root); err != nil {
+			return fmt.Errorf("共享目录 %s 无效: %v", s.mounts[i].root, err)
+		}
+		if s.mounts[i].root, err = resolveRoot(s.mounts[i].root); err != nil {
+			return fmt.Errorf("解析符号链接失败: %v", err)
+		}
+	}
+
+	roots := []string{s.rootDir}
+	for _, m := range s.mounts {
+		roots = append(roots, m.root)
+	}
+	for _, root := range roots {
+		if root == "" || !isSensitivePath(root) || s.cfg.Force {
+			continue
+		}
+		if s.cfg.ConfirmSensitive == nil || !s.cfg.ConfirmSensitive(root) {
+			return fmt.Errorf("已取消。确实需要共享 %s 请加上 -force 参数", root)
+		}
+	}
+	// 分块上传按共享目录使用各自的暂存目录，同一台机器上的多个实例互不干扰，重启后仍可续传
+	sum := sha256.Sum256([]byte(strings.Join(roots, "\x00")))
+	s.uploadDir = filepath.Join(os.TempDir(), "nfs-uploads-"+hex.EncodeToString(sum[:8]))
+	return nil
+}
+
+// initAuth 按 -auth、-users-file 或 -user/-password 设置全站认证，三者只能用一种
+func (s *Server) initAuth() error {
+	cfg := s.cfg
+	if cfg.Auth != "" && cfg.UsersFile != "" {
+		return errors.New("-auth 和 -users-file 不能同时使用")
+	}
+	if cfg.Auth != "" || cfg.UsersFile != "" {
+		spec := cfg.Auth
+		if spec == "" {
+			spec = "htpasswd:" + cfg.UsersFile
+		}
+		a, err := parseAuth(spec)
+		if err != nil {
+			return fmt.Errorf("登录认证配置有误: %v", err)
+		}
+		s.authBackend = a
+	}
+
+	if cfg.User != "" || cfg.Password != "" {
+		if cfg.User == "" || cfg.Password == "" {
+			return errors.New("-user 和 -password 需要同时指定")
+		}
+		if s.authBackend != nil {
+			return errors.New("-user/-password 不能和 -auth、-users-file 同时使用")
+		}
+		s.authBackend = staticAuth{user: cfg.User, password: cfg.Password}
+	}
+	return nil
+}
+
+// initLogs 打开访问日志和审计日志。指定了 -access-log 但没有 -log-format 时使用 clf 格式，
+// 没有单独的文件时访问日志写到 log 包的输出
+func (s *Server) initLogs() error {
+	switch s.logFormat {
+	case "":
+		s.logFormat = "default"
+	case "default", "clf", "json":
+	default:
+		return fmt.Errorf("未知的日志格式: %s", s.logFormat)
+	}
+	if s.cfg.AccessLog != "" && s.logFormat == "default" {
+		s.logFormat = "clf"
+	}
+	if s.logFormat != "default" {
+		out := log.Writer()
+		if s.cfg.AccessLog != "" {
+			rf, err := openRotatingFile(s.cfg.AccessLog, int64(s.cfg.LogMaxSize), s.cfg.LogKeep)
+			if err != nil {
+				return fmt.Errorf("打开访问日志失败: %v", err)
+			}
+			s.accessFile, out = rf, rf
+		}
+		s.accessLog = log.New(out, "", 0)
+	}
+
+	if s.cfg.AuditLog != "" {
+		audit, err := openAuditLog(s.cfg.AuditLog)
+		if err != nil {
+			return fmt.Errorf("打开审计日志失败: %v", err)
+		}
+		s.audit = audit
+	}
+	return nil
+}
+
+// Reopen 重新打开访问日志和审计日志，logrotate 等工具改名切割后调用(main 在收到 SIGHUP 时调用)
+func (s *Server) Reopen() error {
+	var errs []error
+	if s.accessFile != nil {
+		if err := s.accessFile.Reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("重新打开访问日志失败: %v", err))
+		}
+	}
+	if s.audit != nil {
+		if err := s.audit.reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("重新打开审计日志失败: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// OpenLogFile 以追加方式打开 -log-file 指定的日志文件，超过 maxSize 自动切割并保留 keep 个旧文件；
+// 交给 logrotate 切割时在改名后调用 Reopen
+func OpenLogFile(path string, maxSize ByteSize, keep int) (*LogFile, error) {
+	return openRotatingFile(path, int64(maxSize), keep)
+}
+
+// Listen 监听 TCP 端口或 Unix 套接字并输出访问地址、二维码等启动信息。
+// 先绑定监听再输出，端口为0时才能显示实际分配的端口
+func (s *Server) Listen() error {
+	var err error
+	if s.cfg.Unix != "" {
+		if s.listener, err = listenUnix(s.cfg.Unix); err != nil {
+			return fmt.Errorf("监听 Unix 套接字失败: %v", err)
+		}
+	} else {
+		if s.listener, err = net.Listen("tcp", ":"+s.port); err != nil {
+			return errors.New(listenErrorHint(err, s.port))
+		}
+		s.port = strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+	}
+
+	// 二维码使用的访问地址，优先使用 IPv4
+	localIP := s.localIP
+	s.shareURL = s.hostURL("127.0.0.1", s.port)
+	if localIP.IPv6 != "" {
+		s.shareURL = s.hostURL(localIP.IPv6, s.port)
+	}
+	if localIP.IPv4 != "" {
+		s.shareURL = s.hostURL(localIP.IPv4, s.port)
+	}
+
+	sharedDirs := s.rootDir
+	if s.singleFile != "" {
+		sharedDirs = s.singleFile + " (单个文件)"
+	}
+	for _, m := range s.mounts {
+		sharedDirs += "\n    /" + m.name + "/ → " + m.root
+	}
+	lanURLs := ""
+	if localIP.IPv4 != "" {
+		lanURLs += "  局域网访问: " + s.hostURL(localIP.IPv4, s.port) + "\n"
+	}
+	if localIP.IPv6 != "" {
+		lanURLs += "  局域网访问(IPv6): " + s.hostURL(localIP.IPv6, s.port) + "\n"
+	}
+	if s.cfg.Unix != "" {
+		log.Printf("\n[start]文件服务器配置\n"+
+			"  共享目录: %s\n"+
+			"  Unix 套接字: %s\n"+
+			"  ctrl+c退出",
+			sharedDirs, s.cfg.Unix)
+	} else {
+		log.Printf("\n[start]文件服务器配置\n"+
+			"  共享目录: %s\n"+
+			"  监听端口: %s\n"+
+			"  本地访问: %s\n"+
+			"%s"+
+			"  ctrl+c退出",
+			sharedDirs, s.port, s.hostURL("127.0.0.1", s.port), lanURLs)
+	}
+
+	if s.tlsConfig != nil && s.cfg.Cert == "" {
+		log.Printf("[tls]使用自签名证书，浏览器会提示连接不安全，可核对证书指纹(SHA-256):\n  %s",
+			certFingerprint(s.tlsConfig.Certificates[0].Certificate[0]))
+	}
+
+	if s.cfg.QR && s.cfg.Unix == "" {
+		if qr, err := encodeQR(s.shareURL); err != nil {
+			log.Printf("生成二维码失败: %v", err)
+		} else {
+			fmt.Printf("手机扫码访问 %s\n%s", s.shareURL, qr.ASCII())
+		}
+	}
+
+	if s.cfg.MDNS != "" {
+		if s.cfg.Unix != "" || localIP.IPv4 == "" {
+			log.Printf("[mdns]没有局域网 IPv4 地址，不发布服务")
+		} else {
+			go s.advertiseMDNS(s.cfg.MDNS, localIP.IPv4, s.port)
+		}
+	}
+
+	// 写超时默认关闭，否则超过时限的大文件下载会被中途切断；
+	// 读取端仍然限时，防止慢速请求攻击(slowloris)
+	s.httpServer = &http.Server{
+		Handler:           s.Handler(),
+		TLSConfig:         s.tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      s.cfg.WriteTimeout,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	if s.cfg.Open && s.cfg.Unix == "" {
+		go launchBrowser(s.browserURL())
+	}
+	return nil
+}
+
+// Serve 在 Listen 打开的监听上处理请求，直到 Shutdown 后返回 http.ErrServerClosed
+func (s *Server) Serve() error {
+	if s.tlsConfig != nil {
+		return s.httpServer.ServeTLS(s.listener, "", "")
+	}
+	return s.httpServer.Serve(s.listener)
+}
+
+// Shutdown 停止接受新连接，通知事件流等长连接结束，等待进行中的下载完成；
+// ctx 结束时仍未完成的连接被强制断开。退出前保存下载配额
+func (s *Server) Shutdown(ctx context.Context) error {
+	wait := ""
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = fmt.Sprintf("(最长 %v)", time.Until(deadline).Round(time.Second))
+	}
+	log.Printf("[stop]正在停止，等待 %d 个进行中的传输完成%s", s.transfers.active.Load(), wait)
+	close(s.stopping)
+
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Printf("[stop]未等到全部完成，断开 %d 个进行中的传输", s.transfers.active.Load())
+		s.httpServer.Close()
+	}
+
+	if s.quota != nil && s.cfg.QuotaFile != "" {
+		if err := s.quota.save(s.cfg.QuotaFile); err != nil {
+			log.Printf("保存下载配额失败: %v", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,577 @@
+package fileshare
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer 在临时目录中创建 files 描述的文件(路径 → 内容)，返回共享该目录的 Server 和目录路径
+func newTestServer(t *testing.T, cfg Config, files map[string]string) (*Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	writeFiles(t, root, files)
+	cfg.Dirs = append(cfg.Dirs, root)
+	cfg.Force = true
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s, root
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// do 用 httptest 向 h 发送一个请求，header 依次是 名称、值
+func do(t *testing.T, h http.Handler, method, target string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerServesFilesAndListings(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{
+		"hello.txt":     "你好",
+		"docs/read.txt": "doc",
+	})
+	h := s.Handler()
+
+	rec := do(t, h, "GET", "/hello.txt", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "你好" {
+		t.Fatalf("GET /hello.txt = %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = do(t, h, "GET", "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / = %d", rec.Code)
+	}
+	for _, want := range []string{"hello.txt", "docs"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("目录列表中没有 %s", want)
+		}
+	}
+
+	if rec := do(t, h, "GET", "/docs/read.txt", nil); rec.Body.String() != "doc" {
+		t.Errorf("GET /docs/read.txt = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, "GET", "/missing.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /missing.txt = %d, 应为404", rec.Code)
+	}
+	if rec := do(t, h, "GET", healthPath, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET %s = %d", healthPath, rec.Code)
+	}
+}
+
+func TestHandlerReadOnlyByDefault(t *testing.T) {
+	form := url.Values{"dir": {""}, "name": {"new"}}.Encode()
+
+	ro, roRoot := newTestServer(t, Config{}, nil)
+	rec := do(t, ro.Handler(), "POST", "/_nfs/mkdir", strings.NewReader(form), "Content-Type", "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("只读模式 POST /mkdir = %d, 应为403", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(roRoot, "new")); err == nil {
+		t.Error("只读模式下创建了文件夹")
+	}
+
+	rw, rwRoot := newTestServer(t, Config{Writable: true}, nil)
+	rec = do(t, rw.Handler(), "POST", "/_nfs/mkdir", strings.NewReader(form), "Content-Type", "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("可写模式 POST /mkdir = %d, 应为303", rec.Code)
+	}
+	if info, err := os.Stat(filepath.Join(rwRoot, "new")); err != nil || !info.IsDir() {
+		t.Errorf("可写模式下没有创建文件夹: %v", err)
+	}
+}
+
+// 同一进程中的多个 Server 互不影响：各自的共享目录、路径前缀和认证
+func TestMultipleServersAreIndependent(t *testing.T) {
+	a, _ := newTestServer(t, Config{BaseURL: "/a/"}, map[string]string{"a.txt": "A"})
+	b, _ := newTestServer(t, Config{User: "bob", Password: "secret"}, map[string]string{"b.txt": "B"})
+	ha, hb := a.Handler(), b.Handler()
+
+	if rec := do(t, ha, "GET", "/a/a.txt", nil); rec.Body.String() != "A" {
+		t.Errorf("a: GET /a/a.txt = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, ha, "GET", "/a/b.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("a: GET /a/b.txt = %d, 应为404", rec.Code)
+	}
+	if rec := do(t, ha, "GET", "/a.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("a: 不带前缀的 GET /a.txt = %d, 应为404", rec.Code)
+	}
+
+	if rec := do(t, hb, "GET", "/b.txt", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("b: 未登录 GET /b.txt = %d, 应为401", rec.Code)
+	}
+	req := httptest.NewRequest("GET", "/b.txt", nil)
+	req.SetBasicAuth("bob", "secret")
+	rec := httptest.NewRecorder()
+	hb.ServeHTTP(rec, req)
+	if rec.Body.String() != "B" {
+		t.Errorf("b: 登录后 GET /b.txt = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, ha, "GET", "/a/", nil); rec.Code != http.StatusOK {
+		t.Errorf("a 不应受 b 的认证影响: GET /a/ = %d", rec.Code)
+	}
+
+	if a.requestCount.Load() == 0 || b.requestCount.Load() == 0 {
+		t.Errorf("请求计数应分别统计: a=%d b=%d", a.requestCount.Load(), b.requestCount.Load())
+	}
+}
+
+func TestSingleFileMode(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"only.txt": "one", "other.txt": "two"})
+	s, err := New(Config{Dirs: []string{filepath.Join(root, "only.txt")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+	for _, target := range []string{"/", "/only.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Body.String() != "one" {
+			t.Errorf("GET %s = %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(t, h, "GET", "/other.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /other.txt = %d, 应为404", rec.Code)
+	}
+}
+
+// -file 和指向文件的 -dir 一样：只提供这个文件，带完整的下载头部，不显示目录列表
+func TestSingleFileModeDownload(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"我的 报告.txt": "0123456789", "other.txt": "x"})
+	file := filepath.Join(root, "我的 报告.txt")
+	for _, cfg := range []Config{{File: file}, {Dirs: []string{file}}, {File: file, BaseURL: "/f"}} {
+		s, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := s.Handler()
+		base := s.basePath
+
+		rec := do(t, h, "GET", base+"/", nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+			t.Fatalf("%+v: GET / = %d %q", cfg, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Content-Length") != "10" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+			t.Errorf("%+v: 头部 %v", cfg, rec.Header())
+		}
+		_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+		if err != nil || params["filename"] != "我的 报告.txt" {
+			t.Errorf("%+v: Content-Disposition = %q", cfg, rec.Header().Get("Content-Disposition"))
+		}
+		if rec := do(t, h, "GET", base+"/"+url.PathEscape("我的 报告.txt"), nil, "Range", "bytes=2-4"); rec.Code != http.StatusPartialContent || rec.Body.String() != "234" {
+			t.Errorf("%+v: Range = %d %q", cfg, rec.Code, rec.Body.String())
+		}
+		if rec := do(t, h, "HEAD", base+"/", nil); rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+			t.Errorf("%+v: HEAD = %d, %d 字节", cfg, rec.Code, rec.Body.Len())
+		}
+		for _, target := range []string{"/other.txt", "/" + url.PathEscape("我的 报告.txt") + "/x", "/_nfs/search?q=x"} {
+			if rec := do(t, h, "GET", base+target, nil); rec.Code != http.StatusNotFound {
+				t.Errorf("%+v: GET %s = %d, 应为404", cfg, target, rec.Code)
+			}
+		}
+		// 目录相关的参数不起作用，仍然只是这个文件
+		if rec := do(t, h, "GET", base+"/?download=zip", nil); rec.Body.String() != "0123456789" {
+			t.Errorf("%+v: GET /?download=zip = %d %q", cfg, rec.Code, rec.Body.String())
+		}
+		if rec := do(t, h, "GET", base+healthPath, nil); rec.Code != http.StatusOK {
+			t.Errorf("%+v: GET %s = %d", cfg, healthPath, rec.Code)
+		}
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"没有共享目录", Config{}},
+		{"目录不存在", Config{Dirs: []string{filepath.Join(dir, "missing")}}},
+		{"多目录缺少名称", Config{Dirs: []string{dir, dir}}},
+		{"端口无效", Config{Dirs: []string{dir}, Port: "70000"}},
+		{"网段无效", Config{Dirs: []string{dir}, AllowCIDR: []string{"10.0.0.0/99"}}},
+		{"只有用户名", Config{Dirs: []string{dir}, User: "u"}},
+		{"日志格式未知", Config{Dirs: []string{dir}, LogFormat: "xml"}},
+		{"缓冲区过小", Config{Dirs: []string{dir}, BufferSize: 1}},
+		{"只有证书", Config{Dirs: []string{dir}, Cert: "cert.pem"}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.cfg); err == nil {
+			t.Errorf("%s: New 应返回错误", tt.name)
+		}
+	}
+}
+
+// startServer 用 Listen/Serve 在随机端口上真正运行 s，测试结束时停止，返回访问地址
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	s.cfg.Port = "0"
+	s.port = "0"
+	if err := s.Listen(); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return "http://127.0.0.1:" + s.port
+}
+
+func TestErrorPages(t *testing.T) {
+	s, _ := newTestServer(t, Config{BaseURL: "/files"}, nil)
+	h := s.Handler()
+
+	rec := do(t, h, "GET", "/files/missing.txt", nil, "Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("GET 不存在的文件 = %d, 应为404", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"<title>404 Not Found</title>", "文件未找到", `<a href="/files/">返回首页</a>`, "<style>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("错误页中没有 %q:\n%s", want, body)
+		}
+	}
+
+	// 非浏览器客户端得到纯文本
+	rec = do(t, h, "GET", "/files/missing.txt", nil, "Accept", "*/*")
+	if rec.Code != http.StatusNotFound || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("curl 请求 = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != "文件未找到" {
+		t.Errorf("纯文本错误 = %q", got)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, nil)
+	rec := do(t, s.Handler(), "GET", "/favicon.ico", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/x-icon" {
+		t.Fatalf("GET /favicon.ico = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !bytes.Equal(rec.Body.Bytes(), defaultFavicon) {
+		t.Error("返回的不是内置图标")
+	}
+	if rec.Header().Get("Cache-Control") == "" {
+		t.Error("没有缓存头")
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	icon := filepath.Join(t.TempDir(), "icon.png")
+	if err := os.WriteFile(icon, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	custom, _ := newTestServer(t, Config{Favicon: icon}, nil)
+	rec = do(t, custom.Handler(), "GET", "/favicon.ico", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || !bytes.Equal(rec.Body.Bytes(), buf.Bytes()) {
+		t.Errorf("-favicon: GET /favicon.ico = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	s, _ := newTestServer(t, Config{BaseURL: "/files/"}, map[string]string{"docs/sub/a b.txt": "ab", "top.txt": "top"})
+	h := s.Handler()
+
+	body := do(t, h, "GET", "/files/docs/sub/", nil).Body.String()
+	for _, want := range []string{
+		`href="/files/docs/sub/a%20b.txt"`,    // 文件链接
+		`href="/files/docs/"`,                 // 返回上级
+		`href="/files/_nfs/assets/fonts.css"`, // 静态资源
+		`action="/files/_nfs/search"`,         // 表单
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("目录列表中没有 %s", want)
+		}
+	}
+	if strings.Contains(body, `href="/docs/`) {
+		t.Error("目录列表中有不带前缀的链接")
+	}
+	if body := do(t, h, "GET", "/files/", nil).Body.String(); !strings.Contains(body, `href="/files/top.txt"`) || !strings.Contains(body, `href="/files/docs/"`) {
+		t.Error("根目录列表中的链接没有前缀")
+	}
+
+	// 带前缀的请求去掉前缀后在共享目录中解析
+	if rec := do(t, h, "GET", "/files/docs/sub/a%20b.txt", nil); rec.Code != http.StatusOK || rec.Body.String() != "ab" {
+		t.Errorf("GET /files/docs/sub/a%%20b.txt = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(t, h, "GET", "/files", nil); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/files/" {
+		t.Errorf("GET /files = %d %q, 应重定向到 /files/", rec.Code, rec.Header().Get("Location"))
+	}
+	for _, target := range []string{"/top.txt", "/filestop.txt", "/files/files/top.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, 应为404", target, rec.Code)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	ro, root := newTestServer(t, Config{}, map[string]string{"a.txt": "a"})
+	h := ro.Handler()
+	for _, method := range []string{"DELETE", "PUT", "PATCH"} {
+		rec := do(t, h, method, "/a.txt", strings.NewReader("x"))
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+			t.Errorf("只读模式 %s /a.txt = %d, Allow: %q", method, rec.Code, rec.Header().Get("Allow"))
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("只读模式下文件被修改: %q, %v", data, err)
+	}
+	if rec := do(t, h, "OPTIONS", "/a.txt", nil); rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("OPTIONS /a.txt = %d, Allow: %q", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	// 可写模式下 DELETE 可用，Allow 中随之列出
+	rw, rwRoot := newTestServer(t, Config{Writable: true}, map[string]string{"a.txt": "a"})
+	if rec := do(t, rw.Handler(), "PUT", "/a.txt", strings.NewReader("x")); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD, OPTIONS, DELETE" {
+		t.Errorf("可写模式 PUT /a.txt = %d, Allow: %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	if rec := do(t, rw.Handler(), "DELETE", "/a.txt", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("可写模式 DELETE /a.txt = %d, 应为204", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(rwRoot, "a.txt")); !os.IsNotExist(err) {
+		t.Error("可写模式下 DELETE 没有删除文件")
+	}
+
+	// 单文件模式只支持 GET 和 HEAD
+	single, err := New(Config{Dirs: []string{filepath.Join(root, "a.txt")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(t, single.Handler(), "DELETE", "/a.txt", nil); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("单文件模式 DELETE = %d, Allow: %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+// captureLog 把测试期间的标准 log 输出写到返回的缓冲区
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	orig := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(orig) })
+	return &buf
+}
+
+func TestVerboseLog(t *testing.T) {
+	for _, verbose := range []bool{false, true} {
+		s, root := newTestServer(t, Config{Verbose: verbose}, map[string]string{"docs/a.txt": "a"})
+		buf := captureLog(t)
+		do(t, s.Handler(), "GET", "/docs/a.txt", nil)
+		out := buf.String()
+
+		debug := "处理路径: /docs/a.txt → " + filepath.Join(root, "docs", "a.txt")
+		if strings.Contains(out, debug) != verbose {
+			t.Errorf("verbose=%v: 日志为\n%s", verbose, out)
+		}
+		// 请求和完成的日志始终输出
+		for _, want := range []string{"[request]GET /docs/a.txt", "[finish]GET /docs/a.txt"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("verbose=%v: 日志中没有 %q", verbose, want)
+			}
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	s, root := newTestServer(t, Config{Dashboard: true}, map[string]string{"docs/a.txt": "a"})
+	h := s.Handler()
+	s.startedAt = time.Now().Add(-(time.Hour + time.Minute + 5*time.Second))
+
+	for _, target := range []string{"/browse/", "/browse/docs/", "/browse/docs/a.txt"} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", target, rec.Code)
+		}
+	}
+	rec := do(t, h, "GET", "/", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET / = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<th>已运行</th><td>1h1m5s</td>",
+		"<th>已处理请求</th><td>3</td>",
+		"<th>版本</th><td>" + Version + "</td>",
+		root,
+		`<a class="browse" href="/browse/">浏览文件</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("首页中没有 %q", want)
+		}
+	}
+
+	// 开启前的文件链接重定向到 /browse/ 下
+	if rec := do(t, h, "GET", "/docs/a.txt", nil); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/browse/docs/a.txt" {
+		t.Errorf("GET /docs/a.txt = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if body := do(t, h, "GET", "/browse/docs/", nil).Body.String(); !strings.Contains(body, `href="/browse/docs/a.txt"`) {
+		t.Error("/browse/ 下的文件链接没有 /browse 前缀")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	s, _ := newTestServer(t, Config{RequestTimeout: 50 * time.Millisecond}, nil)
+
+	// 模拟卡住的文件系统：处理器一直等到 context 被取消
+	cancelled := make(chan struct{})
+	stuck := s.withRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+		w.Write([]byte("太晚了"))
+	}))
+	start := time.Now()
+	rec := do(t, stuck, "GET", "/slow", nil, "Accept", "text/html")
+	if rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "太晚了") {
+		t.Errorf("超时的请求 = %d %q, 应为503", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("超时后 %v 才返回", elapsed)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("超时后没有取消请求的 context")
+	}
+
+	// 下载等豁免的请求可以超过时限
+	exempt := s.withRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		noTimeout(w)
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("完整内容"))
+	}))
+	if rec := do(t, exempt, "GET", "/big.iso", nil); rec.Code != http.StatusOK || rec.Body.String() != "完整内容" || time.Since(start) < 150*time.Millisecond {
+		t.Errorf("豁免的请求 = %d %q", rec.Code, rec.Body.String())
+	}
+
+	// 时限内完成的请求不受影响，头部原样传递
+	fast := s.withRequestTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}))
+	if rec := do(t, fast, "GET", "/fast", nil); rec.Code != http.StatusCreated || rec.Body.String() != "ok" || rec.Header().Get("X-Test") != "1" {
+		t.Errorf("正常请求 = %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+}
+
+// 健康检查不需要登录、不受 -rate-per-ip 限制；共享目录被删除(如存储卷被卸载)后返回503
+func TestHealthz(t *testing.T) {
+	s, _ := newTestServer(t, Config{User: "bob", Password: "secret", RatePerIP: 1, BaseURL: "/nfs"}, map[string]string{"a.txt": "x"})
+	h := s.Handler()
+
+	for i := 0; i < 5; i++ {
+		rec := do(t, h, "GET", "/nfs"+healthPath, nil)
+		if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"status":"ok"}` {
+			t.Fatalf("第 %d 次健康检查 = %d %q, 应为200", i+1, rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+	}
+
+	do(t, h, "GET", "/nfs/a.txt", nil)
+	if rec := do(t, h, "GET", "/nfs/a.txt", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("普通请求应受 -rate-per-ip 限制: 第二次请求 = %d, 应为429", rec.Code)
+	}
+
+	captureLog(t)
+	if err := os.RemoveAll(s.rootDir); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(t, h, "GET", "/nfs"+healthPath, nil)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"unavailable"`) {
+		t.Errorf("共享目录删除后健康检查 = %d %q, 应为503", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("健康检查结果不应被缓存: Cache-Control = %q", rec.Header().Get("Cache-Control"))
+	}
+}
+
+// setVersion 模拟发布时用 -ldflags -X 写入的版本信息，测试结束后恢复
+func setVersion(t *testing.T, version, commit, date string) {
+	old := [3]string{Version, Commit, BuildDate}
+	Version, Commit, BuildDate = version, commit, date
+	t.Cleanup(func() { Version, Commit, BuildDate = old[0], old[1], old[2] })
+}
+
+func TestServerHeader(t *testing.T) {
+	setVersion(t, "v1.2.3", "abc1234", "2026-01-02")
+	s, _ := newTestServer(t, Config{}, map[string]string{"a.txt": "x"})
+	h := s.Handler()
+	for _, target := range []string{"/", "/a.txt", "/missing", healthPath} {
+		if got := do(t, h, "GET", target, nil).Header().Get("Server"); got != "NetworkFileShare/1.2.3" {
+			t.Errorf("GET %s: Server = %q, 应为 NetworkFileShare/1.2.3", target, got)
+		}
+	}
+}
+
+// -version 输出的格式固定，打包脚本可以从中取出版本、提交和构建日期
+func TestVersionString(t *testing.T) {
+	setVersion(t, "v1.2.3", "abc1234", "2026-01-02")
+	re := regexp.MustCompile(`^NetworkFileShare (\S+) \(commit (\S+), built (\S+), (go\S+) (\w+)/(\w+)\)$`)
+	m := re.FindStringSubmatch(VersionString())
+	if m == nil {
+		t.Fatalf("无法解析 -version 的输出: %q", VersionString())
+	}
+	if m[1] != "v1.2.3" || m[2] != "abc1234" || m[3] != "2026-01-02" || m[5] != runtime.GOOS || m[6] != runtime.GOARCH {
+		t.Errorf("解析结果不符: %q", m[1:])
+	}
+}
+
+// 服务接口都在 /_nfs/ 下，共享目录根下与接口同名的文件和文件夹照常访问
+func TestServiceRoutesDoNotShadowFiles(t *testing.T) {
+	files := map[string]string{}
+	names := []string{"qr", "search", "stats", "events", "thumb", "share", "healthz", "d", "mkdir", "delete", "move", "upload", "tus", "dav"}
+	for _, name := range names {
+		files[name] = "file " + name
+	}
+	s, _ := newTestServer(t, Config{Writable: true, WebDAV: true}, files)
+	h := s.Handler()
+	for _, name := range names {
+		if rec := do(t, h, "GET", "/"+name, nil); rec.Code != http.StatusOK || rec.Body.String() != "file "+name {
+			t.Errorf("GET /%s = %d %q, 应为文件内容", name, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(t, h, "GET", "/_nfs/healthz", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /_nfs/healthz = %d", rec.Code)
+	}
+}
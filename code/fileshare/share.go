@@ -0,0 +1,123 @@
+package fileshare
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// signShare 对 路径|过期时间 计算 HMAC 签名
+func (s *Server) signShare(relPath string, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(s.shareSecret))
+	fmt.Fprintf(mac, "%s|%d", relPath, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sharedPath 是分享链接的下载地址，不受全站登录限制
+const sharedPath = "/_nfs/d"
+
+// canShare 判断请求能否生成分享链接：本机访问，或开启了全站登录(-auth 等)且已登录
+func (s *Server) canShare(r *http.Request) bool {
+	if s.authBackend != nil {
+		return true
+	}
+	ip := clientIP(r)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleShare 为文件或文件夹生成限时有效的下载链接，如 /share?path=a/b.zip&ttl=24h，
+// 文件夹的链接下载为 zip。受密码保护的目录需要带密码才能生成
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if !s.canShare(r) {
+		s.renderError(w, r, http.StatusForbidden, "只能在本机或登录后生成分享链接")
+		return
+	}
+
+	fullPath, relPath, err := s.resolvePath(r.URL.Query().Get("path"))
+	if err != nil || fullPath == "" || s.isShareRoot(fullPath) || s.pathHidden(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if !s.checkDirAuth(w, r, fullPath) {
+		return
+	}
+
+	ttl := time.Hour
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			s.renderError(w, r, http.StatusBadRequest, "ttl 参数无效，如 30m、24h")
+			return
+		}
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	exp := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("path", relPath)
+	query.Set("exp", strconv.FormatInt(exp, 10))
+	query.Set("sig", s.signShare(relPath, exp))
+
+	log.Printf("[share]%s 有效期至 %s", relPath, time.Unix(exp, 0).Format("2006-01-02 15:04"))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s%s?%s\n", s.shareURL, sharedPath, query.Encode())
+}
+
+// handleSharedDownload 校验分享链接的签名和有效期，通过后下载文件，文件夹打包为 zip。
+// 签名就是授权，不再要求目录密码；文件夹里另外设了密码的子目录仍然跳过
+func (s *Server) handleSharedDownload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	relPath := query.Get("path")
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || !hmac.Equal([]byte(query.Get("sig")), []byte(s.signShare(relPath, exp))) {
+		log.Printf("分享链接签名无效: %s", r.URL.RawQuery)
+		s.renderError(w, r, http.StatusForbidden, "链接无效")
+		return
+	}
+	if time.Now().Unix() > exp {
+		s.renderError(w, r, http.StatusGone, "链接已过期")
+		return
+	}
+
+	fullPath, _, err := s.resolvePath(relPath)
+	if err != nil || fullPath == "" {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if s.pathHidden(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if info.IsDir() {
+		_, granted := s.requiredAuth(fullPath)
+		s.sendDirZip(w, r, fullPath, granted)
+		return
+	}
+	if !s.extAllowed(info.Name()) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	s.sendFile(w, r, file, info.Name())
+}
@@ -0,0 +1,90 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLinks(t *testing.T) {
+	s, _ := newTestServer(t, Config{User: "alice", Password: "secret"}, map[string]string{"a.txt": "A", "b.txt": "B"})
+	h := s.Handler()
+
+	if rec := do(t, h, "GET", "/_nfs/share?path=a.txt", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("未登录 GET /share = %d, 应为401", rec.Code)
+	}
+	req := httptest.NewRequest("GET", "/_nfs/share?path=a.txt&ttl=1h", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /share = %d %q", rec.Code, rec.Body.String())
+	}
+	link, err := url.Parse(strings.TrimSpace(rec.Body.String()))
+	if err != nil || link.Path != sharedPath {
+		t.Fatalf("分享链接 %q 无效: %v", rec.Body.String(), err)
+	}
+	query := link.Query()
+	exp, _ := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if d := time.Until(time.Unix(exp, 0)); d < 59*time.Minute || d > time.Hour+time.Second {
+		t.Errorf("有效期 %v, 应为1小时", d)
+	}
+
+	// 有效的链接不需要登录
+	if rec := do(t, h, "GET", link.RequestURI(), nil); rec.Code != http.StatusOK || rec.Body.String() != "A" {
+		t.Errorf("有效链接 = %d %q", rec.Code, rec.Body.String())
+	}
+
+	tamper := func(key, value string) string {
+		q := link.Query()
+		q.Set(key, value)
+		return sharedPath + "?" + q.Encode()
+	}
+	sig := query.Get("sig")
+	flipped := "0"
+	if sig[0] == '0' {
+		flipped = "1"
+	}
+	for name, target := range map[string]string{
+		"篡改签名":  tamper("sig", flipped+sig[1:]),
+		"篡改路径":  tamper("path", "b.txt"),
+		"延长有效期": tamper("exp", strconv.FormatInt(exp+3600, 10)),
+		"缺少签名":  tamper("sig", ""),
+	} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: GET = %d, 应为403", name, rec.Code)
+		}
+	}
+
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := sharedPath + "?" + url.Values{
+		"path": {"a.txt"},
+		"exp":  {strconv.FormatInt(past, 10)},
+		"sig":  {s.signShare("a.txt", past)},
+	}.Encode()
+	if rec := do(t, h, "GET", expired, nil); rec.Code != http.StatusGone {
+		t.Errorf("过期链接 = %d, 应为410", rec.Code)
+	}
+}
+
+// 其他 Server 的密钥签出的链接无效
+func TestShareLinkSecretPerServer(t *testing.T) {
+	a, _ := newTestServer(t, Config{}, map[string]string{"a.txt": "A"})
+	b, _ := newTestServer(t, Config{}, map[string]string{"a.txt": "A"})
+	exp := time.Now().Add(time.Hour).Unix()
+	target := sharedPath + "?" + url.Values{
+		"path": {"a.txt"},
+		"exp":  {strconv.FormatInt(exp, 10)},
+		"sig":  {a.signShare("a.txt", exp)},
+	}.Encode()
+	if rec := do(t, a.Handler(), "GET", target, nil); rec.Code != http.StatusOK {
+		t.Errorf("a 的链接在 a 上 = %d", rec.Code)
+	}
+	if rec := do(t, b.Handler(), "GET", target, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("a 的链接在 b 上 = %d, 应为403", rec.Code)
+	}
+}
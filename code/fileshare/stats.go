@@ -0,0 +1,277 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// healthPath 是健康检查地址，供 Docker/Kubernetes 探针使用，不需要登录，也不写访问日志
+const healthPath = "/_nfs/healthz"
+
+// handleHealth 检查共享的目录(或 -file 指定的文件)是否还能访问：
+// 都能 Stat 时返回200，有任何一个消失(如存储卷被卸载)时返回503
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	roots := []string{s.rootDir, s.singleFile}
+	for _, m := range s.mounts {
+		roots = append(roots, m.root)
+	}
+	status, body := http.StatusOK, map[string]string{"status": "ok"}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		if _, err := os.Stat(root); err != nil {
+			log.Printf("[health]共享目录不可用: %v", err)
+			status, body = http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "error": root + " 无法访问"}
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// statsWindow 是计算实时速度的时间窗口(秒)
+const statsWindow = 10
+
+// transferStats 记录进行中的下载和累计字节数；
+// 最近 statsWindow 秒每秒发送的字节数存放在环形缓冲区里，用来计算实时速度
+type transferStats struct {
+	active  atomic.Int64
+	total   atomic.Int64
+	mu      sync.Mutex
+	buckets [statsWindow]int64 // 每秒发送的字节数
+	seconds [statsWindow]int64 // 对应桶记录的是哪一秒(Unix 时间)
+	running map[*transfer]bool // 进行中的下载
+}
+
+// transfer 是一个进行中的下载，/_nfs/stats 据此显示每个下载的进度、速度和剩余时间
+type transfer struct {
+	name    string // 显示的文件名，受密码保护的目录中的文件不显示名字
+	started time.Time
+	size    atomic.Int64 // 响应的总字节数，打包下载等事先不知道时为 -1
+	sent    atomic.Int64
+}
+
+// begin 登记一个开始的下载，结束时调用 end
+func (t *transferStats) begin(name string) *transfer {
+	tr := &transfer{name: name, started: time.Now()}
+	tr.size.Store(-1)
+	t.active.Add(1)
+	t.mu.Lock()
+	if t.running == nil {
+		t.running = map[*transfer]bool{}
+	}
+	t.running[tr] = true
+	t.mu.Unlock()
+	return tr
+}
+
+func (t *transferStats) end(tr *transfer) {
+	t.mu.Lock()
+	delete(t.running, tr)
+	t.mu.Unlock()
+	t.active.Add(-1)
+}
+
+func (t *transferStats) add(n int64) {
+	if n <= 0 {
+		return
+	}
+	t.total.Add(n)
+	now := time.Now().Unix()
+	i := now % statsWindow
+	t.mu.Lock()
+	if t.seconds[i] != now {
+		t.seconds[i] = now
+		t.buckets[i] = 0
+	}
+	t.buckets[i] += n
+	t.mu.Unlock()
+}
+
+// throughput 返回最近几秒的平均速度(字节/秒)，不计入还没过完的当前这一秒
+func (t *transferStats) throughput() int64 {
+	now := time.Now().Unix()
+	var sum int64
+	t.mu.Lock()
+	for i, s := range t.seconds {
+		if s < now && s >= now-(statsWindow-1) {
+			sum += t.buckets[i]
+		}
+	}
+	t.mu.Unlock()
+	return sum / (statsWindow - 1)
+}
+
+// downloadStat 是 /_nfs/stats 中一个进行中的下载
+type downloadStat struct {
+	Name        string `json:"name"`
+	Sent        int64  `json:"sent"`
+	Size        int64  `json:"size"`          // -1 表示事先不知道大小(打包下载)
+	BytesPerSec int64  `json:"bytes_per_sec"` // 开始以来的平均速度
+	ETASeconds  int64  `json:"eta_seconds"`   // 预计剩余秒数，-1 表示无法估计
+	Speed       string `json:"speed"`
+	ETA         string `json:"eta"`
+}
+
+// downloads 返回进行中的下载，按开始时间排列
+func (t *transferStats) downloads() []downloadStat {
+	t.mu.Lock()
+	running := make([]*transfer, 0, len(t.running))
+	for tr := range t.running {
+		running = append(running, tr)
+	}
+	t.mu.Unlock()
+	sort.Slice(running, func(i, j int) bool { return running[i].started.Before(running[j].started) })
+
+	list := make([]downloadStat, 0, len(running))
+	for _, tr := range running {
+		d := downloadStat{Name: tr.name, Sent: tr.sent.Load(), Size: tr.size.Load(), ETASeconds: -1, ETA: "-"}
+		if elapsed := time.Since(tr.started).Seconds(); elapsed > 0 {
+			d.BytesPerSec = int64(float64(d.Sent) / elapsed)
+		}
+		if d.Size >= 0 && d.BytesPerSec > 0 {
+			d.ETASeconds = max(d.Size-d.Sent, 0) / d.BytesPerSec
+			d.ETA = (time.Duration(d.ETASeconds) * time.Second).String()
+		}
+		d.Speed = humanizeBytes(d.BytesPerSec) + "/s"
+		list = append(list, d)
+	}
+	return list
+}
+
+// handleStats 返回下载统计：进行中的传输数、累计发送字节数、实时速度和每个下载的进度。
+// 浏览器打开时显示统计页面，其他客户端得到 JSON
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	total, speed := s.transfers.total.Load(), s.transfers.throughput()
+	stats := struct {
+		Active      int64          `json:"active"`
+		TotalBytes  int64          `json:"total_bytes"`
+		BytesPerSec int64          `json:"bytes_per_sec"`
+		Total       string         `json:"total"`
+		Speed       string         `json:"speed"`
+		Downloads   []downloadStat `json:"downloads"`
+	}{s.transfers.active.Load(), total, speed, humanizeBytes(total), humanizeBytes(speed) + "/s", s.transfers.downloads()}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := statsTemplate.Execute(w, struct {
+		Stats any
+		Base  string
+	}{stats, s.basePath}); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
+
+// statsTemplate 是浏览器打开 /_nfs/stats 时的页面，只有打开这个页面时才定期刷新
+var statsTemplate = template.Must(template.New("").Funcs(template.FuncMap{"size": humanizeBytes}).Parse(`
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta http-equiv="refresh" content="3">
+    <link href="{{.Base}}/_nfs/assets/fonts.css" rel="stylesheet">
+    <title>下载统计</title>
+    <style>
+        body { font-family: "HarmonyOS Sans", "思源黑体", sans-serif; font-size:14px; max-width: 960px; margin: 0 auto; padding: 0 12px; }
+        table { border-collapse: collapse; width: 100%; }
+        th { text-align: left; color: #666; font-weight: normal; }
+        th, td { padding: 6px 16px 6px 0; border-bottom: 1px solid #eee; }
+        .total { color: #999; }
+        @media (prefers-color-scheme: dark) {
+            body { background: #121212; color: #ddd; }
+            th { color: #888; }
+            th, td { border-bottom-color: #333; }
+        }
+    </style>
+</head>
+<body>
+    <h2>📊 下载统计</h2>
+    {{with .Stats}}<p class="total">正在下载 {{.Active}} 个，速度 {{.Speed}}，累计已发送 {{.Total}}</p>
+    {{if .Downloads}}<table>
+        <tr><th>文件</th><th>进度</th><th>速度</th><th>剩余时间</th></tr>{{range .Downloads}}
+        <tr><td>{{.Name}}</td><td>{{size .Sent}}{{if ge .Size 0}} / {{size .Size}}{{end}}</td><td>{{.Speed}}</td><td>{{.ETA}}</td></tr>{{end}}
+    </table>{{end}}{{end}}
+</body>
+</html>
+`))
+
+var dashboardTemplate = template.Must(template.New("").Parse(`
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <link href="{{.Base}}/_nfs/assets/fonts.css" rel="stylesheet">
+    <title>文件服务</title>
+    <style>
+        body { font-family: "HarmonyOS Sans", "思源黑体", sans-serif; font-size:14px; max-width: 960px; margin: 0 auto; padding: 0 12px; }
+        th { text-align: left; color: #666; font-weight: normal; padding: 4px 16px 4px 0; }
+        .browse { display: inline-block; margin: 16px 0; padding: 10px 24px; background: #2196F3; color: #fff; border-radius: 4px; text-decoration: none; font-size: 16px; }
+        @media (prefers-color-scheme: dark) {
+            body { background: #121212; color: #ddd; }
+            th { color: #888; }
+        }
+    </style>
+</head>
+<body>
+    <h2>📂 文件服务</h2>
+    <table>
+        <tr><th>版本</th><td>{{.Version}}</td></tr>
+        <tr><th>已运行</th><td>{{.Uptime}}</td></tr>
+        <tr><th>已处理请求</th><td>{{.Requests}}</td></tr>
+        <tr><th>共享目录</th><td>{{range .Dirs}}{{.}}<br>{{end}}</td></tr>
+    </table>
+    <a class="browse" href="{{.BrowseURL}}">浏览文件</a>
+</body>
+</html>
+`))
+
+// handleDashboard 显示 -dashboard 首页：版本、运行时长、请求数和共享目录
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Version   string
+		Uptime    time.Duration
+		Requests  int64
+		Dirs      []string
+		BrowseURL string
+		Base      string
+	}{
+		Version:   Version,
+		Uptime:    time.Since(s.startedAt).Round(time.Second),
+		Requests:  s.requestCount.Load(),
+		BrowseURL: s.siteURL(""),
+		Base:      s.basePath,
+	}
+	if s.rootDir != "" {
+		data.Dirs = append(data.Dirs, s.rootDir)
+	}
+	for _, m := range s.mounts {
+		data.Dirs = append(data.Dirs, "/"+m.name+"/ → "+m.root)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
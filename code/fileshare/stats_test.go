@@ -0,0 +1,144 @@
+package fileshare
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type statsResponse struct {
+	Active      int64 `json:"active"`
+	TotalBytes  int64 `json:"total_bytes"`
+	BytesPerSec int64 `json:"bytes_per_sec"`
+	Downloads   []struct {
+		Name        string `json:"name"`
+		Sent        int64  `json:"sent"`
+		Size        int64  `json:"size"`
+		BytesPerSec int64  `json:"bytes_per_sec"`
+		ETASeconds  int64  `json:"eta_seconds"`
+	} `json:"downloads"`
+}
+
+func getStats(t *testing.T, base string) statsResponse {
+	t.Helper()
+	resp, err := http.Get(base + "/_nfs/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var st statsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestStatsDuringDownload(t *testing.T) {
+	const size = 96 << 10
+	s, _ := newTestServer(t, Config{MaxRatePerConn: 32 << 10}, map[string]string{
+		"big.bin":   strings.Repeat("x", size), // 限速下约 2 秒
+		"small.txt": "hello",
+	})
+	base := startServer(t, s)
+	if st := getStats(t, base); st.Active != 0 || st.TotalBytes != 0 || len(st.Downloads) != 0 {
+		t.Fatalf("还没有下载时 /stats = %+v", st)
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/big.bin")
+		if err != nil {
+			done <- -1
+			return
+		}
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		done <- int(n)
+	}()
+
+	// 下载过程中：一个进行中的传输，已发送字节数和速度都大于0，能看到这个下载的进度和剩余时间
+	var during statsResponse
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		during = getStats(t, base)
+		if during.Active == 1 && during.TotalBytes > 0 && during.BytesPerSec > 0 && len(during.Downloads) == 1 && during.Downloads[0].Sent > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("下载过程中 /stats = %+v", during)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if during.TotalBytes >= size {
+		t.Errorf("下载未完成时 total_bytes = %d", during.TotalBytes)
+	}
+	if d := during.Downloads[0]; d.Name != "big.bin" || d.Size != size || d.Sent >= size || d.BytesPerSec <= 0 || d.ETASeconds < 0 {
+		t.Errorf("下载过程中的进度 = %+v", d)
+	}
+
+	if n := <-done; n != size {
+		t.Fatalf("下载了 %d 字节，应为 %d", n, size)
+	}
+	if resp, err := http.Get(base + "/small.txt"); err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	after := getStats(t, base)
+	if after.Active != 0 || after.TotalBytes != size+5 || len(after.Downloads) != 0 {
+		t.Errorf("下载完成后 /stats = %+v, 应为 active=0 total_bytes=%d", after, size+5)
+	}
+}
+
+// 统计只在浏览器打开统计页面时加载，目录列表不再定期请求；受密码保护的文件不显示名字
+func TestStatsPage(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{"a.txt": "a", "private/" + authFileName: secretHash + "\n", "private/b.txt": "b"})
+	h := s.Handler()
+	if body := do(t, h, "GET", "/", nil, "Accept", "text/html").Body.String(); strings.Contains(body, "setInterval") || !strings.Contains(body, `href="/_nfs/stats"`) {
+		t.Error("目录列表仍在定期请求统计，或没有统计页面的链接")
+	}
+	rec := do(t, h, "GET", "/_nfs/stats", nil, "Accept", "text/html")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "下载统计") {
+		t.Errorf("浏览器打开 /_nfs/stats = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	tr := s.transfers.begin("a.txt")
+	tr.size.Store(100)
+	tr.sent.Store(50)
+	body := do(t, h, "GET", "/_nfs/stats", nil, "Accept", "text/html").Body.String()
+	s.transfers.end(tr)
+	if !strings.Contains(body, "<td>a.txt</td>") || !strings.Contains(body, "50 B / 100 B") {
+		t.Errorf("统计页面没有显示进行中的下载:\n%s", body)
+	}
+
+	for rel, want := range map[string]string{"a.txt": "a.txt", "private/b.txt": "(受密码保护的文件)"} {
+		if got := s.transferName(filepath.Join(s.rootDir, filepath.FromSlash(rel)), path.Base(rel)); got != want {
+			t.Errorf("%s 在统计中显示为 %q, 应为 %q", rel, got, want)
+		}
+	}
+}
+
+func TestTransferThroughput(t *testing.T) {
+	for {
+		var ts transferStats
+		now := time.Now().Unix()
+		// 键是几秒之前，各自落在不同的桶里
+		for ago, n := range map[int64]int64{0: 1000, 1: 900, 5: 900, statsWindow - 1: 900, statsWindow + 2: 5000} {
+			i := (now - ago) % statsWindow
+			ts.seconds[i], ts.buckets[i] = now-ago, n
+		}
+		got := ts.throughput()
+		if time.Now().Unix() != now {
+			continue // 跨过了整秒，重新来
+		}
+		// 只计入前 1 到 statsWindow-1 秒：当前这一秒还没过完，更早的已过期
+		if want := int64(2700 / (statsWindow - 1)); got != want {
+			t.Errorf("throughput = %d, 应为 %d", got, want)
+		}
+		return
+	}
+}
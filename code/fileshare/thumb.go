@@ -0,0 +1,148 @@
+package fileshare
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// thumbnailable 按扩展名判断能否生成缩略图，目前支持 JPEG 和 PNG
+func thumbnailable(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// thumbCacheSize 是内存中缓存的缩略图数量，缓存按 路径|修改时间|宽度 区分，文件修改后自然失效
+const thumbCacheSize = 256
+
+// handleThumb 返回图片的 JPEG 缩略图，如 /_nfs/thumb?path=photos/a.jpg&w=200
+func (s *Server) handleThumb(w http.ResponseWriter, r *http.Request) {
+	fullPath, _, err := s.resolvePath(r.URL.Query().Get("path"))
+	if err != nil || fullPath == "" || s.pathHidden(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if !s.checkDirAuth(w, r, fullPath) {
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		s.renderFSError(w, r, err)
+		return
+	}
+	if info.IsDir() || !s.extAllowed(info.Name()) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	if !thumbnailable(info.Name()) {
+		s.renderError(w, r, http.StatusUnsupportedMediaType, "不支持为该类型生成缩略图")
+		return
+	}
+
+	width := 200
+	if v, err := strconv.Atoi(r.URL.Query().Get("w")); err == nil {
+		width = min(max(v, 16), 1024)
+	}
+
+	// 缩略图随原图变化，ETag 由原图的修改时间、大小和宽度决定；
+	// 浏览器带着 If-None-Match 重新验证时不必解码或查缓存就能返回304
+	etag := strings.TrimSuffix(fileETag(info.ModTime(), info.Size()), `"`) + fmt.Sprintf(`-w%d"`, width)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	key := fmt.Sprintf("%s|%d|%d", fullPath, info.ModTime().UnixNano(), width)
+	data, ok := s.thumbs.get(key)
+	if !ok {
+		if data, err = makeThumb(fullPath, width); errors.Is(err, errImageTooLarge) {
+			log.Printf("生成缩略图失败: %v", err)
+			s.renderError(w, r, http.StatusUnprocessableEntity, "图片尺寸过大，不生成缩略图")
+			return
+		} else if err != nil {
+			log.Printf("生成缩略图失败: %v", err)
+			s.renderError(w, r, http.StatusUnsupportedMediaType, "无法解码图片")
+			return
+		}
+		s.thumbs.put(key, data)
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(data))
+}
+
+// etagMatch 判断 If-None-Match 是否包含 etag(弱比较，忽略 W/ 前缀)
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxThumbPixels 是生成缩略图时允许解码的最大像素数。解码后每个像素占 4~8 字节，
+// 很小的文件也能在头部声明 50000×50000 的尺寸，不限制会一次占用几十 GB 内存
+const maxThumbPixels = 64 << 20
+
+// errImageTooLarge 表示图片尺寸超过 maxThumbPixels，不生成缩略图
+var errImageTooLarge = errors.New("图片尺寸过大")
+
+// makeThumb 解码图片并缩放到指定宽度，编码为 JPEG。先只读取文件头里的尺寸，超过 maxThumbPixels 的不解码
+func makeThumb(path string, width int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxThumbPixels {
+		return nil, fmt.Errorf("%w: %d×%d", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleImage(src, width), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage 用 Catmull-Rom 插值把图片缩小到指定宽度，高度等比计算；比目标小的图片不放大
+func scaleImage(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	if b.Dx() <= width {
+		return src
+	}
+	height := max(b.Dy()*width/b.Dx(), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,100 @@
+package fileshare
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+// encodeTestImage 生成 w×h 的渐变图片，format 为 png 或 jpeg
+func encodeTestImage(t *testing.T, format string, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestThumb(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{
+		"photos/wide.png": encodeTestImage(t, "png", 800, 600),
+		"photos/tall.jpg": encodeTestImage(t, "jpeg", 300, 900),
+	})
+	h := s.Handler()
+
+	tests := []struct {
+		target string
+		w, h   int
+	}{
+		{"/_nfs/thumb?path=photos/wide.png", 200, 150}, // 默认宽度200
+		{"/_nfs/thumb?path=photos/wide.png&w=100", 100, 75},
+		{"/_nfs/thumb?path=photos/tall.jpg&w=150", 150, 450},
+	}
+	for _, tt := range tests {
+		rec := do(t, h, "GET", tt.target, nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/jpeg" {
+			t.Errorf("GET %s = %d %q", tt.target, rec.Code, rec.Header().Get("Content-Type"))
+			continue
+		}
+		img, err := jpeg.Decode(rec.Body)
+		if err != nil {
+			t.Errorf("GET %s: 无法解码缩略图: %v", tt.target, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("GET %s: 缩略图为 %dx%d, 应为 %dx%d", tt.target, b.Dx(), b.Dy(), tt.w, tt.h)
+		}
+	}
+
+	rec := do(t, h, "GET", "/_nfs/thumb?path=photos/wide.png", nil)
+	etag := rec.Header().Get("ETag")
+	if rec := do(t, h, "GET", "/_nfs/thumb?path=photos/wide.png", nil, "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("带 If-None-Match 重新验证 = %d, 应为304", rec.Code)
+	}
+}
+
+func TestThumbRejectsNonImages(t *testing.T) {
+	// 头部声明 50000×50000 的 PNG，文件本身很小
+	huge := []byte(encodeTestImage(t, "png", 1, 1))
+	binary.BigEndian.PutUint32(huge[16:], 50000)
+	binary.BigEndian.PutUint32(huge[20:], 50000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	s, _ := newTestServer(t, Config{}, map[string]string{
+		"notes.txt":  "not an image",
+		"broken.png": "not really a png",
+		"huge.png":   string(huge),
+		"docs/a.txt": "a",
+	})
+	h := s.Handler()
+	for target, want := range map[string]int{
+		"/_nfs/thumb?path=notes.txt":   http.StatusUnsupportedMediaType,
+		"/_nfs/thumb?path=broken.png":  http.StatusUnsupportedMediaType,
+		"/_nfs/thumb?path=huge.png":    http.StatusUnprocessableEntity,
+		"/_nfs/thumb?path=docs":        http.StatusNotFound,
+		"/_nfs/thumb?path=missing.png": http.StatusNotFound,
+	} {
+		if rec := do(t, h, "GET", target, nil); rec.Code != want {
+			t.Errorf("GET %s = %d, 应为 %d", target, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package fileshare
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutWriter 是 -request-timeout 下交给处理器的 ResponseWriter：
+// 超时后拒绝处理器继续写入，已豁免(noTimeout)的请求则不受超时影响
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	exempt      bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(p)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	http.NewResponseController(tw.w).Flush()
+}
+
+// Unwrap 让 http.ResponseController 能找到底层连接，设置读写超时
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// noTimeout 让当前请求不再受 -request-timeout 限制，
+// 文件下载、打包下载、上传和事件流本来就可能持续很久，开始传输前调用
+func noTimeout(w http.ResponseWriter) {
+	for {
+		switch v := w.(type) {
+		case *timeoutWriter:
+			v.mu.Lock()
+			v.exempt = true
+			v.mu.Unlock()
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// withRequestTimeout 限制单个请求的处理时长：文件系统卡住(如失效的 NFS 挂载)时，
+// 超过 -request-timeout 就返回503并取消请求的 context，连接不会一直被占着。
+// 不用 http.TimeoutHandler 是因为它会把整个响应缓存在内存里，下载大文件时不可接受
+func (s *Server) withRequestTimeout(next http.Handler) http.Handler {
+	if s.cfg.RequestTimeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		tw := &timeoutWriter{w: w, h: make(http.Header)}
+		done := make(chan struct{})
+		panicChan := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		timer := time.NewTimer(s.cfg.RequestTimeout)
+		defer timer.Stop()
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-done:
+			return
+		case <-timer.C:
+		}
+
+		tw.mu.Lock()
+		if tw.exempt {
+			tw.mu.Unlock()
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+			}
+			return
+		}
+		tw.timedOut = true
+		wroteHeader := tw.wroteHeader
+		tw.mu.Unlock()
+		cancel()
+
+		log.Printf("[timeout]%s %s 处理超过 %v，已中止", r.Method, r.URL.Path, s.cfg.RequestTimeout)
+		if !wroteHeader {
+			s.renderError(w, r, http.StatusServiceUnavailable, "服务器处理超时，请稍后重试")
+		}
+	})
+}
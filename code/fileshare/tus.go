@@ -0,0 +1,262 @@
+package fileshare
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 实现 tus 1.0.0 核心协议和 creation、termination 扩展(https://tus.io/protocols/resumable-upload)，
+// 可以直接使用 tus-js-client、Uppy 等现成客户端：POST /_nfs/tus/ 创建上传，HEAD 查询已收到的字节数，
+// PATCH 从该位置继续发送，断线后不必从头开始。收到的数据直接追加到目标目录的临时文件里，完成后原子地改名
+
+const (
+	tusPrefix  = "/_nfs/tus/"
+	tusVersion = "1.0.0"
+)
+
+// tusUpload 是一个 tus 上传的信息，保存在系统临时目录下，服务器重启后仍可继续
+type tusUpload struct {
+	Dir       string `json:"dir"` // 目标目录，相对共享目录
+	Name      string `json:"name"`
+	Length    int64  `json:"length"`
+	Overwrite bool   `json:"overwrite"`
+	Data      string `json:"data"` // 已收到的数据所在的临时文件
+}
+
+// tusInfoPath 返回上传信息文件的路径
+func tusInfoPath(id string) string {
+	return filepath.Join(os.TempDir(), "nfs-tus", id+".json")
+}
+
+func loadTusUpload(id string) (*tusUpload, error) {
+	data, err := os.ReadFile(tusInfoPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var u tusUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// parseTusMetadata 解析 Upload-Metadata：逗号分隔的 "键 base64值"，值可以省略
+func parseTusMetadata(v string) map[string]string {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
+
+// tusTarget 校验上传的目标位置，返回目标文件的完整路径；不能上传时已输出错误响应
+func (s *Server) tusTarget(w http.ResponseWriter, r *http.Request, u *tusUpload) (string, bool) {
+	dirPath, _, err := s.resolvePath(u.Dir)
+	if err != nil || dirPath == "" || !validName(u.Name) || !s.extAllowed(u.Name) || s.pathHidden(filepath.Join(dirPath, u.Name)) {
+		s.renderError(w, r, http.StatusForbidden, "禁止上传到该位置")
+		return "", false
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		s.renderError(w, r, http.StatusNotFound, "目录未找到")
+		return "", false
+	}
+	if !s.checkDirAuth(w, r, dirPath) {
+		return "", false
+	}
+	return filepath.Join(dirPath, u.Name), true
+}
+
+// handleTus 按方法分发 tus 请求，路径为 /_nfs/tus/ 或 /_nfs/tus/<上传ID>
+func (s *Server) handleTus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		s.renderError(w, r, http.StatusPreconditionFailed, "不支持的 tus 协议版本")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, tusPrefix)
+	if id == "" {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "OPTIONS, POST")
+			s.renderError(w, r, http.StatusMethodNotAllowed, "不支持的方法")
+			return
+		}
+		s.tusCreate(w, r)
+		return
+	}
+	if !validUploadID(id) {
+		s.renderError(w, r, http.StatusNotFound, "上传未找到")
+		return
+	}
+
+	// 同一上传的请求依次处理，两个 PATCH 不会交错写入
+	lock, _ := s.uploadLocks.LoadOrStore("tus:"+id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	u, err := loadTusUpload(id)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "上传未找到")
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		offset := int64(0)
+		if info, err := os.Stat(u.Data); err == nil {
+			offset = info.Size()
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		s.tusPatch(w, r, id, u)
+	case http.MethodDelete:
+		os.Remove(u.Data)
+		os.Remove(tusInfoPath(id))
+		s.uploadLocks.Delete("tus:" + id)
+		log.Printf("[tus]取消上传 %s", u.Name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		s.renderError(w, r, http.StatusMethodNotAllowed, "不支持的方法")
+	}
+}
+
+// tusCreate 创建上传：Upload-Length 为文件大小，Upload-Metadata 里的 filename 为文件名，
+// dir 为目标目录(默认共享根目录)，overwrite 为 1 时覆盖同名文件
+func (s *Server) tusCreate(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		s.renderError(w, r, http.StatusBadRequest, "缺少 Upload-Length")
+		return
+	}
+	meta := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	u := &tusUpload{Dir: meta["dir"], Name: meta["filename"], Length: length, Overwrite: meta["overwrite"] == "1"}
+	target, ok := s.tusTarget(w, r, u)
+	if !ok {
+		return
+	}
+	if _, err := os.Lstat(target); err == nil && !u.Overwrite {
+		s.renderError(w, r, http.StatusConflict, "文件已存在")
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "创建上传失败")
+		return
+	}
+	id := hex.EncodeToString(buf)
+	u.Data = filepath.Join(filepath.Dir(target), uploadTempPrefix+"tus-"+id)
+	data, _ := json.Marshal(u)
+	err = os.MkdirAll(filepath.Dir(tusInfoPath(id)), 0700)
+	if err == nil {
+		err = os.WriteFile(u.Data, nil, 0644)
+	}
+	if err == nil {
+		err = os.WriteFile(tusInfoPath(id), data, 0600)
+	}
+	if err != nil {
+		os.Remove(u.Data)
+		log.Printf("创建上传失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "创建上传失败")
+		return
+	}
+
+	log.Printf("[tus]开始上传 %s (%d 字节)", target, length)
+	w.Header().Set("Location", s.basePath+tusPrefix+id)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// tusPatch 把请求体追加到已收到的数据后面。中途断开时已写入的部分保留，客户端 HEAD 查到新的位置后继续；
+// 收齐 Upload-Length 字节后移动到目标位置
+func (s *Server) tusPatch(w http.ResponseWriter, r *http.Request, id string, u *tusUpload) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		s.renderError(w, r, http.StatusUnsupportedMediaType, "Content-Type 应为 application/offset+octet-stream")
+		return
+	}
+	f, err := os.OpenFile(u.Data, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		log.Printf("打开上传数据失败: %v", err)
+		s.renderError(w, r, http.StatusNotFound, "上传未找到")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "读取上传数据失败")
+		return
+	}
+	offset := info.Size()
+	if r.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10) {
+		s.renderError(w, r, http.StatusConflict, "Upload-Offset 与已收到的字节数不一致")
+		return
+	}
+
+	noTimeout(w)
+	rc := http.NewResponseController(w)
+	body := http.MaxBytesReader(w, r.Body, u.Length-offset)
+	n, err := io.Copy(f, &deadlineReader{r: body, rc: rc})
+	offset += n
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.renderError(w, r, http.StatusRequestEntityTooLarge, "超出 Upload-Length")
+		return
+	} else if err != nil {
+		log.Printf("[tus]%s 接收中断，已收到 %d/%d 字节: %v", u.Name, offset, u.Length, err)
+		s.renderError(w, r, http.StatusBadRequest, "接收中断")
+		return
+	}
+	if offset < u.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	target, ok := s.tusTarget(w, r, u)
+	if !ok {
+		return
+	}
+	f.Close()
+	if err := commitUpload(u.Data, target, u.Overwrite); errors.Is(err, os.ErrExist) {
+		s.renderError(w, r, http.StatusConflict, "文件已存在")
+		return
+	} else if err != nil {
+		log.Printf("保存上传失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "保存文件失败")
+		return
+	}
+	os.Remove(tusInfoPath(id))
+	s.uploadLocks.Delete("tus:" + id)
+	log.Printf("[upload]%s %d 字节", target, u.Length)
+	s.audit.Record(r, "upload", target, u.Length)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package fileshare
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 断点续传：创建后分两次 PATCH 收齐，文件落到 Upload-Metadata 指定的位置
+func TestTusUpload(t *testing.T) {
+	s, root := newTestServer(t, Config{Writable: true}, map[string]string{"dir/.keep": ""})
+	h := s.Handler()
+
+	meta := "filename " + base64.StdEncoding.EncodeToString([]byte("中文.txt")) +
+		",dir " + base64.StdEncoding.EncodeToString([]byte("/dir"))
+	rec := do(t, h, "POST", tusPrefix, nil, "Tus-Resumable", tusVersion, "Upload-Length", "10", "Upload-Metadata", meta)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("创建上传 = %d %s", rec.Code, rec.Body.String())
+	}
+	loc := rec.Header().Get("Location")
+	t.Cleanup(func() { os.Remove(tusInfoPath(loc[strings.LastIndex(loc, "/")+1:])) })
+
+	for i, part := range []string{"hello", "world"} {
+		rec = do(t, h, "PATCH", loc, strings.NewReader(part), "Tus-Resumable", tusVersion,
+			"Content-Type", "application/offset+octet-stream", "Upload-Offset", []string{"0", "5"}[i])
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("第 %d 次 PATCH = %d %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "dir", "中文.txt")); err != nil || string(data) != "helloworld" {
+		t.Errorf("上传结果 = %q, %v", data, err)
+	}
+}
+
+// tus 的错误和其他接口一样经 renderError 输出：浏览器得到错误页，tus 客户端得到纯文本
+func TestTusErrors(t *testing.T) {
+	s, _ := newTestServer(t, Config{Writable: true}, nil)
+	h := s.Handler()
+	target := tusPrefix + strings.Repeat("0", 32)
+
+	if rec := do(t, h, "PATCH", target, nil); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("缺少 Tus-Resumable = %d, 应为412", rec.Code)
+	}
+	rec := do(t, h, "PATCH", target, nil, "Tus-Resumable", tusVersion)
+	if rec.Code != http.StatusNotFound || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("上传不存在 = %d %s, 应为纯文本404", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rec = do(t, h, "PATCH", target, nil, "Tus-Resumable", tusVersion, "Accept", "text/html")
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "上传未找到") ||
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("浏览器访问不存在的上传 = %d %s, 应为错误页", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
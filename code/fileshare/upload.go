@@ -0,0 +1,444 @@
+package fileshare
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploadTempPrefix 是上传过程中写在目标目录里的临时文件的前缀，这些文件不在列表中显示，也不能直接访问
+const uploadTempPrefix = ".nfs-upload-"
+
+// 分块上传的限制：单块最大 64MB，读取一块最多等待 chunkReadTimeout
+const (
+	maxChunkSize     = 64 << 20
+	maxChunks        = 100000
+	chunkReadTimeout = 2 * time.Minute
+)
+
+// uploadExpiry 是分块上传的保留时间，超过这么久没有收到新分块的上传在创建新上传时清理
+const uploadExpiry = 24 * time.Hour
+
+// chunkUpload 是一个分块上传的信息，创建时确定目标位置和分块数，之后的分块只按 ID 和序号发送
+type chunkUpload struct {
+	Dir       string `json:"dir"` // 目标目录，相对共享目录
+	Name      string `json:"name"`
+	Total     int    `json:"total"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+// chunkDir 返回保存某个上传的分块和信息的目录，分块按序号命名
+func (s *Server) chunkDir(id string) string {
+	return filepath.Join(s.uploadDir, id)
+}
+
+// validUploadID 检查上传 ID 是否为 newUploadID 生成的格式，不能借此访问其他目录
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// newUploadID 生成随机的上传 ID，其他人无法猜到，也就不能查询或插入别人的分块
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// loadChunkUpload 读取上传信息，ID 无效或上传不存在(已完成、已过期)时返回 os.ErrNotExist
+func (s *Server) loadChunkUpload(id string) (*chunkUpload, error) {
+	if !validUploadID(id) {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(s.chunkDir(id), "info.json"))
+	if err != nil {
+		return nil, err
+	}
+	var u chunkUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// receivedChunks 列出某个上传已完整收到的分块序号，只算 0 到 total-1
+func (s *Server) receivedChunks(id string, total int) ([]int, error) {
+	entries, err := os.ReadDir(s.chunkDir(id))
+	if err != nil {
+		return nil, err
+	}
+	chunks := []int{}
+	for _, entry := range entries {
+		if index, err := strconv.Atoi(entry.Name()); err == nil && index >= 0 && index < total {
+			chunks = append(chunks, index)
+		}
+	}
+	sort.Ints(chunks)
+	return chunks, nil
+}
+
+// sweepUploads 删除超过 uploadExpiry 没有动静的分块上传
+func (s *Server) sweepUploads() {
+	entries, err := os.ReadDir(s.uploadDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < uploadExpiry {
+			continue
+		}
+		log.Printf("[upload]清理过期的分块上传 %s", entry.Name())
+		os.RemoveAll(filepath.Join(s.uploadDir, entry.Name()))
+		s.uploadLocks.Delete(entry.Name())
+	}
+}
+
+// uploadTarget 校验分块上传的目标位置，返回目标文件的完整路径；不能上传时已输出错误响应
+func (s *Server) uploadTarget(w http.ResponseWriter, r *http.Request, u *chunkUpload) (string, bool) {
+	dirPath, _, err := s.resolvePath(u.Dir)
+	if err != nil || dirPath == "" || !validName(u.Name) || !s.extAllowed(u.Name) || s.pathHidden(filepath.Join(dirPath, u.Name)) {
+		s.renderError(w, r, http.StatusForbidden, "禁止上传到该位置")
+		return "", false
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		s.renderError(w, r, http.StatusNotFound, "目录未找到")
+		return "", false
+	}
+	if !s.checkDirAuth(w, r, dirPath) {
+		return "", false
+	}
+	return filepath.Join(dirPath, u.Name), true
+}
+
+// handleUploadCreate 创建分块上传：POST /_nfs/upload/create?dir=&name=&total=[&overwrite=1]，返回 {"id": ...}。
+// ID 由服务器随机生成并和目标位置、分块数绑定，之后的分块和状态查询都要带上它
+func (s *Server) handleUploadCreate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	total, err := strconv.Atoi(query.Get("total"))
+	if err != nil || total < 1 || total > maxChunks {
+		s.renderError(w, r, http.StatusBadRequest, "分块参数无效")
+		return
+	}
+	u := &chunkUpload{Dir: query.Get("dir"), Name: query.Get("name"), Total: total, Overwrite: query.Get("overwrite") == "1"}
+	// 先校验最终的目标位置，避免收完所有分块才发现不能保存
+	target, ok := s.uploadTarget(w, r, u)
+	if !ok {
+		return
+	}
+	// 默认不覆盖已有文件，带 overwrite=1 才替换；这里提前拒绝，拼接时还会再原子地检查一次
+	if _, err := os.Lstat(target); err == nil && !u.Overwrite {
+		s.renderError(w, r, http.StatusConflict, "文件已存在")
+		return
+	}
+
+	s.sweepUploads()
+	id, err := newUploadID()
+	if err == nil {
+		err = os.MkdirAll(s.uploadDir, 0700)
+	}
+	if err == nil {
+		err = os.Mkdir(s.chunkDir(id), 0700)
+	}
+	if err == nil {
+		data, _ := json.Marshal(u)
+		err = os.WriteFile(filepath.Join(s.chunkDir(id), "info.json"), data, 0600)
+	}
+	if err != nil {
+		log.Printf("创建分块上传失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "创建上传失败")
+		return
+	}
+	log.Printf("[upload]开始分块上传 %s (%d 块)", target, total)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		ID string `json:"id"`
+	}{id})
+}
+
+// handleUploadChunk 接收一个分块：POST /_nfs/upload/chunk?id=&index=，请求体为分块内容。
+// 分块可以乱序、重复到达，收齐创建时约定的块数后拼接成完整文件并原子地移动到目标目录
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id := query.Get("id")
+	u, err := s.loadChunkUpload(id)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "上传未找到")
+		return
+	}
+	index, err := strconv.Atoi(query.Get("index"))
+	if err != nil || index < 0 || index >= u.Total {
+		s.renderError(w, r, http.StatusBadRequest, "分块参数无效")
+		return
+	}
+	noTimeout(w)
+	target, ok := s.uploadTarget(w, r, u)
+	if !ok {
+		return
+	}
+
+	http.NewResponseController(w).SetReadDeadline(time.Now().Add(chunkReadTimeout))
+	dir := s.chunkDir(id)
+	// 先写 .part 再改名，中途断开的分块不会被当成已收到
+	part := filepath.Join(dir, strconv.Itoa(index)+".part")
+	f, err := os.Create(part)
+	if err != nil {
+		log.Printf("保存分块失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "保存分块失败")
+		return
+	}
+	_, err = io.Copy(f, http.MaxBytesReader(w, r.Body, maxChunkSize))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(part, filepath.Join(dir, strconv.Itoa(index)))
+	}
+	if err != nil {
+		os.Remove(part)
+		log.Printf("保存分块失败: %v", err)
+		s.renderError(w, r, http.StatusBadRequest, "分块接收不完整")
+		return
+	}
+
+	lock, _ := s.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	chunks, err := s.receivedChunks(id, u.Total)
+	if err != nil || len(chunks) < u.Total {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	n, err := assembleChunks(dir, u.Total, target, u.Overwrite)
+	if errors.Is(err, os.ErrExist) {
+		s.renderError(w, r, http.StatusConflict, "文件已存在")
+		return
+	} else if err != nil {
+		log.Printf("拼接分块失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "拼接文件失败")
+		return
+	}
+	os.RemoveAll(dir)
+	s.uploadLocks.Delete(id)
+	log.Printf("[upload]%s %d 字节", target, n)
+	s.audit.Record(r, "upload", target, n)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleUpload 接收 multipart/form-data 表单上传(页面不支持 JavaScript 时的上传方式，也方便 curl -F)：
+// 表单里的 dir 字段必须在文件之前，overwrite=1(表单字段或查询参数)时覆盖同名文件。文件边接收边写入目标目录的临时文件，
+// 不在内存中缓存，完成后原子地改名
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	noTimeout(w)
+	rc := http.NewResponseController(w)
+
+	var dirPath, relPath string
+	overwrite, uploaded := r.URL.Query().Get("overwrite") == "1", 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("读取上传内容失败: %v", err)
+			s.renderError(w, r, http.StatusBadRequest, "上传内容不完整")
+			return
+		}
+
+		switch part.FormName() {
+		case "dir":
+			v, _ := io.ReadAll(io.LimitReader(part, 4096))
+			dirPath, relPath, err = s.resolvePath(string(v))
+			if err != nil || dirPath == "" || s.pathHidden(dirPath) {
+				s.renderError(w, r, http.StatusForbidden, "禁止上传到该位置")
+				return
+			}
+			if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+				s.renderError(w, r, http.StatusNotFound, "目录未找到")
+				return
+			}
+			if !s.checkDirAuth(w, r, dirPath) {
+				return
+			}
+		case "overwrite":
+			v, _ := io.ReadAll(io.LimitReader(part, 16))
+			overwrite = string(v) == "1"
+		case "file":
+			if part.FileName() == "" {
+				continue // 没有选择文件
+			}
+			if dirPath == "" {
+				s.renderError(w, r, http.StatusBadRequest, "缺少上传目录(dir 字段需在文件之前)")
+				return
+			}
+			// 部分浏览器会带上客户端的完整路径，只取文件名
+			name := path.Base(strings.ReplaceAll(part.FileName(), `\`, "/"))
+			target := filepath.Join(dirPath, name)
+			if !validName(name) || !s.extAllowed(name) || s.pathHidden(target) {
+				s.renderError(w, r, http.StatusForbidden, "禁止上传该文件: "+name)
+				return
+			}
+			n, err := saveUpload(&deadlineReader{r: part, rc: rc}, target, overwrite)
+			if errors.Is(err, os.ErrExist) {
+				s.renderError(w, r, http.StatusConflict, "文件已存在: "+name)
+				return
+			} else if err != nil {
+				log.Printf("上传失败: %v", err)
+				s.renderError(w, r, http.StatusInternalServerError, "上传失败: "+name)
+				return
+			}
+			log.Printf("[upload]%s %d 字节", target, n)
+			s.audit.Record(r, "upload", target, n)
+			uploaded++
+		}
+	}
+	if uploaded == 0 {
+		s.renderError(w, r, http.StatusBadRequest, "没有收到文件")
+		return
+	}
+	s.redirectToDir(w, r, relPath)
+}
+
+// saveUpload 把 src 写入目标目录下的临时文件，完成后交给 commitUpload 改名；任何一步失败都删除临时文件
+func saveUpload(src io.Reader, target string, overwrite bool) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(target), uploadTempPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, commitUpload(tmp.Name(), target, overwrite)
+}
+
+// deadlineReader 每次读取前把连接的读超时往后推 chunkReadTimeout：
+// 持续上传的大文件不会被服务器的 ReadTimeout 切断，停止发送的客户端仍会超时
+type deadlineReader struct {
+	r  io.Reader
+	rc *http.ResponseController
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	d.rc.SetReadDeadline(time.Now().Add(chunkReadTimeout))
+	return d.r.Read(p)
+}
+
+// assembleChunks 按序号把分块拼接到目标目录下的临时文件，完成后改名为目标文件。
+// 拼接期间目标文件保持原样，同名的并发上传各写各的临时文件，互不干扰；
+// 最后由 commitUpload 原子地放到目标位置
+func assembleChunks(dir string, total int, target string, overwrite bool) (written int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(target), uploadTempPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	for i := 0; i < total; i++ {
+		chunk, err := os.Open(filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			tmp.Close()
+			return 0, err
+		}
+		n, err := io.Copy(tmp, chunk)
+		chunk.Close()
+		written += n
+		if err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return written, commitUpload(tmp.Name(), target, overwrite)
+}
+
+// commitUpload 把写好的临时文件原子地放到目标位置。不覆盖时用 linkNoReplace，目标已存在返回 os.ErrExist；
+// 覆盖时直接改名，但目标是文件夹或其他特殊文件时也返回 os.ErrExist。失败时临时文件由调用方删除
+func commitUpload(tmpPath, target string, overwrite bool) error {
+	if !overwrite {
+		if err := linkNoReplace(tmpPath, target); err != nil {
+			return err
+		}
+		os.Remove(tmpPath)
+		return nil
+	}
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		return os.ErrExist
+	}
+	return os.Rename(tmpPath, target)
+}
+
+// linkNoReplace 在 target 不存在时把 src 硬链接过去，已存在返回 os.ErrExist。创建链接本身就是原子的检查，
+// 不会像先 Lstat 再 Rename 那样在两步之间被同名的上传或移动抢先。文件系统不支持硬链接时(如 FAT、部分网络盘)
+// 先用 O_EXCL 占住目标名，再改名覆盖这个空文件
+func linkNoReplace(src, target string) error {
+	err := os.Link(src, target)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if err := os.Rename(src, target); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// handleUploadStatus 返回某个上传已收到的分块序号，客户端据此只补传缺少的分块
+func (s *Server) handleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	u, err := s.loadChunkUpload(id)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "上传未找到")
+		return
+	}
+	if _, ok := s.uploadTarget(w, r, u); !ok {
+		return
+	}
+	chunks, err := s.receivedChunks(id, u.Total)
+	if err != nil {
+		s.renderFSError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ID       string `json:"id"`
+		Received []int  `json:"received"`
+	}{id, chunks})
+}
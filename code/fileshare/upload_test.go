@@ -0,0 +1,392 @@
+package fileshare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createUpload 创建上传 dir/name 的分块上传，返回服务器给的 ID 和状态码
+func createUpload(t *testing.T, h http.Handler, dir, name string, total int, extra ...string) (string, int) {
+	t.Helper()
+	query := url.Values{"dir": {dir}, "name": {name}, "total": {fmt.Sprint(total)}}
+	for i := 0; i+1 < len(extra); i += 2 {
+		query.Set(extra[i], extra[i+1])
+	}
+	rec := do(t, h, "POST", "/_nfs/upload/create?"+query.Encode(), nil)
+	if rec.Code != http.StatusCreated {
+		return "", rec.Code
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("POST /upload/create 返回 %q", rec.Body.String())
+	}
+	return created.ID, rec.Code
+}
+
+// sendChunk 上传 id 的第 index 块
+func sendChunk(t *testing.T, h http.Handler, id string, index int, data string) int {
+	t.Helper()
+	return do(t, h, "POST", fmt.Sprintf("/_nfs/upload/chunk?id=%s&index=%d", id, index), strings.NewReader(data)).Code
+}
+
+func uploadStatus(t *testing.T, h http.Handler, id string) []int {
+	t.Helper()
+	rec := do(t, h, "GET", "/_nfs/upload/status?id="+id, nil)
+	var status struct {
+		Received []int `json:"received"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("GET /upload/status = %d %q", rec.Code, rec.Body.String())
+	}
+	return status.Received
+}
+
+func TestChunkedUpload(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir()) // 分块暂存在系统临时目录下
+	s, root := newTestServer(t, Config{Writable: true}, map[string]string{"docs/.keep": ""})
+	h := s.Handler()
+	chunks := []string{"alpha-", "bravo-", "charlie-", "delta"}
+	id, code := createUpload(t, h, "docs", "big.bin", len(chunks))
+	if code != http.StatusCreated {
+		t.Fatalf("创建上传 = %d", code)
+	}
+
+	if got := uploadStatus(t, h, id); len(got) != 0 {
+		t.Errorf("开始前已收到 %v", got)
+	}
+	// 乱序到达，中间缺一块
+	for _, i := range []int{2, 0} {
+		if code := sendChunk(t, h, id, i, chunks[i]); code != http.StatusAccepted {
+			t.Fatalf("分块 %d = %d, 应为202", i, code)
+		}
+	}
+	// 重复发送已收到的分块不影响结果
+	if code := sendChunk(t, h, id, 2, chunks[2]); code != http.StatusAccepted {
+		t.Errorf("重复的分块 = %d", code)
+	}
+	// 分块目录里多出的序号(比如以前留下的)不算数，也不参与拼接
+	os.WriteFile(filepath.Join(s.chunkDir(id), "7"), []byte("stale"), 0600)
+	if got := uploadStatus(t, h, id); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("已收到 %v, 应为 [0 2]", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "docs", "big.bin")); err == nil {
+		t.Fatal("没有收齐就生成了文件")
+	}
+
+	// 断线后按 status 补传缺少的分块
+	if code := sendChunk(t, h, id, 3, chunks[3]); code != http.StatusAccepted {
+		t.Fatalf("分块 3 = %d", code)
+	}
+	if code := sendChunk(t, h, id, 1, chunks[1]); code != http.StatusCreated {
+		t.Fatalf("最后一块 = %d, 应为201", code)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "docs", "big.bin"))
+	if err != nil || string(data) != strings.Join(chunks, "") {
+		t.Errorf("拼接结果 %q, %v", data, err)
+	}
+	if _, err := os.Stat(s.chunkDir(id)); !os.IsNotExist(err) {
+		t.Error("完成后没有清理分块")
+	}
+	if rec := do(t, h, "GET", "/_nfs/upload/status?id="+id, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("完成后查询状态 = %d, 应为404", rec.Code)
+	}
+
+	// 目标已存在时默认拒绝，overwrite=1 才替换
+	if _, code := createUpload(t, h, "docs", "big.bin", 1); code != http.StatusConflict {
+		t.Errorf("目标已存在 = %d, 应为409", code)
+	}
+	id, _ = createUpload(t, h, "docs", "big.bin", 1, "overwrite", "1")
+	if code := sendChunk(t, h, id, 0, "new"); code != http.StatusCreated {
+		t.Errorf("overwrite=1 = %d", code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "docs", "big.bin")); string(data) != "new" {
+		t.Errorf("覆盖后内容为 %q", data)
+	}
+}
+
+// 上传 ID 由服务器随机生成，猜不到别人的上传；分块存放在各服务器自己的目录，过期的上传会被清理
+func TestChunkedUploadIDs(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	s, _ := newTestServer(t, Config{Writable: true}, nil)
+	h := s.Handler()
+
+	first, _ := createUpload(t, h, "", "a.bin", 2)
+	second, _ := createUpload(t, h, "", "a.bin", 2)
+	if first == second || !validUploadID(first) {
+		t.Errorf("上传 ID %q、%q 应随机生成", first, second)
+	}
+	if !strings.HasPrefix(s.chunkDir(first), s.uploadDir+string(filepath.Separator)) {
+		t.Errorf("分块目录 %s 不在 %s 下", s.chunkDir(first), s.uploadDir)
+	}
+	other, _ := newTestServer(t, Config{Writable: true}, nil)
+	if other.uploadDir == s.uploadDir {
+		t.Errorf("不同共享目录的服务器使用了同一个暂存目录 %s", s.uploadDir)
+	}
+
+	// 不是服务器创建的 ID 不能查询，也不能写入分块
+	for _, id := range []string{"upload-1", strings.Repeat("0", 32), "../x"} {
+		if rec := do(t, h, "GET", "/_nfs/upload/status?id="+id, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("查询 %q = %d, 应为404", id, rec.Code)
+		}
+		if code := sendChunk(t, h, id, 0, "x"); code != http.StatusNotFound {
+			t.Errorf("向 %q 发送分块 = %d, 应为404", id, code)
+		}
+	}
+
+	old := time.Now().Add(-uploadExpiry - time.Hour)
+	if err := os.Chtimes(s.chunkDir(first), old, old); err != nil {
+		t.Fatal(err)
+	}
+	createUpload(t, h, "", "b.bin", 1)
+	if _, err := os.Stat(s.chunkDir(first)); !os.IsNotExist(err) {
+		t.Error("过期的上传没有被清理")
+	}
+	if _, err := os.Stat(s.chunkDir(second)); err != nil {
+		t.Errorf("未过期的上传被清理: %v", err)
+	}
+}
+
+func TestChunkedUploadRejectsBadParams(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	s, root := newTestServer(t, Config{Writable: true}, nil)
+	h := s.Handler()
+	tests := []struct {
+		total     int
+		dir, name string
+		want      int
+	}{
+		{0, "", "a.txt", http.StatusBadRequest},
+		{maxChunks + 1, "", "a.txt", http.StatusBadRequest},
+		{1, "", "../a.txt", http.StatusForbidden},
+		{1, "", authFileName, http.StatusForbidden},
+		{1, "missing", "a.txt", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if _, code := createUpload(t, h, tt.dir, tt.name, tt.total); code != tt.want {
+			t.Errorf("total=%d dir=%q name=%q: %d, 应为 %d", tt.total, tt.dir, tt.name, code, tt.want)
+		}
+	}
+
+	id, _ := createUpload(t, h, "", "a.txt", 1)
+	for _, index := range []int{-1, 1} {
+		if code := sendChunk(t, h, id, index, "x"); code != http.StatusBadRequest {
+			t.Errorf("index=%d: %d, 应为400", index, code)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("共享目录中出现了 %d 个文件", len(entries))
+	}
+}
+
+// postUpload 以 multipart 表单上传一个文件，fields 依次是 名称、值，写在文件之前
+func postUpload(t *testing.T, h http.Handler, target, fileName, content string, fields ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i := 0; i+1 < len(fields); i += 2 {
+		mw.WriteField(fields[i], fields[i+1])
+	}
+	// CreateFormFile 会转义文件名中的引号和反斜杠，这里手写头部，原样发送客户端给的文件名
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="`+fileName+`"`)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(part, content)
+	mw.Close()
+	return do(t, h, "POST", target, &body, "Content-Type", mw.FormDataContentType())
+}
+
+func TestUploadFileName(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "share")
+	writeFiles(t, root, map[string]string{"docs/.keep": ""})
+	s, err := New(Config{Dirs: []string{root}, Writable: true, Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+
+	// 客户端给的路径只取最后一段，文件总是保存在 dir 指定的目录里
+	for _, name := range []string{"../escape.txt", "../../escape.txt", `..\..\escape.txt`, "/etc/escape.txt", `C:\Users\me\escape.txt`} {
+		if rec := postUpload(t, h, "/_nfs/upload", name, name, "dir", "docs"); rec.Code != http.StatusSeeOther {
+			t.Errorf("上传 %q = %d, 应为303", name, rec.Code)
+		}
+		if data, err := os.ReadFile(filepath.Join(root, "docs", "escape.txt")); err != nil || string(data) != name {
+			t.Errorf("上传 %q 后 docs/escape.txt = %q, %v", name, data, err)
+		}
+		os.Remove(filepath.Join(root, "docs", "escape.txt"))
+	}
+	for _, name := range []string{"..", "../..", `..\..`, "."} {
+		if rec := postUpload(t, h, "/_nfs/upload", name, "x", "dir", "docs"); rec.Code != http.StatusForbidden {
+			t.Errorf("上传 %q = %d, 应为403", name, rec.Code)
+		}
+	}
+	// dir 中的 .. 到共享根目录为止
+	if rec := postUpload(t, h, "/_nfs/upload", "up.txt", "x", "dir", "../.."); rec.Code != http.StatusSeeOther {
+		t.Errorf("dir=../.. 上传 = %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "up.txt")); err != nil {
+		t.Errorf("dir=../.. 应保存在共享根目录: %v", err)
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Errorf("共享目录之外出现了文件: %v", entries)
+	}
+}
+
+func TestUploadConflict(t *testing.T) {
+	s, root := newTestServer(t, Config{Writable: true}, map[string]string{"docs/a.txt": "old"})
+	h := s.Handler()
+	target := filepath.Join(root, "docs", "a.txt")
+
+	rec := postUpload(t, h, "/_nfs/upload", "a.txt", "new", "dir", "docs")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("上传同名文件 = %d, 应为409", rec.Code)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("没有确认就覆盖了文件: %q", data)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(root, "docs", uploadTempPrefix+"*")); len(tmp) != 0 {
+		t.Errorf("冲突后留下了临时文件: %v", tmp)
+	}
+
+	for _, tt := range []struct {
+		target  string
+		fields  []string
+		content string
+	}{
+		{"/_nfs/upload", []string{"dir", "docs", "overwrite", "1"}, "form"},
+		{"/_nfs/upload?overwrite=1", []string{"dir", "docs"}, "query"},
+	} {
+		if rec := postUpload(t, h, tt.target, "a.txt", tt.content, tt.fields...); rec.Code != http.StatusSeeOther {
+			t.Errorf("%s %v 覆盖上传 = %d, 应为303", tt.target, tt.fields, rec.Code)
+		}
+		if data, _ := os.ReadFile(target); string(data) != tt.content {
+			t.Errorf("%s %v 覆盖后内容为 %q, 应为 %q", tt.target, tt.fields, data, tt.content)
+		}
+	}
+
+	// 不存在的文件不需要 overwrite
+	if rec := postUpload(t, h, "/_nfs/upload", "b.txt", "b", "dir", "docs"); rec.Code != http.StatusSeeOther {
+		t.Errorf("上传新文件 = %d", rec.Code)
+	}
+}
+
+// 多个客户端同时上传同名文件：最终文件是其中一次完整的上传，不会交错，也不留下临时文件
+func TestConcurrentUploadsSameName(t *testing.T) {
+	const uploaders, size = 8, 1 << 20
+	s, root := newTestServer(t, Config{Writable: true}, map[string]string{"docs/.keep": ""})
+	h := s.Handler()
+	target := filepath.Join(root, "docs", "same.bin")
+
+	upload := func(overwrite bool) []int {
+		codes := make([]int, uploaders)
+		var wg sync.WaitGroup
+		for i := 0; i < uploaders; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				fields := []string{"dir", "docs"}
+				if overwrite {
+					fields = append(fields, "overwrite", "1")
+				}
+				codes[i] = postUpload(t, h, "/_nfs/upload", "same.bin", strings.Repeat(string(rune('a'+i)), size), fields...).Code
+			}(i)
+		}
+		wg.Wait()
+		return codes
+	}
+	checkFile := func() {
+		t.Helper()
+		data, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != size || strings.Count(string(data), string(data[0])) != size {
+			t.Errorf("最终文件 %d 字节，内容不是同一次上传", len(data))
+		}
+		if tmp, _ := filepath.Glob(filepath.Join(root, "docs", uploadTempPrefix+"*")); len(tmp) != 0 {
+			t.Errorf("留下了临时文件: %v", tmp)
+		}
+	}
+
+	// 不覆盖时只有一个成功，其余得到409
+	created, conflicts := 0, 0
+	for _, code := range upload(false) {
+		switch code {
+		case http.StatusSeeOther:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("上传返回 %d", code)
+		}
+	}
+	if created != 1 || conflicts != uploaders-1 {
+		t.Errorf("不覆盖: %d 个成功, %d 个冲突", created, conflicts)
+	}
+	checkFile()
+
+	// 覆盖时都成功，最后改名的那个生效
+	for i, code := range upload(true) {
+		if code != http.StatusSeeOther {
+			t.Errorf("第 %d 个覆盖上传返回 %d", i, code)
+		}
+	}
+	checkFile()
+}
+
+// commitUpload 不覆盖时靠硬链接原子地判断目标是否存在，不依赖先检查再改名
+func TestCommitUploadNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	tmp, target := filepath.Join(dir, uploadTempPrefix+"1"), filepath.Join(dir, "a.txt")
+	os.WriteFile(tmp, []byte("new"), 0600)
+	os.WriteFile(target, []byte("old"), 0644)
+
+	if err := commitUpload(tmp, target, false); !errors.Is(err, os.ErrExist) {
+		t.Errorf("目标已存在时返回 %v, 应为 os.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("目标被改成了 %q", data)
+	}
+	if err := commitUpload(tmp, filepath.Join(dir, "b.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "b.txt")); string(data) != "new" {
+		t.Errorf("新文件内容为 %q", data)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("完成后留下了临时文件")
+	}
+
+	os.WriteFile(tmp, []byte("new"), 0600)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err := commitUpload(tmp, filepath.Join(dir, "sub"), true); !errors.Is(err, os.ErrExist) {
+		t.Errorf("覆盖文件夹返回 %v, 应为 os.ErrExist", err)
+	}
+	if err := commitUpload(tmp, target, true); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("覆盖后内容为 %q", data)
+	}
+}
@@ -0,0 +1,151 @@
+package fileshare
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dirSizeWorkers 是同时统计文件夹大小的协程数，dirSizeTTL 是统计结果的缓存时间，
+// dirSizeCacheSize 是最多缓存的文件夹数
+const (
+	dirSizeWorkers   = 4
+	dirSizeTTL       = 30 * time.Second
+	dirSizeCacheSize = 4096
+)
+
+type cachedSize struct {
+	size int64
+	at   time.Time
+}
+
+// dirSize 递归统计文件夹内所有文件的总字节数，结果缓存 dirSizeTTL，避免每次请求都重新扫描
+func (s *Server) dirSize(path string) (int64, error) {
+	cached, ok := s.dirSizes.get(path)
+	if ok && time.Since(cached.at) < dirSizeTTL {
+		return cached.size, nil
+	}
+
+	var total int64
+	err := s.walkLimited(path, func(p string, d fs.DirEntry) error {
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.dirSizes.put(path, cachedSize{size: total, at: time.Now()})
+	return total, nil
+}
+
+// walkLimited 递归遍历 root 下的所有文件，对每个非目录条目调用 fn，是统计大小、打包、搜索共用的遍历。
+// 指向目录的符号链接会跟随进入(指向共享目录以外的除外)，和浏览时看到的一致；按解析后的真实路径记录访问过的目录，
+// 链接成环或重复指向时只遍历一次。超过 -max-depth 层的目录和无权限读取的目录跳过并记录日志。
+// 符号链接会被解析，传给 fn 的条目类型是链接目标的类型
+func (s *Server) walkLimited(root string, fn func(path string, d fs.DirEntry) error) error {
+	return s.walkFrom(root, 0, walkOptions{}, fn)
+}
+
+// walkOptions 调整 walkFrom 的行为，零值即 walkLimited 的行为
+type walkOptions struct {
+	dirs      bool // 进入目录之前也对它调用 fn，fn 返回 filepath.SkipDir 时不进入
+	keepLinks bool // 符号链接原样交给 fn，不跟随、不解析(tar 保留链接本身)
+}
+
+// walkFrom 同 walkLimited，root 本身位于第 depth 层，用于并发遍历时从起点的子目录开始
+func (s *Server) walkFrom(root string, depth int, opts walkOptions, fn func(path string, d fs.DirEntry) error) error {
+	visited := map[string]bool{}
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			log.Printf("遍历时跳过 %s: %v", dir, err)
+			return nil
+		}
+		if visited[real] {
+			log.Printf("遍历时跳过 %s: 链接指向已遍历过的目录 %s", dir, real)
+			return nil
+		}
+		visited[real] = true
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// 无权限读取的子目录直接跳过，不影响其余部分
+			log.Printf("遍历时跳过 %s: %v", dir, err)
+			return nil
+		}
+		for _, entry := range entries {
+			p := filepath.Join(dir, entry.Name())
+			if entry.Type()&fs.ModeSymlink != 0 {
+				if !s.linkConfined(p) {
+					continue
+				}
+				info, err := os.Stat(p)
+				if err != nil {
+					continue // 失效的链接
+				}
+				if !opts.keepLinks {
+					entry = fs.FileInfoToDirEntry(info)
+				}
+			}
+			if !entry.IsDir() {
+				if err := fn(p, entry); err != nil {
+					return err
+				}
+				continue
+			}
+			if s.cfg.MaxDepth > 0 && depth+1 > s.cfg.MaxDepth {
+				log.Printf("遍历时跳过 %s: 超过最大深度 %d", p, s.cfg.MaxDepth)
+				continue
+			}
+			if opts.dirs {
+				if err := fn(p, entry); errors.Is(err, filepath.SkipDir) {
+					continue
+				} else if err != nil {
+					return err
+				}
+			}
+			if err := walk(p, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, depth)
+}
+
+// fillDirSizes 用有限数量的协程并发统计当前页各个文件夹的大小
+func (s *Server) fillDirSizes(dirPath string, entries []FileEntry) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < dirSizeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				size, err := s.dirSize(filepath.Join(dirPath, filepath.Base(entries[idx].Path)))
+				if err != nil {
+					log.Printf("统计文件夹大小失败: %v", err)
+					continue
+				}
+				entries[idx].Size = humanizeBytes(size)
+			}
+		}()
+	}
+	for i := range entries {
+		if entries[i].IsDir {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
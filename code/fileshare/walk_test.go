@@ -0,0 +1,108 @@
+package fileshare
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// walkFiles 返回 walkLimited 遍历到的文件(相对 root)，超时未结束时测试失败
+func walkFiles(t *testing.T, s *Server, root string) []string {
+	t.Helper()
+	var files []string
+	done := make(chan error, 1)
+	go func() {
+		done <- s.walkLimited(root, func(p string, d fs.DirEntry) error {
+			rel, _ := filepath.Rel(root, p)
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("遍历没有结束")
+	}
+	sort.Strings(files)
+	return files
+}
+
+// 超过 -max-depth 的目录被跳过并记录日志，其余照常遍历
+func TestWalkLimitedDepth(t *testing.T) {
+	files := map[string]string{}
+	dir := ""
+	for i := 0; i < 100; i++ {
+		dir += "d/"
+		files[dir+"f.txt"] = "x"
+	}
+	files["top.txt"] = "x"
+	s, root := newTestServer(t, Config{MaxDepth: 3}, files)
+	buf := captureLog(t)
+
+	got := walkFiles(t, s, root)
+	want := []string{"d/d/d/f.txt", "d/d/f.txt", "d/f.txt", "top.txt"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("遍历到 %q, 应为 %q", got, want)
+	}
+	if !strings.Contains(buf.String(), "超过最大深度 3") {
+		t.Errorf("跳过过深的目录时应记录日志:\n%s", buf.String())
+	}
+
+	// 统计大小和打包用的是同一个遍历
+	if size, err := s.dirSize(root); err != nil || size != 4 {
+		t.Errorf("dirSize = %d, %v, 应为 4", size, err)
+	}
+	rec := do(t, s.Handler(), "GET", "/?download=zip", nil)
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("GET /?download=zip = %d: %v", rec.Code, err)
+	}
+	if len(zr.File) != len(want) {
+		t.Errorf("zip 中有 %d 个文件，应为 %d", len(zr.File), len(want))
+	}
+}
+
+// 符号链接成环时每个目录只遍历一次，搜索、统计大小和打包都能结束
+func TestWalkLimitedSymlinkCycle(t *testing.T) {
+	s, root := newTestServer(t, Config{}, map[string]string{"a/b/f.txt": "x", "a/g.txt": "y"})
+	for link, target := range map[string]string{
+		"a/b/up":   "..", // 指回上级
+		"a/b/self": ".",  // 指向自己
+		"a/loop":   filepath.Join(root, "a"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+	buf := captureLog(t)
+
+	got := walkFiles(t, s, root)
+	want := []string{"a/b/f.txt", "a/g.txt"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("遍历到 %q, 应为 %q", got, want)
+	}
+	if !strings.Contains(buf.String(), "链接指向已遍历过的目录") {
+		t.Errorf("跳过成环的链接时应记录日志:\n%s", buf.String())
+	}
+
+	if size, err := s.dirSize(root); err != nil || size != 2 {
+		t.Errorf("dirSize = %d, %v, 应为 2", size, err)
+	}
+	h := s.Handler()
+	if rec := do(t, h, "GET", "/_nfs/search?q=f.txt", nil); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "f.txt</a>") != 1 {
+		t.Errorf("GET /search?q=f.txt = %d, 应只找到一个结果", rec.Code)
+	}
+	if rec := do(t, h, "GET", "/a/?download=zip", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /a/?download=zip = %d", rec.Code)
+	}
+}
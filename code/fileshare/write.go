@@ -0,0 +1,163 @@
+package fileshare
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validName 检查新建的文件(夹)名不含路径分隔符，不能借此跳到其他目录
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func (s *Server) handleMkdir(w http.ResponseWriter, r *http.Request) {
+	dirPath, relPath, err := s.resolvePath(r.FormValue("dir"))
+	if err != nil || dirPath == "" {
+		log.Printf("非法路径: %v", err)
+		s.renderError(w, r, http.StatusForbidden, "禁止访问")
+		return
+	}
+	if !s.checkDirAuth(w, r, dirPath) {
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if !validName(name) || name == authFileName || name == hideFileName {
+		s.renderError(w, r, http.StatusBadRequest, "文件夹名称无效")
+		return
+	}
+	// 与 GET 一样，隐藏的位置按不存在处理，不能借新建文件夹探测隐藏的名字或在隐藏目录里新建
+	target := filepath.Join(dirPath, name)
+	if s.pathHidden(dirPath) || s.pathHidden(target) {
+		s.renderError(w, r, http.StatusNotFound, "目录未找到")
+		return
+	}
+
+	if err := os.Mkdir(target, 0755); err != nil {
+		log.Printf("新建文件夹失败: %v", err)
+		if os.IsExist(err) {
+			s.renderError(w, r, http.StatusConflict, "文件夹已存在")
+		} else {
+			s.renderError(w, r, http.StatusInternalServerError, "新建文件夹失败")
+		}
+		return
+	}
+	log.Printf("[mkdir]%s", target)
+	s.redirectToDir(w, r, relPath)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if relPath, ok := s.deletePath(w, r, r.FormValue("path")); ok {
+		s.redirectToDir(w, r, filepath.Dir(relPath))
+	}
+}
+
+// deletePath 删除文件或空文件夹，供表单和 DELETE 请求共用；失败时已输出错误响应
+func (s *Server) deletePath(w http.ResponseWriter, r *http.Request, reqPath string) (relPath string, ok bool) {
+	fullPath, relPath, err := s.resolvePath(reqPath)
+	if err != nil || fullPath == "" || s.isShareRoot(fullPath) {
+		log.Printf("非法删除路径: %q", reqPath)
+		s.renderError(w, r, http.StatusForbidden, "禁止访问")
+		return "", false
+	}
+	if s.pathHidden(fullPath) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return "", false
+	}
+	if !s.checkDirAuth(w, r, fullPath) {
+		return "", false
+	}
+
+	// os.Remove 只会删除文件或空文件夹
+	if err := os.Remove(fullPath); err != nil {
+		log.Printf("删除失败: %v", err)
+		if os.IsNotExist(err) {
+			s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		} else {
+			s.renderError(w, r, http.StatusConflict, "删除失败（文件夹需为空）")
+		}
+		return "", false
+	}
+	log.Printf("[delete]%s", fullPath)
+	s.audit.Record(r, "delete", fullPath, 0)
+	return relPath, true
+}
+
+// handleMove 重命名或移动文件(夹)：path 是原路径，to 是包含新名称的目标路径，都相对共享目录。
+// 不覆盖已有文件；不能把文件夹移到它自己里面，也不能跨共享目录(多目录模式)移动
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
+	src, _, err := s.resolvePath(r.FormValue("path"))
+	if err != nil || src == "" || s.isShareRoot(src) {
+		log.Printf("非法移动路径: %q", r.FormValue("path"))
+		s.renderError(w, r, http.StatusForbidden, "禁止访问")
+		return
+	}
+	dst, dstRel, err := s.resolvePath(r.FormValue("to"))
+	if err != nil || dst == "" || s.isShareRoot(dst) {
+		log.Printf("非法移动目标: %q", r.FormValue("to"))
+		s.renderError(w, r, http.StatusForbidden, "禁止移动到该位置")
+		return
+	}
+	if s.pathHidden(src) {
+		s.renderError(w, r, http.StatusNotFound, "文件未找到")
+		return
+	}
+	name := filepath.Base(dst)
+	if s.pathHidden(dst) || name == authFileName || name == hideFileName {
+		s.renderError(w, r, http.StatusForbidden, "禁止移动到该位置")
+		return
+	}
+	if !s.checkDirAuth(w, r, src) || !s.checkDirAuth(w, r, filepath.Dir(dst)) {
+		return
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		s.renderFSError(w, r, err)
+		return
+	}
+	// 原文件和新名称的扩展名都要允许，否则改个扩展名就能下载被禁止的文件
+	if !info.IsDir() && (!s.extAllowed(name) || !s.extAllowed(filepath.Base(src))) {
+		s.renderError(w, r, http.StatusForbidden, "不允许的扩展名: "+filepath.Base(src)+" → "+name)
+		return
+	}
+	if withinDir(src, dst) {
+		s.renderError(w, r, http.StatusBadRequest, "不能把文件夹移动到它自己里面")
+		return
+	}
+	if s.shareRootOf(src) != s.shareRootOf(dst) {
+		s.renderError(w, r, http.StatusBadRequest, "不能在不同的共享目录之间移动")
+		return
+	}
+	if parent, err := os.Stat(filepath.Dir(dst)); err != nil || !parent.IsDir() {
+		s.renderError(w, r, http.StatusNotFound, "目标文件夹不存在")
+		return
+	}
+
+	// 文件用硬链接移动，目标已存在时原子地失败，不会覆盖同时上传的同名文件；
+	// os.Rename 不会用文件夹覆盖已有文件，也不会覆盖非空文件夹
+	if info.IsDir() {
+		err = os.ErrExist
+		if _, statErr := os.Lstat(dst); statErr != nil {
+			err = os.Rename(src, dst)
+		}
+	} else if err = linkNoReplace(src, dst); err == nil {
+		// 不支持硬链接时 linkNoReplace 已经改名，原文件不在了
+		if err = os.Remove(src); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if errors.Is(err, os.ErrExist) {
+		s.renderError(w, r, http.StatusConflict, "目标已存在: "+filepath.ToSlash(dstRel))
+		return
+	} else if err != nil {
+		log.Printf("移动失败: %v", err)
+		s.renderError(w, r, http.StatusInternalServerError, "移动失败")
+		return
+	}
+	log.Printf("[move]%s → %s", src, dst)
+	s.audit.Record(r, "move", src+" → "+dst, 0)
+	s.redirectToDir(w, r, filepath.Dir(dstRel))
+}
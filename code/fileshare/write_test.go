@@ -0,0 +1,121 @@
+package fileshare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postForm 向 h 提交表单
+func postForm(t *testing.T, h http.Handler, target string, values url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	return do(t, h, "POST", target, strings.NewReader(values.Encode()), "Content-Type", "application/x-www-form-urlencoded")
+}
+
+func TestMkdirAndDelete(t *testing.T) {
+	s, root := newTestServer(t, Config{Writable: true}, map[string]string{"docs/old.txt": "x"})
+	h := s.Handler()
+
+	rec := postForm(t, h, "/_nfs/mkdir", url.Values{"dir": {"docs"}, "name": {"new"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("mkdir = %d", rec.Code)
+	}
+	if info, err := os.Stat(filepath.Join(root, "docs", "new")); err != nil || !info.IsDir() {
+		t.Fatalf("没有创建文件夹: %v", err)
+	}
+	if rec := postForm(t, h, "/_nfs/mkdir", url.Values{"dir": {"docs"}, "name": {"new"}}); rec.Code != http.StatusConflict {
+		t.Errorf("重复 mkdir = %d, 应为409", rec.Code)
+	}
+
+	if rec := postForm(t, h, "/_nfs/delete", url.Values{"path": {"docs/old.txt"}}); rec.Code != http.StatusSeeOther {
+		t.Errorf("删除文件 = %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "docs", "old.txt")); !os.IsNotExist(err) {
+		t.Error("文件没有被删除")
+	}
+	if rec := postForm(t, h, "/_nfs/delete", url.Values{"path": {"docs/new"}}); rec.Code != http.StatusSeeOther {
+		t.Errorf("删除空文件夹 = %d", rec.Code)
+	}
+	writeFiles(t, root, map[string]string{"full/keep.txt": "x"})
+	if rec := postForm(t, h, "/_nfs/delete", url.Values{"path": {"full"}}); rec.Code != http.StatusConflict {
+		t.Errorf("删除非空文件夹 = %d, 应为409", rec.Code)
+	}
+}
+
+// 隐藏的目录里不能新建文件夹，也不能新建与隐藏规则匹配的文件夹，都按不存在返回404
+func TestMkdirHidden(t *testing.T) {
+	s, root := newTestServer(t, Config{Writable: true}, map[string]string{
+		hideFileName:           "secret\n*.bak\n",
+		"secret/keep.txt":      "x",
+		"docs/" + hideFileName: "private\n",
+		"docs/readme.txt":      "x",
+	})
+	h := s.Handler()
+	for _, form := range []url.Values{
+		{"dir": {"secret"}, "name": {"new"}},
+		{"dir": {""}, "name": {"secret"}},
+		{"dir": {""}, "name": {"old.bak"}},
+		{"dir": {"docs"}, "name": {"private"}},
+	} {
+		if rec := postForm(t, h, "/_nfs/mkdir", form); rec.Code != http.StatusNotFound {
+			t.Errorf("mkdir %v = %d, 应为404", form, rec.Code)
+		}
+	}
+	for _, p := range []string{"secret/new", "old.bak", "docs/private"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(p))); err == nil {
+			t.Errorf("创建了隐藏的 %s", p)
+		}
+	}
+	if rec := postForm(t, h, "/_nfs/mkdir", url.Values{"dir": {"docs"}, "name": {"public"}}); rec.Code != http.StatusSeeOther {
+		t.Errorf("mkdir docs/public = %d", rec.Code)
+	}
+}
+
+// 请求路径中的 .. 在共享目录根部被截断，名称中的 .. 直接拒绝，共享目录本身不能删除
+func TestMkdirAndDeleteStayInRoot(t *testing.T) {
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"victim.txt": "keep"})
+	s, root := newTestServer(t, Config{Writable: true}, nil)
+	h := s.Handler()
+	rel, err := filepath.Rel(root, filepath.Join(outside, "victim.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, name := range []string{"..", "../escape", "a/b", ".nfsauth"} {
+		if rec := postForm(t, h, "/_nfs/mkdir", url.Values{"dir": {""}, "name": {name}}); rec.Code != http.StatusBadRequest {
+			t.Errorf("mkdir name=%q = %d, 应为400", name, rec.Code)
+		}
+	}
+	for _, dir := range []string{"..", "../..", path.Dir(rel)} {
+		postForm(t, h, "/_nfs/mkdir", url.Values{"dir": {dir}, "name": {"escape"}})
+	}
+	for _, p := range []string{filepath.Join(filepath.Dir(root), "escape"), filepath.Join(outside, "escape")} {
+		if _, err := os.Stat(p); err == nil {
+			t.Errorf("在共享目录以外创建了 %s", p)
+		}
+	}
+
+	for _, p := range []string{rel, "/" + rel, "%2e%2e/" + rel} {
+		if rec := postForm(t, h, "/_nfs/delete", url.Values{"path": {p}}); rec.Code == http.StatusSeeOther {
+			t.Errorf("删除 %q 成功，应失败", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "victim.txt")); err != nil {
+		t.Errorf("共享目录以外的文件被删除: %v", err)
+	}
+	for _, p := range []string{"", "/", ".", ".."} {
+		if rec := postForm(t, h, "/_nfs/delete", url.Values{"path": {p}}); rec.Code != http.StatusForbidden {
+			t.Errorf("删除共享目录 %q = %d, 应为403", p, rec.Code)
+		}
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("共享目录被删除: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package fileshare
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+)
+
+// readZip 返回压缩包中 文件名 → 内容
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("无法读取 zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestZipSelected(t *testing.T) {
+	s, _ := newTestServer(t, Config{}, map[string]string{
+		"a.txt":      "A",
+		"c.txt":      "C",
+		"docs/b.txt": "B",
+		"docs/d.txt": "D",
+	})
+	h := s.Handler()
+
+	rec := postForm(t, h, "/_nfs/zip-selected", url.Values{"path": {"a.txt", "docs/b.txt"}})
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("POST /zip-selected = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	files := readZip(t, rec.Body.Bytes())
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || files["a.txt"] != "A" || files["b.txt"] != "B" {
+		t.Errorf("压缩包内容 %q, 应只有 a.txt 和 b.txt", names)
+	}
+
+	for _, paths := range [][]string{nil, {"a.txt", "../outside.txt"}, {"missing.txt"}, {"docs"}} {
+		if rec := postForm(t, h, "/_nfs/zip-selected", url.Values{"path": paths}); rec.Code < 400 {
+			t.Errorf("path=%q: POST /zip-selected = %d, 应返回错误", paths, rec.Code)
+		}
+	}
+}
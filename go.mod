@@ -0,0 +1,12 @@
+module github.com/mcpackms/Network-File-Share
+
+go 1.22
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/crypto v0.31.0
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.30.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect